@@ -1,10 +1,22 @@
 #!/bin/bash
-mkdir -p /root/.ssh
-if [ -r /root/authorized/authorized_keys ]; then
-    cp /root/authorized/authorized_keys /root/.ssh
-fi
+if [ "$(id -u)" != "0" ]; then
+  # restricted mode, run sshd as current user with generated host key
+  echo "non-root mode, user: $(id -un)"
+  mkdir -p "${HOME}/.ssh" /tmp/sshd
+  if [ -r "${HOME}/authorized/authorized_keys" ]; then
+    cp "${HOME}/authorized/authorized_keys" "${HOME}/.ssh"
+    chmod 600 "${HOME}/.ssh/authorized_keys"
+  fi
+  ssh-keygen -q -N "" -t ecdsa -f /tmp/sshd/ssh_host_ecdsa_key
+  /usr/sbin/sshd -D -f /etc/ssh/sshd_config_restricted &
+else
+  mkdir -p /root/.ssh
+  if [ -r /root/authorized/authorized_keys ]; then
+      cp /root/authorized/authorized_keys /root/.ssh
+  fi
 
-/usr/sbin/sshd -D &
+  /usr/sbin/sshd -D &
+fi
 
 del_device_handler() {
   echo "delete tun device tun0"
@@ -23,6 +35,14 @@ if [ -n "${CLIENT_TUN_IP}" -a -n "${SERVER_TUN_IP}" ]; then
 
   echo "set up iptables"
   iptables -t nat -A POSTROUTING -s "${CLIENT_TUN_IP}" -o eth0 -j MASQUERADE
+
+  if [ -n "${CLIENT_TUN_IP6}" -a -n "${SERVER_TUN_IP6}" ]; then
+    echo "tun mod, client tun ipv6: ${CLIENT_TUN_IP6}, local tun ipv6: ${SERVER_TUN_IP6} "
+    echo "setup device ipv6"
+    ip -6 address add "${SERVER_TUN_IP6}"/"${TUN_MASK_LEN6}" dev tun1
+    echo "set up ip6tables"
+    ip6tables -t nat -A POSTROUTING -s "${CLIENT_TUN_IP6}" -o eth0 -j MASQUERADE
+  fi
 fi
 
 if [[ "${1}" = "--debug" ]]; then
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/apiserver/util"
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
+	"github.com/alibaba/kt-connect/pkg/kt/command"
+	opt "github.com/alibaba/kt-connect/pkg/kt/options"
+	ktUtil "github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var (
+	version = "dev"
+)
+
+func init() {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true})
+}
+
+// garbage collector of orphaned shadows, runs in cluster and watches all namespaces
+func main() {
+	options := opt.NewDaemonOptions()
+	var intervalInMinus int64
+
+	app := cli.NewApp()
+	app.Name = "kt-gc"
+	app.Usage = "delete expired shadows of all namespaces and recover exchanged deployments"
+	app.Version = version
+	app.Flags = []cli.Flag{
+		cli.Int64Flag{
+			Name:        "thresholdInMinus",
+			Usage:       "Length of allowed disconnection time before a unavailing shadow pod be deleted",
+			Destination: &options.CleanOptions.ThresholdInMinus,
+			Value:       ktUtil.ResourceHeartBeatIntervalMinus * 3,
+		},
+		cli.Int64Flag{
+			Name:        "intervalInMinus",
+			Usage:       "Interval between two rounds of collection",
+			Destination: &intervalInMinus,
+			Value:       ktUtil.ResourceHeartBeatIntervalMinus,
+		},
+		cli.BoolFlag{
+			Name:        "debug,d",
+			Usage:       "debug mode",
+			Destination: &options.Debug,
+		},
+	}
+	app.Action = func(c *cli.Context) error {
+		if options.Debug {
+			zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		}
+		clientset, config, err := util.GetKubernetesClient()
+		if err != nil {
+			return err
+		}
+		kubernetes, err := cluster.CreateFromClientSetAndConfig(clientset, config)
+		if err != nil {
+			return err
+		}
+
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(&typedCoreV1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+		defer broadcaster.Shutdown()
+		action := command.Action{
+			Recorder: broadcaster.NewRecorder(scheme.Scheme, coreV1.EventSource{Component: "kt-gc"}),
+		}
+
+		action.RunGarbageCollector(kubernetes, options, time.Duration(intervalInMinus)*time.Minute, make(chan struct{}))
+		return nil
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.Error().Msgf("End with error: %s", err.Error())
+		os.Exit(-1)
+	}
+}
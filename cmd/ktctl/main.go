@@ -33,6 +33,16 @@ func main() {
 	app.Version = version
 	app.Authors = command.NewCliAuthor()
 	app.Flags = command.AppFlags(options, version)
+	app.Before = func(c *cli.Context) error {
+		if err := command.SetUpLogAndMetrics(options); err != nil {
+			return err
+		}
+		if c.Args().First() != "clean" {
+			// clean command restores local changes by itself, so that dry run is respected
+			command.RestoreLocalChanges()
+		}
+		return nil
+	}
 
 	context := &kt.Cli{Options: options}
 	action := command.Action{}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"os"
+	"strconv"
 
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/metrics"
+	"github.com/alibaba/kt-connect/pkg/proxy/agent"
 	"github.com/alibaba/kt-connect/pkg/proxy/dnsserver"
+	"github.com/alibaba/kt-connect/pkg/proxy/probe"
 	"github.com/alibaba/kt-connect/pkg/proxy/socks"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -11,11 +16,23 @@ import (
 
 func init() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	if err := common.SetupLogger(os.Getenv(common.EnvVarLogFormat), false); err != nil {
+		_ = common.SetupLogger(common.LogFormatConsole, false)
+		log.Warn().Msg(err.Error())
+	}
 }
 
 func main() {
 	log.Info().Msg("Shadow staring...")
+	port := os.Getenv(common.EnvVarMetricsPort)
+	if port == "" {
+		port = strconv.Itoa(common.MetricsPort)
+	}
+	if ports := probe.Ports(os.Getenv(common.EnvVarProbePorts)); len(ports) > 0 {
+		metrics.Handle(common.ReadyPath, probe.Handler(ports))
+	}
+	metrics.Serve(":" + port)
 	go socks.Start()
+	go agent.Start()
 	dnsserver.Start()
 }
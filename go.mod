@@ -10,15 +10,19 @@ require (
 	github.com/gin-gonic/gin v1.7.0
 	github.com/golang/mock v1.6.0
 	github.com/gorilla/websocket v1.4.1
+	github.com/hashicorp/yamux v0.0.0-20200609203250-aecfd211c9ce
 	github.com/kubernetes/dashboard v1.10.1
 	github.com/linfan/socks4 v0.2.3-2
 	github.com/miekg/dns v1.1.31
 	github.com/mitchellh/go-ps v1.0.0
+	github.com/prometheus/client_golang v1.2.1
 	github.com/rs/zerolog v1.23.0
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5
 	github.com/urfave/cli v1.22.4
+	github.com/vishvananda/netlink v1.1.0
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	golang.org/x/sys v0.0.0-20210510120138-977fb7262007
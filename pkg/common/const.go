@@ -5,20 +5,79 @@ const (
 	ClientTunIP         = "CLIENT_TUN_IP"
 	ServerTunIP         = "SERVER_TUN_IP"
 	TunMaskLength       = "TUN_MASK_LEN"
+	ClientTunIP6        = "CLIENT_TUN_IP6"
+	ServerTunIP6        = "SERVER_TUN_IP6"
+	TunMaskLength6      = "TUN_MASK_LEN6"
 	ControlBy           = "control-by"
 	KubernetesTool      = "kt"
 	ComponentConnect    = "connect"
 	ComponentExchange   = "exchange"
 	ComponentMesh       = "mesh"
 	ComponentProvide    = "provide"
+	ComponentRun        = "run"
 	ConnectMethodVpn    = "vpn"
 	ConnectMethodTun    = "tun"
 	ConnectMethodSocks  = "socks"
 	ConnectMethodSocks5 = "socks5"
+	TransportSsh        = "ssh"
+	TransportAgent      = "agent"
 	PostfixRsaKey       = "_id_rsa"
+	PostfixEd25519Key   = "_id_ed25519"
+	KeyTypeRsa          = "rsa"
+	KeyTypeEd25519      = "ed25519"
+	CachedKeyDir        = "key"
 	YyyyMmDdHhMmSs      = "2006-01-02 15:04:05"
 	SshPort             = 22
 	Socks4Port          = 1080
+	DnsPort             = 53
+	AgentPort           = 2080
+	ShadowUser          = "root"
+	EnvVarDnsPort       = "DNS_PORT"
+	// ConnectMethodForward forward each service port via a loopback ip, without proxy or route
+	ConnectMethodForward = "forward"
+	// EnvVarDnsUpstreams upstream nameservers of shadow dns server, e.g. '10.96.0.10,10.96.0.11:5353'
+	EnvVarDnsUpstreams = "DNS_UPSTREAMS"
+	// EnvVarDnsForwards upstream nameserver of specified domains, e.g. 'corp.example.com=10.0.0.2'
+	EnvVarDnsForwards = "DNS_FORWARDS"
+	// EnvVarDnsOverrides static answers of specified names, e.g. 'tomcat=127.0.0.1,*.example.com=10.0.0.2'
+	EnvVarDnsOverrides = "DNS_OVERRIDES"
+	// EnvVarDnsResolver how shadow dns server resolves cluster names, 'upstream' or 'kubernetes'
+	EnvVarDnsResolver = "DNS_RESOLVER"
+	// EnvVarClusterDomain cluster domain used by kubernetes resolver of shadow
+	EnvVarClusterDomain = "CLUSTER_DOMAIN"
+	// DnsResolverUpstream forward cluster names to cluster dns
+	DnsResolverUpstream = "upstream"
+	// DnsResolverKubernetes answer cluster names from informer caches of shadow
+	DnsResolverKubernetes = "kubernetes"
+	// DefaultClusterDomain default domain of kubernetes cluster
+	DefaultClusterDomain = "cluster.local"
+	// EnvVarLogFormat log format of shadow, 'console' or 'json'
+	EnvVarLogFormat = "LOG_FORMAT"
+	// EnvVarMetricsPort port of shadow metrics endpoint
+	EnvVarMetricsPort = "METRICS_PORT"
+	// MetricsPort default port of shadow metrics endpoint
+	MetricsPort = 9180
+	// EnvVarProbePorts forwarded ports checked by readiness probe of shadow, separate by comma
+	EnvVarProbePorts = "PROBE_PORTS"
+	// ReadyPath path of shadow readiness endpoint, served along with metrics
+	ReadyPath = "/ready"
+	// LogFormatConsole human-readable log
+	LogFormatConsole = "console"
+	// LogFormatJson one json object per line
+	LogFormatJson = "json"
+
+	// RestrictedShadowUser non-root user of restricted shadow
+	RestrictedShadowUser = "kt"
+	// RestrictedShadowUID uid of restricted shadow user
+	RestrictedShadowUID = 1000
+	// RestrictedSshPort sshd port of restricted shadow, non-root user can't listen on 22
+	RestrictedSshPort = 2222
+	// RestrictedDnsPort dns port of restricted shadow, non-root user can't listen on 53
+	RestrictedDnsPort = 10053
+	// PodSecurityEnforce namespace label of pod security admission
+	PodSecurityEnforce = "pod-security.kubernetes.io/enforce"
+	// PodSecurityRestricted the most restrictive pod security level
+	PodSecurityRestricted = "restricted"
 
 	// KTVersion label used for fetch shadow mark in UI
 	KTVersion = "kt-version"
@@ -26,17 +85,25 @@ const (
 	KTComponent = "kt-component"
 	// KTRemoteAddress label used for fetch pod IP in UI
 	KTRemoteAddress = "kt-remote-address"
+	// KTUser label used for mark local user who created the shadow
+	KTUser = "kt-user"
 	// KTName label used for wait shadow pod ready
 	KTName = "kt-name"
 	// KTConfig annotation used for clean up context
 	KTConfig = "kt-config"
 	// KTRefCount the count of shared
 	KTRefCount = "kt-ref-count"
+	// KTExchangedBy label of origin deployment, mark the exchange shadow which scaled it down
+	KTExchangedBy = "kt-exchanged-by"
+	// KTOriginReplicas annotation of origin deployment, replicas before exchanged
+	KTOriginReplicas = "kt-origin-replicas"
 	// KTLastHeartBeat timestamp of last heart beat
 	KTLastHeartBeat = "kt-last-heart-beat"
 
 	// SSHPrivateKeyName ssh private key name
 	SSHPrivateKeyName = "kt_%s" + PostfixRsaKey
+	// SSHEd25519PrivateKeyName ssh ed25519 private key name
+	SSHEd25519PrivateKeyName = "kt_%s" + PostfixEd25519Key
 	// SSHBitSize ssh bit size
 	SSHBitSize = 2048
 	// SSHAuthKey auth key name
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// SetupLogger write human-readable console log, or one json object per line when format is 'json'
+func SetupLogger(format string, noColor bool) error {
+	switch format {
+	case "", LogFormatConsole:
+		log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: noColor}).With().Timestamp().Logger()
+	case LogFormatJson:
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	default:
+		return fmt.Errorf("invalid log format '%s', should be '%s' or '%s'", format, LogFormatConsole, LogFormatJson)
+	}
+	return nil
+}
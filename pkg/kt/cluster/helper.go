@@ -3,6 +3,8 @@ package cluster
 import (
 	"fmt"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -43,7 +45,10 @@ func getPodCidrs(clientset kubernetes.Interface, podCIDR string) (cidrs []string
 	}
 
 	for _, node := range nodeList.Items {
-		if node.Spec.PodCIDR != "" && len(node.Spec.PodCIDR) != 0 {
+		if len(node.Spec.PodCIDRs) > 0 {
+			// dual-stack node has one cidr for each ip family
+			cidrs = append(cidrs, node.Spec.PodCIDRs...)
+		} else if node.Spec.PodCIDR != "" && len(node.Spec.PodCIDR) != 0 {
 			cidrs = append(cidrs, node.Spec.PodCIDR)
 		}
 	}
@@ -72,13 +77,19 @@ func getPodCidrByInstance(clientset kubernetes.Interface) (samples mapset.Set, e
 
 	samples = mapset.NewSet()
 	for _, pod := range podList.Items {
-		if pod.Status.PodIP != "" && pod.Status.PodIP != "None" {
+		if len(pod.Status.PodIPs) > 0 {
+			for _, podIP := range pod.Status.PodIPs {
+				samples.Add(getCidrFromSample(podIP.IP))
+			}
+		} else if pod.Status.PodIP != "" && pod.Status.PodIP != "None" {
 			samples.Add(getCidrFromSample(pod.Status.PodIP))
 		}
 	}
 	return
 }
 
+// getServiceCidr sample service cidr from cluster ip, only the range of primary ip family is found in dual-stack cluster,
+// since 'clusterIPs' of secondary family is not available in api version used
 func getServiceCidr(serviceList []v1.Service) (cidr []string, err error) {
 	samples := mapset.NewSet()
 	for _, service := range serviceList {
@@ -94,6 +105,11 @@ func getServiceCidr(serviceList []v1.Service) (cidr []string, err error) {
 }
 
 func getCidrFromSample(sample string) string {
+	if util.IsIPv6(sample) {
+		// ipv6 sample is treated as a /64 network
+		ipNet := net.IPNet{IP: net.ParseIP(sample).Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+		return ipNet.String()
+	}
 	return strings.Join(append(strings.Split(sample, ".")[:2], []string{"0", "0"}...), ".") + "/16"
 }
 
@@ -195,10 +211,11 @@ func deployment(metaAndSpec *PodMetaAndSpec, volume string, options *options.Dae
 	envs := metaAndSpec.Envs
 	dep := &appV1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        name,
-			Namespace:   namespace,
-			Labels:      labels,
-			Annotations: annotations,
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: metaAndSpec.Meta.OwnerReferences,
 		},
 		Spec: appV1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
@@ -221,13 +238,40 @@ func deployment(metaAndSpec *PodMetaAndSpec, volume string, options *options.Dae
 		},
 	}
 
-	if options.ConnectOptions != nil && options.ConnectOptions.Method == common.ConnectMethodTun {
+	if envs[common.EnvVarProbePorts] != "" {
+		dep.Spec.Template.Spec.Containers[0].ReadinessProbe = readinessProbe(envs[common.EnvVarMetricsPort])
+	}
+
+	if options.Restricted {
+		restrictPodSecurity(dep)
+	} else if options.ConnectOptions != nil && options.ConnectOptions.Method == common.ConnectMethodTun {
 		addTunHostPath(dep)
 	}
 
 	return dep
 }
 
+// readinessProbe shadow is only ready when its forwarded ports reach live local listener,
+// so that service endpoints drop it as soon as local app or ssh tunnel is gone,
+// it's served on metrics port of shadow, which can be overridden by METRICS_PORT env
+func readinessProbe(metricsPort string) *v1.Probe {
+	port, err := strconv.Atoi(metricsPort)
+	if err != nil {
+		port = common.MetricsPort
+	}
+	return &v1.Probe{
+		Handler: v1.Handler{
+			HTTPGet: &v1.HTTPGetAction{
+				Path: common.ReadyPath,
+				Port: intstr.FromInt(port),
+			},
+		},
+		PeriodSeconds:    5,
+		TimeoutSeconds:   3,
+		FailureThreshold: 2,
+	}
+}
+
 func getSSHVolume(volume string) v1.Volume {
 	sshVolume := v1.Volume{
 		Name: "ssh-public-key",
@@ -273,3 +317,70 @@ func addTunHostPath(dep *appV1.Deployment) {
 		}
 	}
 }
+
+// restrictPodSecurity make shadow pod compatible with 'restricted' pod security standard,
+// i.e. run as non-root user, without privilege escalation and any capability
+func restrictPodSecurity(dep *appV1.Deployment) {
+	uid := int64(common.RestrictedShadowUID)
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+	template := &dep.Spec.Template
+	template.Spec.SecurityContext = &v1.PodSecurityContext{
+		RunAsUser:    &uid,
+		RunAsGroup:   &uid,
+		RunAsNonRoot: &runAsNonRoot,
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	// client-go v0.17.2 has no 'seccompProfile' field, so the annotation is used, and api server syncs it to the field
+	template.Annotations[v1.SeccompPodAnnotationKey] = v1.SeccompProfileRuntimeDefault
+
+	for i := range template.Spec.Containers {
+		c := &template.Spec.Containers[i]
+		if c.Name != "standalone" {
+			continue
+		}
+		c.SecurityContext = &v1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Capabilities: &v1.Capabilities{
+				Drop: []v1.Capability{"ALL"},
+			},
+		}
+		c.Env = append(c.Env, v1.EnvVar{Name: common.EnvVarDnsPort, Value: strconv.Itoa(common.RestrictedDnsPort)})
+		for j := range c.VolumeMounts {
+			if c.VolumeMounts[j].Name == "ssh-public-key" {
+				c.VolumeMounts[j].MountPath = fmt.Sprintf("/home/%s/%s", common.RestrictedShadowUser, common.SSHAuthKey)
+			}
+		}
+		break
+	}
+}
+
+// privilegedInboundPort first port below 1024 which shadow of exchange, mesh or provide command listens on, 0 if none,
+// restricted shadow can't bind it, since NET_BIND_SERVICE never takes effect for non-root process with no_new_privs
+func privilegedInboundPort(component string, options *options.DaemonOptions) int {
+	expose := ""
+	switch {
+	case component == common.ComponentExchange && options.ExchangeOptions != nil:
+		expose = options.ExchangeOptions.Expose
+	case component == common.ComponentMesh && options.MeshOptions != nil:
+		expose = options.MeshOptions.Expose
+	case component == common.ComponentProvide && options.ProvideOptions != nil:
+		expose = strconv.Itoa(options.ProvideOptions.Expose)
+	}
+	for _, pair := range strings.Split(expose, ",") {
+		// remote port is the last part of '<local>:<remote>' pair
+		port, err := strconv.Atoi(pair[strings.LastIndex(pair, ":")+1:])
+		if err == nil && port > 0 && port < 1024 {
+			return port
+		}
+	}
+	return 0
+}
+
+// isRestrictedPod check whether shadow pod is running as restricted mode
+func isRestrictedPod(pod *v1.Pod) bool {
+	return pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.RunAsNonRoot != nil &&
+		*pod.Spec.SecurityContext.RunAsNonRoot
+}
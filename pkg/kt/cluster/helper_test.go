@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -38,6 +40,17 @@ func Test_getPodCidrs(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "should_get_dual_stack_pod_cidr_from_nodes",
+			objs: []runtime.Object{
+				buildDualStackNode("default", "a", "172.168.1.0/24", "fd00:10:244:1::/64"),
+			},
+			wantCidrs: []string{
+				"172.168.1.0/24",
+				"fd00:10:244:1::/64",
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -76,6 +89,16 @@ func Test_getServiceCidr(t *testing.T) {
 			wantErr:  false,
 			wantCidr: []string{"173.168.0.0/16"},
 		},
+		{
+			name: "should_get_ipv6_service_crid_by_svc_sample",
+			args: args{
+				[]v1.Service{
+					buildService("default", "name", "fd00:10:96::a"),
+				},
+			},
+			wantErr:  false,
+			wantCidr: []string{"fd00:10:96::/64"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -151,6 +174,16 @@ func buildNode(namespace, name, crid string) *v1.Node {
 	}
 }
 
+func buildDualStackNode(namespace, name string, crids ...string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1.NodeSpec{
+			PodCIDR:  crids[0],
+			PodCIDRs: crids,
+		},
+	}
+}
+
 func buildPod(name, namespace, image string, ip string, labels map[string]string) *v1.Pod {
 	return &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -167,3 +200,59 @@ func buildPod(name, namespace, image string, ip string, labels map[string]string
 		},
 	}
 }
+
+func Test_deploymentReadinessProbe(t *testing.T) {
+	metaAndSpec := func(envs map[string]string) *PodMetaAndSpec {
+		return &PodMetaAndSpec{
+			Meta: &ResourceMeta{
+				Name:        "shadow",
+				Namespace:   "default",
+				Labels:      map[string]string{},
+				Annotations: map[string]string{},
+			},
+			Image: "shadow",
+			Envs:  envs,
+		}
+	}
+	opts := options.NewDaemonOptions()
+
+	dep := deployment(metaAndSpec(map[string]string{}), "sshcm", opts)
+	if dep.Spec.Template.Spec.Containers[0].ReadinessProbe != nil {
+		t.Errorf("shadow without probe ports should have no readiness probe")
+	}
+	dep = deployment(metaAndSpec(map[string]string{common.EnvVarProbePorts: "8080"}), "sshcm", opts)
+	probe := dep.Spec.Template.Spec.Containers[0].ReadinessProbe
+	if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Path != common.ReadyPath ||
+		probe.HTTPGet.Port.IntValue() != common.MetricsPort {
+		t.Errorf("unexpected readiness probe %v", probe)
+	}
+	dep = deployment(metaAndSpec(map[string]string{common.EnvVarProbePorts: "8080", common.EnvVarMetricsPort: "9190"}),
+		"sshcm", opts)
+	probe = dep.Spec.Template.Spec.Containers[0].ReadinessProbe
+	if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Port.IntValue() != 9190 {
+		t.Errorf("readiness probe should follow metrics port env, got %v", probe)
+	}
+}
+
+func Test_privilegedInboundPort(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.ExchangeOptions.Expose = "8080,9090:80"
+	opts.MeshOptions.Expose = "8080:8081"
+	opts.ProvideOptions = &options.ProvideOptions{Expose: 443}
+	tests := []struct {
+		component string
+		want      int
+	}{
+		{common.ComponentExchange, 80},
+		{common.ComponentMesh, 0},
+		{common.ComponentProvide, 443},
+		{common.ComponentConnect, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.component, func(t *testing.T) {
+			if got := privilegedInboundPort(tt.component, opts); got != tt.want {
+				t.Errorf("privilegedInboundPort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
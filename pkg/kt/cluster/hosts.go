@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// wait for more changes before refreshing hosts, as endpoints of a rolling update change several times
+const hostsRefreshDelay = 3 * time.Second
+
+// lookupHost resolve external name via local resolver
+var lookupHost = net.LookupHost
+
+// WatchServiceHosts call onChange when services or endpoints in namespaces changed, until stop closed,
+// the returned channel is closed once watching stopped and no onChange is running
+func (k *Kubernetes) WatchServiceHosts(namespaces []string, onChange func(), stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	}
+	for _, namespace := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(k.Clientset, 0, informers.WithNamespace(namespace))
+		factory.Core().V1().Services().Informer().AddEventHandler(handler)
+		factory.Core().V1().Endpoints().Informer().AddEventHandler(handler)
+		factory.Start(stop)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-changed:
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(hostsRefreshDelay):
+			}
+			// changes during the delay are covered by this refresh
+			select {
+			case <-changed:
+			default:
+			}
+			onChange()
+		}
+	}()
+	return done
+}
+
+// endpointsOf get endpoints in namespace by name
+func (k *Kubernetes) endpointsOf(namespace string) map[string]v1.Endpoints {
+	endpoints := map[string]v1.Endpoints{}
+	list, err := k.Clientset.CoreV1().Endpoints(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		log.Debug().Msgf("Failed to list endpoints in %s: %s", namespace, err)
+		return endpoints
+	}
+	for _, item := range list.Items {
+		endpoints[item.Name] = item
+	}
+	return endpoints
+}
+
+// externalNameIP resolve target of external name service, in-cluster target is resolved to its cluster ip
+func (k *Kubernetes) externalNameIP(target string) string {
+	labels := strings.Split(strings.TrimSuffix(target, "."), ".")
+	if len(labels) >= 3 && labels[2] == "svc" {
+		svc, err := k.Clientset.CoreV1().Services(labels[1]).Get(labels[0], metav1.GetOptions{})
+		if err == nil && svc.Spec.ClusterIP != v1.ClusterIPNone {
+			return svc.Spec.ClusterIP
+		}
+	}
+	addresses, err := lookupHost(target)
+	if err != nil || len(addresses) == 0 {
+		log.Debug().Msgf("Failed to resolve external name %s: %v", target, err)
+		return ""
+	}
+	return addresses[0]
+}
+
+// headlessHosts map headless service to its first endpoint, and each endpoint to '<hostname>.<service>',
+// hostname of endpoint defaults to its dashed ip, e.g. '10-1-0-5'
+func headlessHosts(service v1.Service, endpoints v1.Endpoints) map[string]string {
+	hosts := map[string]string{}
+	for _, subset := range endpoints.Subsets {
+		addresses := subset.Addresses
+		if service.Spec.PublishNotReadyAddresses {
+			addresses = append(append([]v1.EndpointAddress{}, subset.Addresses...), subset.NotReadyAddresses...)
+		}
+		for _, address := range addresses {
+			if _, exists := hosts[service.Name]; !exists {
+				hosts[service.Name] = address.IP
+			}
+			hostname := address.Hostname
+			if hostname == "" {
+				hostname = strings.NewReplacer(".", "-", ":", "-").Replace(address.IP)
+			}
+			hosts[hostname+"."+service.Name] = address.IP
+		}
+	}
+	return hosts
+}
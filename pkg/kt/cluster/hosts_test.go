@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetes_ServiceHosts(t *testing.T) {
+	original := lookupHost
+	defer func() { lookupHost = original }()
+	lookupHost = func(host string) ([]string, error) {
+		if host == "db.example.com" {
+			return []string{"203.0.113.5"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	k := &Kubernetes{Clientset: testclient.NewSimpleClientset(
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{ClusterIP: "10.96.0.10"},
+		},
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "kafka", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{ClusterIP: coreV1.ClusterIPNone},
+		},
+		&coreV1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "kafka", Namespace: "default"},
+			Subsets: []coreV1.EndpointSubset{{
+				Addresses:         []coreV1.EndpointAddress{{IP: "10.1.0.5", Hostname: "kafka-0"}, {IP: "10.1.0.6"}},
+				NotReadyAddresses: []coreV1.EndpointAddress{{IP: "10.1.0.7", Hostname: "kafka-2"}},
+			}},
+		},
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{Type: coreV1.ServiceTypeExternalName, ExternalName: "db.example.com"},
+		},
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "alias", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{Type: coreV1.ServiceTypeExternalName, ExternalName: "web.default.svc.cluster.local"},
+		},
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{Type: coreV1.ServiceTypeExternalName, ExternalName: "unknown.example.com"},
+		},
+	)}
+	want := map[string]string{
+		"web":            "10.96.0.10",
+		"kafka":          "10.1.0.5",
+		"kafka-0.kafka":  "10.1.0.5",
+		"10-1-0-6.kafka": "10.1.0.6",
+		"db":             "203.0.113.5",
+		"alias":          "10.96.0.10",
+		"unknown":        "",
+	}
+	if got := k.ServiceHosts("default"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServiceHosts() = %v, want %v", got, want)
+	}
+}
+
+func Test_headlessHosts(t *testing.T) {
+	service := coreV1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "zk"},
+		Spec:       coreV1.ServiceSpec{ClusterIP: coreV1.ClusterIPNone, PublishNotReadyAddresses: true},
+	}
+	endpoints := coreV1.Endpoints{Subsets: []coreV1.EndpointSubset{{
+		NotReadyAddresses: []coreV1.EndpointAddress{{IP: "10.1.0.8", Hostname: "zk-0"}},
+	}}}
+	want := map[string]string{"zk": "10.1.0.8", "zk-0.zk": "10.1.0.8"}
+	if got := headlessHosts(service, endpoints); !reflect.DeepEqual(got, want) {
+		t.Errorf("headlessHosts() = %v, want %v", got, want)
+	}
+	if got := headlessHosts(service, coreV1.Endpoints{}); len(got) != 0 {
+		t.Errorf("headlessHosts() without endpoints = %v, want empty", got)
+	}
+}
+
+func TestKubernetes_WatchServiceHosts(t *testing.T) {
+	clientset := testclient.NewSimpleClientset()
+	k := &Kubernetes{Clientset: clientset}
+	changed := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	done := k.WatchServiceHosts([]string{"default"}, func() { changed <- struct{}{} }, stop)
+
+	endpoints := &coreV1.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: "kafka", Namespace: "default"}}
+	if _, err := clientset.CoreV1().Endpoints("default").Create(endpoints); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(hostsRefreshDelay + 5*time.Second):
+		t.Fatal("onChange not called after endpoints created")
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done not closed after stopped")
+	}
+}
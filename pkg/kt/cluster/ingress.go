@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	coreV1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// served versions of ingress, the first one available is used
+	ingressResources = []schema.GroupVersionResource{
+		{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"},
+		{Group: "extensions", Version: "v1beta1", Resource: "ingresses"},
+	}
+	// served versions of gateway api http route
+	httpRouteResources = []schema.GroupVersionResource{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+		{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "httproutes"},
+		{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Resource: "httproutes"},
+	}
+	// served versions of gateway api gateway
+	gatewayResources = []schema.GroupVersionResource{
+		{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"},
+		{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "gateways"},
+		{Group: "gateway.networking.k8s.io", Version: "v1alpha2", Resource: "gateways"},
+	}
+)
+
+// IngressHosts get hosts of ingresses and http routes in namespace, mapped to cluster ip of ingress controller service.
+// controller is '<namespace>/<name>' of the controller service, or detected from addresses in ingress and gateway status if empty
+func (k *Kubernetes) IngressHosts(namespace, controller string) (hosts map[string]string) {
+	hosts = map[string]string{}
+	if k.Dynamic == nil {
+		return
+	}
+	controllerIP := k.controllerResolver(controller)
+	for _, ingress := range listServedResource(k.Dynamic, ingressResources, namespace) {
+		ip := controllerIP(loadBalancerAddresses(ingress.Object))
+		if ip == "" {
+			log.Debug().Msgf("Ingress controller of %s/%s not found", namespace, ingress.GetName())
+			continue
+		}
+		for _, host := range ingressRuleHosts(ingress.Object) {
+			hosts[host] = ip
+		}
+	}
+	for _, route := range listServedResource(k.Dynamic, httpRouteResources, namespace) {
+		ip := controllerIP(k.parentGatewayAddresses(route))
+		if ip == "" {
+			log.Debug().Msgf("Gateway of http route %s/%s not found", namespace, route.GetName())
+			continue
+		}
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+		for _, host := range hostnames {
+			hosts[host] = ip
+		}
+	}
+	return
+}
+
+// controllerResolver get function to find cluster ip of controller service by addresses it exposed
+func (k *Kubernetes) controllerResolver(controller string) func(addresses []string) string {
+	if controller != "" {
+		ip := ""
+		namespace, name := "default", controller
+		if parts := strings.SplitN(controller, "/", 2); len(parts) == 2 {
+			namespace, name = parts[0], parts[1]
+		}
+		if svc, err := k.Clientset.CoreV1().Services(namespace).Get(name, metav1.GetOptions{}); err == nil {
+			ip = svc.Spec.ClusterIP
+		} else {
+			log.Warn().Msgf("Failed to get ingress controller service %s: %s", controller, err)
+		}
+		return func([]string) string {
+			return ip
+		}
+	}
+	var services []coreV1.Service
+	loaded := false
+	return func(addresses []string) string {
+		if len(addresses) == 0 {
+			return ""
+		}
+		if !loaded {
+			loaded = true
+			list, err := k.Clientset.CoreV1().Services("").List(metav1.ListOptions{})
+			if err != nil {
+				log.Debug().Msgf("Failed to list services to detect ingress controller: %s", err)
+				return ""
+			}
+			services = list.Items
+		}
+		for _, svc := range services {
+			if svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != coreV1.ClusterIPNone && exposesAny(svc, addresses) {
+				return svc.Spec.ClusterIP
+			}
+		}
+		return ""
+	}
+}
+
+// parentGatewayAddresses get status addresses of gateways which http route attached to
+func (k *Kubernetes) parentGatewayAddresses(route unstructured.Unstructured) (addresses []string) {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	for _, parent := range parents {
+		ref, ok := parent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if kind, exists := ref["kind"]; exists && kind != "Gateway" {
+			continue
+		}
+		name, _ := ref["name"].(string)
+		namespace, _ := ref["namespace"].(string)
+		if namespace == "" {
+			namespace = route.GetNamespace()
+		}
+		for _, gvr := range gatewayResources {
+			gateway, err := k.Dynamic.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			statusAddresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+			for _, address := range statusAddresses {
+				if value, ok := address.(map[string]interface{})["value"].(string); ok {
+					addresses = append(addresses, value)
+				}
+			}
+			break
+		}
+	}
+	return
+}
+
+// listServedResource list objects of the first served version of resource
+func listServedResource(client dynamic.Interface, resources []schema.GroupVersionResource, namespace string) []unstructured.Unstructured {
+	for _, gvr := range resources {
+		list, err := client.Resource(gvr).Namespace(namespace).List(metav1.ListOptions{})
+		if err == nil {
+			return list.Items
+		}
+		if !k8sErrors.IsNotFound(err) {
+			log.Debug().Msgf("Failed to list %s in %s: %s", gvr.String(), namespace, err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ingressRuleHosts hosts in rules and tls of ingress
+func ingressRuleHosts(ingress map[string]interface{}) (hosts []string) {
+	rules, _, _ := unstructured.NestedSlice(ingress, "spec", "rules")
+	for _, rule := range rules {
+		if host, ok := rule.(map[string]interface{})["host"].(string); ok && host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	tls, _, _ := unstructured.NestedSlice(ingress, "spec", "tls")
+	for _, item := range tls {
+		tlsHosts, _, _ := unstructured.NestedStringSlice(item.(map[string]interface{}), "hosts")
+		hosts = append(hosts, tlsHosts...)
+	}
+	return
+}
+
+// loadBalancerAddresses ip and hostname in load balancer status of ingress
+func loadBalancerAddresses(ingress map[string]interface{}) (addresses []string) {
+	items, _, _ := unstructured.NestedSlice(ingress, "status", "loadBalancer", "ingress")
+	for _, item := range items {
+		for _, key := range []string{"ip", "hostname"} {
+			if value, ok := item.(map[string]interface{})[key].(string); ok && value != "" {
+				addresses = append(addresses, value)
+			}
+		}
+	}
+	return
+}
+
+// exposesAny check whether service exposed at any of the addresses
+func exposesAny(svc coreV1.Service, addresses []string) bool {
+	exposed := append([]string{svc.Spec.ClusterIP}, svc.Spec.ExternalIPs...)
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		exposed = append(exposed, ingress.IP, ingress.Hostname)
+	}
+	for _, e := range exposed {
+		for _, address := range addresses {
+			if e != "" && e == address {
+				return true
+			}
+		}
+	}
+	return false
+}
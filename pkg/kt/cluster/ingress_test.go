@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func ingressTestObjects() (*testclient.Clientset, *dynamicFake.FakeDynamicClient) {
+	clientset := testclient.NewSimpleClientset(
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "ingress-nginx-controller", Namespace: "ingress-nginx"},
+			Spec:       coreV1.ServiceSpec{ClusterIP: "10.96.0.100", Type: coreV1.ServiceTypeLoadBalancer},
+			Status: coreV1.ServiceStatus{LoadBalancer: coreV1.LoadBalancerStatus{
+				Ingress: []coreV1.LoadBalancerIngress{{IP: "192.168.1.10"}}}},
+		},
+		&coreV1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "envoy", Namespace: "gateway"},
+			Spec:       coreV1.ServiceSpec{ClusterIP: "10.96.0.200"},
+		},
+	)
+	objects := []runtime.Object{
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "orders", "namespace": "default"},
+			"spec": map[string]interface{}{
+				"rules": []interface{}{map[string]interface{}{"host": "orders.internal.corp"}, map[string]interface{}{}},
+				"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"secure.internal.corp"}}},
+			},
+			"status": map[string]interface{}{"loadBalancer": map[string]interface{}{
+				"ingress": []interface{}{map[string]interface{}{"ip": "192.168.1.10"}}}},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata":   map[string]interface{}{"name": "pending", "namespace": "default"},
+			"spec": map[string]interface{}{
+				"rules": []interface{}{map[string]interface{}{"host": "pending.internal.corp"}},
+			},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "HTTPRoute",
+			"metadata":   map[string]interface{}{"name": "payment", "namespace": "default"},
+			"spec": map[string]interface{}{
+				"hostnames":  []interface{}{"payment.internal.corp"},
+				"parentRefs": []interface{}{map[string]interface{}{"name": "gw", "namespace": "gateway"}},
+			},
+		}},
+	}
+	dynamic := dynamicFake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	// created with explicit resource, as fake tracker guesses plural of 'Gateway' as 'gatewaies'
+	_, _ = dynamic.Resource(gatewayResources[0]).Namespace("gateway").Create(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "gw", "namespace": "gateway"},
+		"status": map[string]interface{}{
+			"addresses": []interface{}{map[string]interface{}{"type": "IPAddress", "value": "10.96.0.200"}}},
+	}}, metav1.CreateOptions{})
+	return clientset, dynamic
+}
+
+func TestKubernetes_IngressHosts(t *testing.T) {
+	clientset, dynamic := ingressTestObjects()
+	k := &Kubernetes{Clientset: clientset, Dynamic: dynamic}
+
+	hosts := k.IngressHosts("default", "")
+	want := map[string]string{
+		"orders.internal.corp":  "10.96.0.100",
+		"secure.internal.corp":  "10.96.0.100",
+		"payment.internal.corp": "10.96.0.200",
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("IngressHosts() = %v, want %v", hosts, want)
+	}
+
+	hosts = k.IngressHosts("default", "ingress-nginx/ingress-nginx-controller")
+	want = map[string]string{
+		"orders.internal.corp":  "10.96.0.100",
+		"secure.internal.corp":  "10.96.0.100",
+		"pending.internal.corp": "10.96.0.100",
+		"payment.internal.corp": "10.96.0.100",
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("IngressHosts() with controller = %v, want %v", hosts, want)
+	}
+
+	if hosts = (&Kubernetes{Clientset: clientset}).IngressHosts("default", ""); len(hosts) != 0 {
+		t.Errorf("IngressHosts() without dynamic client should be empty, got %v", hosts)
+	}
+}
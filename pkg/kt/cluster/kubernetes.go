@@ -6,6 +6,7 @@ import (
 	"github.com/alibaba/kt-connect/pkg/common"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 
@@ -17,8 +18,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sLabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
 // PodMetaAndSpec ...
@@ -34,6 +37,8 @@ type ResourceMeta struct {
 	Namespace   string
 	Labels      map[string]string
 	Annotations map[string]string
+	// OwnerReferences session lease owns the resources
+	OwnerReferences []metav1.OwnerReference
 }
 
 // SSHkeyMeta ...
@@ -103,14 +108,34 @@ func (k *Kubernetes) GetOrCreateShadow(name string, options *options.DaemonOptio
 	identifier := strings.ToLower(util.RandomString(4))
 	sshcm = fmt.Sprintf("kt-%s-public-key-%s", component, identifier)
 
-	privateKeyPath := util.PrivateKeyPath(component, identifier)
+	privateKeyPath := util.PrivateKeyPath(component, identifier, options.KeyType)
+
+	if !options.Restricted && k.isRestrictedNamespace(options.Namespace) {
+		log.Info().Msgf("Namespace %s enforces restricted pod security, use restricted shadow", options.Namespace)
+		options.Restricted = true
+	}
+	if options.Restricted && options.ConnectOptions != nil && options.ConnectOptions.Method == common.ConnectMethodTun {
+		err = fmt.Errorf("'%s' method requires privileged shadow, which is not allowed in restricted mode", common.ConnectMethodTun)
+		return
+	}
+	if port := privilegedInboundPort(component, options); options.Restricted && port > 0 {
+		err = fmt.Errorf("port %d is below 1024, which non-root shadow can't listen on in restricted mode", port)
+		return
+	}
+
+	lease, err := k.getOrCreateSessionLease(component, options)
+	if err != nil {
+		return
+	}
+	owners := SessionOwnerReferences(lease)
 
 	if options.ConnectOptions != nil && options.ConnectOptions.ShareShadow {
 		pod, generator, err2 := k.tryGetExistingShadowRelatedObjs(&ResourceMeta{
-			Name:        name,
-			Namespace:   options.Namespace,
-			Labels:      labels,
-			Annotations: annotations,
+			Name:            name,
+			Namespace:       options.Namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: owners,
 		}, &SSHkeyMeta{
 			Sshcm:          sshcm,
 			PrivateKeyPath: privateKeyPath,
@@ -120,6 +145,7 @@ func (k *Kubernetes) GetOrCreateShadow(name string, options *options.DaemonOptio
 			return
 		}
 		if pod != nil && generator != nil {
+			options.Restricted = isRestrictedPod(pod)
 			podIP, podName, credential = shadowResult(*pod, generator)
 			return
 		}
@@ -127,10 +153,11 @@ func (k *Kubernetes) GetOrCreateShadow(name string, options *options.DaemonOptio
 
 	podIP, podName, credential, err = k.createShadow(&PodMetaAndSpec{
 		&ResourceMeta{
-			Name:        name,
-			Namespace:   options.Namespace,
-			Labels:      labels,
-			Annotations: annotations,
+			Name:            name,
+			Namespace:       options.Namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: owners,
 		}, options.Image, envs,
 	}, &SSHkeyMeta{
 		Sshcm:          sshcm,
@@ -142,11 +169,18 @@ func (k *Kubernetes) GetOrCreateShadow(name string, options *options.DaemonOptio
 func (k *Kubernetes) createShadow(metaAndSpec *PodMetaAndSpec, sshKeyMeta *SSHkeyMeta, options *options.DaemonOptions) (
 	podIP string, podName string, credential *util.SSHCredential, err error) {
 
-	generator, err := util.Generate(sshKeyMeta.PrivateKeyPath)
+	var generator *util.SSHGenerator
+	if options.CacheKey {
+		generator, err = util.CachedKey(sshKeyMeta.PrivateKeyPath, options.KeyType, time.Duration(options.KeyRotation)*24*time.Hour)
+	} else {
+		generator, err = util.GenerateKey(sshKeyMeta.PrivateKeyPath, options.KeyType)
+	}
 	if err != nil {
 		return
 	}
-	configMap, err2 := k.createConfigMap(metaAndSpec.Meta.Labels, sshKeyMeta.Sshcm, metaAndSpec.Meta.Namespace, generator)
+	// only key pair is cached, config map is still created per session so that it's removed along with its shadow
+	configMap, err2 := k.createConfigMap(metaAndSpec.Meta.Labels, sshKeyMeta.Sshcm, metaAndSpec.Meta.Namespace,
+		metaAndSpec.Meta.OwnerReferences, generator)
 
 	if err2 != nil {
 		err = err2
@@ -208,7 +242,7 @@ func (k *Kubernetes) getShadowPod(resourceMeta *ResourceMeta, generator *util.SS
 	}
 	if len(podList.Items) == 1 {
 		log.Info().Msgf("Found shared shadow, reuse it")
-		err = increaseRefCount(resourceMeta.Name, k.Clientset, resourceMeta.Namespace)
+		err = increaseRefCount(resourceMeta.Name, k.Clientset, resourceMeta.Namespace, resourceMeta.OwnerReferences)
 		if err != nil {
 			return
 		}
@@ -222,22 +256,31 @@ func (k *Kubernetes) getShadowPod(resourceMeta *ResourceMeta, generator *util.SS
 	return
 }
 
-func increaseRefCount(name string, clientSet kubernetes.Interface, namespace string) error {
-	deployment, err := clientSet.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
-	annotations := deployment.ObjectMeta.Annotations
-	count, err := strconv.Atoi(annotations[common.KTRefCount])
-	if err != nil {
-		log.Error().Msgf("Failed to parse annotations[common.KTRefCount] of deployment %s with value %s", name, annotations[common.KTRefCount])
-		return err
-	}
-
-	deployment.ObjectMeta.Annotations[common.KTRefCount] = strconv.Itoa(count + 1)
+// increaseRefCount add lease of current session to owners of shared shadow, retried on conflict with concurrent sessions
+func increaseRefCount(name string, clientSet kubernetes.Interface, namespace string, owners []metav1.OwnerReference) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := clientSet.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.DeletionTimestamp != nil {
+			return fmt.Errorf("shared shadow %s is being deleted, please retry later", name)
+		}
+		liveOwners, count, err := sharedShadowRefs(clientSet, deployment, "")
+		if err != nil {
+			log.Error().Msgf("Failed to count refs of shared shadow %s: %s", name, err)
+			return err
+		}
 
-	_, err = clientSet.AppsV1().Deployments(namespace).Update(deployment)
-	return err
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[common.KTRefCount] = strconv.Itoa(count + 1)
+		// shared shadow is kept until leases of all sessions using it are gone
+		deployment.OwnerReferences = append(liveOwners, owners...)
+		_, err = clientSet.AppsV1().Deployments(namespace).Update(deployment)
+		return err
+	})
 }
 
 func shadowResult(pod v1.Pod, generator *util.SSHGenerator) (string, string, *util.SSHCredential) {
@@ -245,41 +288,70 @@ func shadowResult(pod v1.Pod, generator *util.SSHGenerator) (string, string, *ut
 	podName := pod.GetObjectMeta().GetName()
 	credential := util.NewDefaultSSHCredential()
 	credential.PrivateKeyPath = generator.PrivateKeyPath
+	if isRestrictedPod(&pod) {
+		credential.RemoteUser = common.RestrictedShadowUser
+	}
 	return podIP, podName, credential
 }
 
+// isRestrictedNamespace check whether namespace enforces 'restricted' pod security admission
+func (k *Kubernetes) isRestrictedNamespace(namespace string) bool {
+	ns, err := k.Clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		log.Debug().Msgf("Unable to read labels of namespace %s: %s", namespace, err)
+		return false
+	}
+	return ns.Labels[common.PodSecurityEnforce] == common.PodSecurityRestricted
+}
+
 func (k *Kubernetes) createAndGetPod(metaAndSpec *PodMetaAndSpec, sshcm string, options *options.DaemonOptions) (pod v1.Pod, err error) {
 	localIPAddress := util.GetOutboundIP()
 	log.Debug().Msgf("Client address %s", localIPAddress)
 	resourceMeta := metaAndSpec.Meta
-	resourceMeta.Labels[common.KTRemoteAddress] = localIPAddress
+	resourceMeta.Labels[common.KTRemoteAddress] = util.IPToLabelValue(localIPAddress)
+	if user := util.ToLabelValue(util.GetLocalUserName()); user != "" {
+		resourceMeta.Labels[common.KTUser] = user
+	}
 	resourceMeta.Labels[common.KTName] = resourceMeta.Name
-	cli := k.Clientset.AppsV1().Deployments(resourceMeta.Namespace)
-	util.SetupDeploymentHeartBeat(cli, resourceMeta.Name)
-
 	deployment := deployment(metaAndSpec, sshcm, options)
+	if err = applyPodOverlay(deployment, options); err != nil {
+		return
+	}
+
+	cli := k.Clientset.AppsV1().Deployments(resourceMeta.Namespace)
 	result, err := cli.Create(deployment)
 	if err != nil {
 		return
 	}
 	log.Info().Msgf("Deploy shadow deployment %s in namespace %s", result.GetObjectMeta().GetName(), resourceMeta.Namespace)
+	if len(resourceMeta.OwnerReferences) == 0 {
+		// no session lease, config map and service owned by the deployment are kept alive along with it
+		util.SetupResourceHeartBeat("deployment", resourceMeta.Name, func(data []byte) error {
+			_, err := cli.Patch(resourceMeta.Name, types.JSONPatchType, data)
+			return err
+		})
+	}
+	if err = k.addConfigMapOwner(sshcm, resourceMeta.Namespace, DeploymentOwnerReference(result)); err != nil {
+		log.Warn().Msgf("Failed to set owner of config map %s: %s", sshcm, err)
+	}
 
 	return waitPodReadyUsingInformer(resourceMeta.Namespace, resourceMeta.Name, k.Clientset)
 }
 
-func (k *Kubernetes) createConfigMap(labels map[string]string, sshcm string, namespace string, generator *util.SSHGenerator) (configMap *v1.ConfigMap, err error) {
+func (k *Kubernetes) createConfigMap(labels map[string]string, sshcm string, namespace string,
+	owners []metav1.OwnerReference, generator *util.SSHGenerator) (configMap *v1.ConfigMap, err error) {
 
 	annotations := map[string]string{common.KTLastHeartBeat: util.GetTimestamp()}
 	labels[common.KTName] = sshcm
 	cli := k.Clientset.CoreV1().ConfigMaps(namespace)
-	util.SetupConfigMapHeartBeat(cli, sshcm)
 
 	return cli.Create(&v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        sshcm,
-			Namespace:   namespace,
-			Labels:      labels,
-			Annotations: annotations,
+			Name:            sshcm,
+			Namespace:       namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: owners,
 		},
 		Data: map[string]string{
 			common.SSHAuthKey:        string(generator.PublicKey),
@@ -288,11 +360,40 @@ func (k *Kubernetes) createConfigMap(labels map[string]string, sshcm string, nam
 	})
 }
 
-// CreateService create kubernetes service
-func (k *Kubernetes) CreateService(name, namespace string, external bool, port int, labels map[string]string) (*v1.Service, error) {
+// addConfigMapOwner let config map be deleted together with its owner
+func (k *Kubernetes) addConfigMapOwner(name, namespace string, owner metav1.OwnerReference) error {
+	cli := k.Clientset.CoreV1().ConfigMaps(namespace)
+	configMap, err := cli.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	configMap.OwnerReferences = append(configMap.OwnerReferences, owner)
+	_, err = cli.Update(configMap)
+	return err
+}
+
+// DeploymentOwnerReference owner reference pointing to deployment
+func DeploymentOwnerReference(deployment *appv1.Deployment) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: appv1.SchemeGroupVersion.String(),
+		Kind:       "Deployment",
+		Name:       deployment.Name,
+		UID:        deployment.UID,
+	}
+}
+
+// CreateService create kubernetes service, owned by specified shadow deployment if not empty
+func (k *Kubernetes) CreateService(name, namespace string, external bool, port int, labels map[string]string,
+	shadow string) (*v1.Service, error) {
 	cli := k.Clientset.CoreV1().Services(namespace)
-	util.SetupServiceHeartBeat(cli, name)
 	svc := service(name, namespace, labels, external, port)
+	if shadow != "" {
+		owner, err := k.GetDeployment(shadow, namespace)
+		if err != nil {
+			return nil, err
+		}
+		svc.OwnerReferences = []metav1.OwnerReference{DeploymentOwnerReference(owner)}
+	}
 	return cli.Create(svc)
 }
 
@@ -325,15 +426,39 @@ func (k *Kubernetes) ClusterCidrs(namespace string, connectOptions *options.Conn
 	return
 }
 
-// ServiceHosts get service dns map
+// GetServices get all services in namespace
+func (k *Kubernetes) GetServices(namespace string) ([]v1.Service, error) {
+	services, err := k.Clientset.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return services.Items, nil
+}
+
+// ServiceHosts get service dns map, headless service is mapped to its first endpoint with an extra
+// '<hostname>.<service>' entry for each endpoint, and external name service is mapped to ip of its target
+// cluster ip service is mapped to its primary family address only
 func (k *Kubernetes) ServiceHosts(namespace string) (hosts map[string]string) {
 	services, err := k.Clientset.CoreV1().Services(namespace).List(metav1.ListOptions{})
 	if err != nil {
 		return
 	}
 	hosts = map[string]string{}
+	var endpoints map[string]v1.Endpoints
 	for _, service := range services.Items {
-		hosts[service.ObjectMeta.Name] = service.Spec.ClusterIP
+		switch {
+		case service.Spec.Type == v1.ServiceTypeExternalName:
+			hosts[service.ObjectMeta.Name] = k.externalNameIP(service.Spec.ExternalName)
+		case service.Spec.ClusterIP == v1.ClusterIPNone:
+			if endpoints == nil {
+				endpoints = k.endpointsOf(namespace)
+			}
+			for host, ip := range headlessHosts(service, endpoints[service.Name]) {
+				hosts[host] = ip
+			}
+		default:
+			hosts[service.ObjectMeta.Name] = service.Spec.ClusterIP
+		}
 	}
 	return
 }
@@ -396,51 +521,42 @@ func (k *Kubernetes) UpdateDeployment(namespace string, deployment *appv1.Deploy
 	return k.Clientset.AppsV1().Deployments(namespace).Update(deployment)
 }
 
-// DecreaseRef ...
-func (k *Kubernetes) DecreaseRef(namespace string, app string) (cleanup bool, err error) {
-	deployment, err := k.GetDeployment(app, namespace)
-	if err != nil {
-		return
-	}
-	cleanup, err = decreaseOrRemove(k, deployment)
-	return
-}
-
-func decreaseOrRemove(k *Kubernetes, deployment *appv1.Deployment) (cleanup bool, err error) {
-	refCount := deployment.ObjectMeta.Annotations[common.KTRefCount]
-	if refCount == "1" {
-		cleanup = true
-		log.Info().Msgf("Shared shadow has only one ref, delete it")
-		err = k.RemoveDeployment(deployment.GetObjectMeta().GetName(), deployment.GetObjectMeta().GetNamespace())
-		if err != nil {
-			return
-		}
-	} else {
-		err2 := decreaseDeploymentRef(refCount, k, deployment)
+// DecreaseRef remove lease of the session from owners of shared shadow, the shadow is deleted if no live session left,
+// retried on conflict with concurrent sessions
+func (k *Kubernetes) DecreaseRef(namespace, app, lease string) (cleanup bool, err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err2 := k.GetDeployment(app, namespace)
 		if err2 != nil {
-			err = err2
-			return
+			return err2
 		}
-	}
+		cleanup, err2 = decreaseOrRemove(k, deployment, lease)
+		return err2
+	})
 	return
 }
 
-func decreaseDeploymentRef(refCount string, k *Kubernetes, deployment *appv1.Deployment) (err error) {
-	log.Info().Msgf("Shared shadow has more than one ref, decrease the ref")
-	count, err := decreaseRef(refCount)
+func decreaseOrRemove(k *Kubernetes, deployment *appv1.Deployment, lease string) (cleanup bool, err error) {
+	owners, count, err := sharedShadowRefs(k.Clientset, deployment, lease)
 	if err != nil {
 		return
 	}
-	deployment.ObjectMeta.Annotations[common.KTRefCount] = count
-	_, err = k.UpdateDeployment(deployment.GetObjectMeta().GetNamespace(), deployment)
-	return
-}
-
-func decreaseRef(refCount string) (count string, err error) {
-	currentCount, err := strconv.Atoi(refCount)
-	if err != nil {
+	if count <= 0 {
+		cleanup = true
+		log.Info().Msgf("Shared shadow has no other ref, delete it")
+		// deletion fails with conflict if another session joined after the deployment was read
+		deletePolicy := metav1.DeletePropagationBackground
+		err = k.Clientset.AppsV1().Deployments(deployment.Namespace).Delete(deployment.Name, &metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+			Preconditions:     &metav1.Preconditions{ResourceVersion: &deployment.ResourceVersion},
+		})
 		return
 	}
-	count = strconv.Itoa(currentCount - 1)
+	log.Info().Msgf("Shared shadow still has %d refs, decrease the ref", count)
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[common.KTRefCount] = strconv.Itoa(count)
+	deployment.OwnerReferences = owners
+	_, err = k.UpdateDeployment(deployment.Namespace, deployment)
 	return
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
 	appv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	testclient "k8s.io/client-go/kubernetes/fake"
@@ -88,6 +89,60 @@ func TestKubernetes_CreateShadow(t *testing.T) {
 	}
 }
 
+func TestKubernetes_CreateRestrictedShadow(t *testing.T) {
+	namespace := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "restricted",
+			Labels: map[string]string{common.PodSecurityEnforce: common.PodSecurityRestricted},
+		},
+	}
+	pod := buildPod("shadow-pod", "restricted", "a", "172.168.1.2", map[string]string{"kt-name": "shadow"})
+	k := &Kubernetes{
+		Clientset: testclient.NewSimpleClientset(namespace, pod),
+	}
+
+	labels := map[string]string{common.KTComponent: "shadow-component"}
+	option := options.NewDaemonOptions()
+	option.Namespace = "restricted"
+	option.ConnectOptions.Method = common.ConnectMethodTun
+	if _, _, _, _, err := k.GetOrCreateShadow("shadow", option, labels, map[string]string{}, map[string]string{}); err == nil {
+		t.Errorf("Kubernetes.GetOrCreateShadow() should fail with tun method in restricted namespace")
+	}
+
+	option.ConnectOptions.Method = common.ConnectMethodVpn
+	option.ExchangeOptions.Expose = "8080:80"
+	exchangeLabels := map[string]string{common.KTComponent: common.ComponentExchange}
+	if _, _, _, _, err := k.GetOrCreateShadow("shadow", option, exchangeLabels, map[string]string{}, map[string]string{}); err == nil {
+		t.Errorf("Kubernetes.GetOrCreateShadow() should fail with remote port below 1024 in restricted namespace")
+	}
+
+	if _, _, _, _, err := k.GetOrCreateShadow("shadow", option, labels, map[string]string{}, map[string]string{}); err != nil {
+		t.Errorf("Kubernetes.GetOrCreateShadow() error = %v", err)
+		return
+	}
+	if !option.Restricted {
+		t.Errorf("restricted mode should be enabled in restricted namespace")
+	}
+	dep, err := k.GetDeployment("shadow", "restricted")
+	if err != nil {
+		t.Errorf("failed to get shadow deployment: %v", err)
+		return
+	}
+	spec := dep.Spec.Template.Spec
+	if spec.SecurityContext == nil || !*spec.SecurityContext.RunAsNonRoot {
+		t.Errorf("shadow pod should run as non-root")
+	}
+	container := spec.Containers[0]
+	if *container.SecurityContext.AllowPrivilegeEscalation || len(container.SecurityContext.Capabilities.Add) > 0 {
+		t.Errorf("shadow container should not have privilege, got %v", container.SecurityContext)
+	}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			t.Errorf("shadow pod should not mount host path %s", volume.HostPath.Path)
+		}
+	}
+}
+
 func TestKubernetes_ClusterCidrs(t *testing.T) {
 	type args struct {
 		podCIDR string
@@ -168,7 +223,7 @@ func TestKubernetes_CreateService(t *testing.T) {
 			k := &Kubernetes{
 				Clientset: testclient.NewSimpleClientset(),
 			}
-			_, err := k.CreateService(tt.args.name, tt.args.namespace, false, tt.args.port, tt.args.labels)
+			_, err := k.CreateService(tt.args.name, tt.args.namespace, false, tt.args.port, tt.args.labels, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Kubernetes.CreateService() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -218,3 +273,33 @@ func TestKubernetes_ScaleTo(t *testing.T) {
 		})
 	}
 }
+
+func TestKubernetes_CreateServiceOwnedByShadow(t *testing.T) {
+	shadow := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "shadow", Namespace: "default", UID: "shadow-uid"},
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "shadow-public-key", Namespace: "default"},
+	}
+	k := &Kubernetes{Clientset: testclient.NewSimpleClientset(shadow, configMap)}
+
+	svc, err := k.CreateService("svc", "default", false, 8080, map[string]string{"kt": "svc"}, "shadow")
+	if err != nil {
+		t.Fatalf("Kubernetes.CreateService() error = %v", err)
+	}
+	expected := []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "shadow", UID: "shadow-uid"}}
+	if !reflect.DeepEqual(svc.OwnerReferences, expected) {
+		t.Errorf("service owner = %v, want %v", svc.OwnerReferences, expected)
+	}
+	if _, err = k.CreateService("svc2", "default", false, 8080, map[string]string{"kt": "svc2"}, "absent"); err == nil {
+		t.Errorf("service owned by absent shadow should not be created")
+	}
+
+	if err = k.addConfigMapOwner("shadow-public-key", "default", DeploymentOwnerReference(shadow)); err != nil {
+		t.Fatalf("Kubernetes.addConfigMapOwner() error = %v", err)
+	}
+	updated, _ := k.Clientset.CoreV1().ConfigMaps("default").Get("shadow-public-key", metav1.GetOptions{})
+	if !reflect.DeepEqual(updated.OwnerReferences, expected) {
+		t.Errorf("config map owner = %v, want %v", updated.OwnerReferences, expected)
+	}
+}
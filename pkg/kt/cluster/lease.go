@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	opt "github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog/log"
+	appV1 "k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sLabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// getOrCreateSessionLease create lease of current session and keep renewing it,
+// resources created in the session are owned by the lease. Nil lease is returned if current user is not allowed
+// to create leases, then resources fall back to heartbeat annotation
+func (k *Kubernetes) getOrCreateSessionLease(component string, options *opt.DaemonOptions) (*coordinationV1.Lease, error) {
+	if options.RuntimeOptions == nil {
+		options.RuntimeOptions = &opt.RuntimeOptions{}
+	}
+	if options.RuntimeOptions.Lease != nil || options.RuntimeOptions.LeaseForbidden {
+		return options.RuntimeOptions.Lease, nil
+	}
+	name := fmt.Sprintf("kt-session-%s-%s", component, strings.ToLower(util.RandomString(5)))
+	duration := int32(util.ResourceHeartBeatIntervalMinus * 3 * 60)
+	now := metav1.NewMicroTime(time.Now())
+	holder := util.GetLocalUserName()
+	if hostname, err := os.Hostname(); err == nil {
+		holder = holder + "@" + hostname
+	}
+	// same user and address labels as shadow, so that 'ktctl clean --user' only removes leases of the user
+	labels := map[string]string{
+		common.ControlBy:       common.KubernetesTool,
+		common.KTComponent:     component,
+		common.KTRemoteAddress: util.IPToLabelValue(util.GetOutboundIP()),
+	}
+	if user := util.ToLabelValue(util.GetLocalUserName()); user != "" {
+		labels[common.KTUser] = user
+	}
+	client := k.Clientset.CoordinationV1().Leases(options.Namespace)
+	lease, err := client.Create(&coordinationV1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: options.Namespace,
+			Labels:    labels,
+		},
+		Spec: coordinationV1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+	if k8sErrors.IsForbidden(err) {
+		log.Warn().Msgf("Not allowed to create leases in namespace %s, fall back to heartbeat annotations, "+
+			"grant 'create, get, list, update, delete' on 'leases' of api group 'coordination.k8s.io' to own "+
+			"session resources by lease", options.Namespace)
+		options.RuntimeOptions.LeaseForbidden = true
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create session lease %s: %s", name, err)
+	}
+	log.Info().Msgf("Created session lease %s", name)
+	util.SetupLeaseHeartBeat(client, name)
+	options.RuntimeOptions.Lease = lease
+	return lease, nil
+}
+
+// SessionOwnerReferences owner reference pointing to session lease
+func SessionOwnerReferences(lease *coordinationV1.Lease) []metav1.OwnerReference {
+	if lease == nil {
+		return nil
+	}
+	return []metav1.OwnerReference{{
+		APIVersion: coordinationV1.SchemeGroupVersion.String(),
+		Kind:       "Lease",
+		Name:       lease.Name,
+		UID:        lease.UID,
+	}}
+}
+
+// IsLeaseExpired check whether lease not renewed within threshold
+func IsLeaseExpired(lease *coordinationV1.Lease, threshold time.Duration) bool {
+	if lease.Spec.RenewTime == nil {
+		return true
+	}
+	return time.Since(lease.Spec.RenewTime.Time) > threshold
+}
+
+// GetSessionLeases fetch all session leases
+func (k *Kubernetes) GetSessionLeases(namespace string) ([]coordinationV1.Lease, error) {
+	list, err := k.Clientset.CoordinationV1().Leases(namespace).List(metav1.ListOptions{
+		LabelSelector: k8sLabels.Set(map[string]string{common.ControlBy: common.KubernetesTool}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// RemoveLease remove lease, resources owned by it are deleted by garbage collector
+func (k *Kubernetes) RemoveLease(name, namespace string) error {
+	deletePolicy := metav1.DeletePropagationBackground
+	return k.Clientset.CoordinationV1().Leases(namespace).Delete(name, &metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	})
+}
+
+// sharedShadowRefs owner references and count of sessions still using a shared shadow, except the excluded lease,
+// session whose lease is gone or not renewed in time is treated as crashed and dropped from owners,
+// shadow created by old version without lease owner falls back to the ref count annotation
+func sharedShadowRefs(clientSet kubernetes.Interface, deployment *appV1.Deployment, exclude string) (
+	owners []metav1.OwnerReference, count int, err error) {
+	threshold := time.Duration(util.ResourceHeartBeatIntervalMinus*3) * time.Minute
+	leaseOwned := false
+	for _, owner := range deployment.OwnerReferences {
+		if owner.Kind != "Lease" {
+			owners = append(owners, owner)
+			continue
+		}
+		leaseOwned = true
+		if owner.Name == exclude {
+			continue
+		}
+		lease, err2 := clientSet.CoordinationV1().Leases(deployment.Namespace).Get(owner.Name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err2) || (err2 == nil && IsLeaseExpired(lease, threshold)) {
+			log.Info().Msgf("Session %s of shared shadow %s is gone, client may crashed", owner.Name, deployment.Name)
+			continue
+		} else if err2 != nil {
+			return nil, 0, err2
+		}
+		owners = append(owners, owner)
+		count++
+	}
+	if !leaseOwned {
+		count, err = strconv.Atoi(deployment.Annotations[common.KTRefCount])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid %s annotation '%s' of deployment %s", common.KTRefCount,
+				deployment.Annotations[common.KTRefCount], deployment.Name)
+		}
+		if exclude != "" {
+			count--
+		}
+	}
+	return owners, count, nil
+}
@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	appV1 "k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetes_getOrCreateSessionLease(t *testing.T) {
+	k := &Kubernetes{Clientset: testclient.NewSimpleClientset()}
+	opts := options.NewDaemonOptions()
+	opts.Namespace = "default"
+
+	lease, err := k.getOrCreateSessionLease(common.ComponentConnect, opts)
+	if err != nil {
+		t.Fatalf("getOrCreateSessionLease() error = %v", err)
+	}
+	if opts.RuntimeOptions.Lease != lease || lease.Labels[common.KTComponent] != common.ComponentConnect {
+		t.Errorf("unexpected lease %v", lease)
+	}
+	again, _ := k.getOrCreateSessionLease(common.ComponentConnect, opts)
+	if again != lease {
+		t.Errorf("lease of session should be reused")
+	}
+	leases, err := k.GetSessionLeases("default")
+	if err != nil || len(leases) != 1 {
+		t.Errorf("expected 1 lease, got %v, error %v", leases, err)
+	}
+
+	owners := SessionOwnerReferences(lease)
+	if len(owners) != 1 || owners[0].Kind != "Lease" || owners[0].Name != lease.Name ||
+		owners[0].APIVersion != "coordination.k8s.io/v1" {
+		t.Errorf("unexpected owner references %v", owners)
+	}
+	if SessionOwnerReferences(nil) != nil {
+		t.Errorf("owner references of nil lease should be nil")
+	}
+
+	if err = k.RemoveLease(lease.Name, "default"); err != nil {
+		t.Errorf("RemoveLease() error = %v", err)
+	}
+}
+
+func TestKubernetes_getOrCreateSessionLeaseForbidden(t *testing.T) {
+	client := testclient.NewSimpleClientset()
+	client.PrependReactor("create", "leases", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(coordinationV1.Resource("leases"), "", errors.New("no rbac rule"))
+	})
+	k := &Kubernetes{Clientset: client}
+	opts := options.NewDaemonOptions()
+	opts.Namespace = "default"
+
+	lease, err := k.getOrCreateSessionLease(common.ComponentConnect, opts)
+	if err != nil || lease != nil || !opts.RuntimeOptions.LeaseForbidden {
+		t.Fatalf("should fall back to heartbeat annotation, got lease %v, error %v", lease, err)
+	}
+	if _, _ = k.getOrCreateSessionLease(common.ComponentConnect, opts); len(client.Actions()) != 1 {
+		t.Errorf("lease should not be created again after forbidden, actions %v", client.Actions())
+	}
+}
+
+func TestIsLeaseExpired(t *testing.T) {
+	renewed := metav1.NewMicroTime(time.Now().Add(-10 * time.Minute))
+	lease := &coordinationV1.Lease{Spec: coordinationV1.LeaseSpec{RenewTime: &renewed}}
+	if IsLeaseExpired(lease, 15*time.Minute) {
+		t.Errorf("lease renewed 10 minutes ago should not expire in 15 minutes")
+	}
+	if !IsLeaseExpired(lease, 5*time.Minute) {
+		t.Errorf("lease renewed 10 minutes ago should expire in 5 minutes")
+	}
+	if !IsLeaseExpired(&coordinationV1.Lease{}, 5*time.Minute) {
+		t.Errorf("lease never renewed should expire")
+	}
+}
+
+func TestKubernetes_sharedShadowRefCount(t *testing.T) {
+	renewed := metav1.NewMicroTime(time.Now())
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	leaseOf := func(name string, renewTime *metav1.MicroTime) *coordinationV1.Lease {
+		return &coordinationV1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       coordinationV1.LeaseSpec{RenewTime: renewTime},
+		}
+	}
+	ownerOf := func(name string) metav1.OwnerReference {
+		return metav1.OwnerReference{APIVersion: "coordination.k8s.io/v1", Kind: "Lease", Name: name}
+	}
+	client := testclient.NewSimpleClientset(
+		leaseOf("lease-a", &renewed),
+		leaseOf("lease-b", &expired),
+		leaseOf("lease-d", &renewed),
+		&appV1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:            "shadow",
+			Namespace:       "default",
+			Annotations:     map[string]string{common.KTRefCount: "3"},
+			OwnerReferences: []metav1.OwnerReference{ownerOf("lease-a"), ownerOf("lease-b"), ownerOf("lease-c")},
+		}},
+	)
+	conflicts := 0
+	client.PrependReactor("update", "deployments", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, k8sErrors.NewConflict(appV1.Resource("deployments"), "shadow", errors.New("changed"))
+		}
+		return false, nil, nil
+	})
+	k := &Kubernetes{Clientset: client}
+
+	if err := increaseRefCount("shadow", client, "default", []metav1.OwnerReference{ownerOf("lease-d")}); err != nil {
+		t.Fatalf("increaseRefCount() error = %v", err)
+	}
+	deployment, _ := k.GetDeployment("shadow", "default")
+	expected := []metav1.OwnerReference{ownerOf("lease-a"), ownerOf("lease-d")}
+	if !reflect.DeepEqual(deployment.OwnerReferences, expected) || deployment.Annotations[common.KTRefCount] != "2" {
+		t.Errorf("crashed sessions should be dropped after retry, got owners %v, count %s",
+			deployment.OwnerReferences, deployment.Annotations[common.KTRefCount])
+	}
+
+	cleanup, err := k.DecreaseRef("default", "shadow", "lease-d")
+	if err != nil || cleanup {
+		t.Fatalf("shadow should be kept for live session, cleanup %v, error %v", cleanup, err)
+	}
+	deployment, _ = k.GetDeployment("shadow", "default")
+	if len(deployment.OwnerReferences) != 1 || deployment.Annotations[common.KTRefCount] != "1" {
+		t.Errorf("lease of session should be removed, got owners %v, count %s",
+			deployment.OwnerReferences, deployment.Annotations[common.KTRefCount])
+	}
+
+	_ = k.RemoveLease("lease-a", "default")
+	cleanup, err = k.DecreaseRef("default", "shadow", "lease-e")
+	if err != nil || !cleanup {
+		t.Fatalf("shadow should be deleted after last live session gone, cleanup %v, error %v", cleanup, err)
+	}
+	if _, err = k.GetDeployment("shadow", "default"); !k8sErrors.IsNotFound(err) {
+		t.Errorf("shadow should be deleted, but got error %v", err)
+	}
+}
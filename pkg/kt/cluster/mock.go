@@ -11,7 +11,8 @@ import (
 	util "github.com/alibaba/kt-connect/pkg/kt/util"
 	gomock "github.com/golang/mock/gomock"
 	v1 "k8s.io/api/apps/v1"
-	v10 "k8s.io/api/core/v1"
+	v10 "k8s.io/api/coordination/v1"
+	v11 "k8s.io/api/core/v1"
 )
 
 // MockKubernetesInterface is a mock of KubernetesInterface interface.
@@ -53,33 +54,33 @@ func (mr *MockKubernetesInterfaceMockRecorder) ClusterCidrs(namespace, connectOp
 }
 
 // CreateService mocks base method.
-func (m *MockKubernetesInterface) CreateService(name, namespace string, external bool, port int, labels map[string]string) (*v10.Service, error) {
+func (m *MockKubernetesInterface) CreateService(name, namespace string, external bool, port int, labels map[string]string, shadow string) (*v11.Service, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateService", name, namespace, external, port, labels)
-	ret0, _ := ret[0].(*v10.Service)
+	ret := m.ctrl.Call(m, "CreateService", name, namespace, external, port, labels, shadow)
+	ret0, _ := ret[0].(*v11.Service)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateService indicates an expected call of CreateService.
-func (mr *MockKubernetesInterfaceMockRecorder) CreateService(name, namespace, external, port, labels interface{}) *gomock.Call {
+func (mr *MockKubernetesInterfaceMockRecorder) CreateService(name, namespace, external, port, labels, shadow interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateService", reflect.TypeOf((*MockKubernetesInterface)(nil).CreateService), name, namespace, external, port, labels)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateService", reflect.TypeOf((*MockKubernetesInterface)(nil).CreateService), name, namespace, external, port, labels, shadow)
 }
 
 // DecreaseRef mocks base method.
-func (m *MockKubernetesInterface) DecreaseRef(namespace, deployment string) (bool, error) {
+func (m *MockKubernetesInterface) DecreaseRef(namespace, deployment, lease string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DecreaseRef", namespace, deployment)
+	ret := m.ctrl.Call(m, "DecreaseRef", namespace, deployment, lease)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // DecreaseRef indicates an expected call of DecreaseRef.
-func (mr *MockKubernetesInterfaceMockRecorder) DecreaseRef(namespace, deployment interface{}) *gomock.Call {
+func (mr *MockKubernetesInterfaceMockRecorder) DecreaseRef(namespace, deployment, lease interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecreaseRef", reflect.TypeOf((*MockKubernetesInterface)(nil).DecreaseRef), namespace, deployment)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecreaseRef", reflect.TypeOf((*MockKubernetesInterface)(nil).DecreaseRef), namespace, deployment, lease)
 }
 
 // Deployment mocks base method.
@@ -127,6 +128,21 @@ func (mr *MockKubernetesInterfaceMockRecorder) GetDeployment(name, namespace int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeployment", reflect.TypeOf((*MockKubernetesInterface)(nil).GetDeployment), name, namespace)
 }
 
+// GetExchangedDeployments mocks base method.
+func (m *MockKubernetesInterface) GetExchangedDeployments(namespace string) ([]v1.Deployment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExchangedDeployments", namespace)
+	ret0, _ := ret[0].([]v1.Deployment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExchangedDeployments indicates an expected call of GetExchangedDeployments.
+func (mr *MockKubernetesInterfaceMockRecorder) GetExchangedDeployments(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExchangedDeployments", reflect.TypeOf((*MockKubernetesInterface)(nil).GetExchangedDeployments), namespace)
+}
+
 // GetOrCreateShadow mocks base method.
 func (m *MockKubernetesInterface) GetOrCreateShadow(name string, options *options.DaemonOptions, labels, annotations, envs map[string]string) (string, string, string, *util.SSHCredential, error) {
 	m.ctrl.T.Helper()
@@ -145,6 +161,64 @@ func (mr *MockKubernetesInterfaceMockRecorder) GetOrCreateShadow(name, options,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrCreateShadow", reflect.TypeOf((*MockKubernetesInterface)(nil).GetOrCreateShadow), name, options, labels, annotations, envs)
 }
 
+// GetServices mocks base method.
+func (m *MockKubernetesInterface) GetServices(namespace string) ([]v11.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServices", namespace)
+	ret0, _ := ret[0].([]v11.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServices indicates an expected call of GetServices.
+func (mr *MockKubernetesInterfaceMockRecorder) GetServices(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServices", reflect.TypeOf((*MockKubernetesInterface)(nil).GetServices), namespace)
+}
+
+// GetSessionLeases mocks base method.
+func (m *MockKubernetesInterface) GetSessionLeases(namespace string) ([]v10.Lease, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessionLeases", namespace)
+	ret0, _ := ret[0].([]v10.Lease)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessionLeases indicates an expected call of GetSessionLeases.
+func (mr *MockKubernetesInterfaceMockRecorder) GetSessionLeases(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessionLeases", reflect.TypeOf((*MockKubernetesInterface)(nil).GetSessionLeases), namespace)
+}
+
+// IngressHosts mocks base method.
+func (m *MockKubernetesInterface) IngressHosts(namespace, controller string) map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IngressHosts", namespace, controller)
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// IngressHosts indicates an expected call of IngressHosts.
+func (mr *MockKubernetesInterfaceMockRecorder) IngressHosts(namespace, controller interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IngressHosts", reflect.TypeOf((*MockKubernetesInterface)(nil).IngressHosts), namespace, controller)
+}
+
+// Recover mocks base method.
+func (m *MockKubernetesInterface) Recover(name, namespace string, replicas int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Recover", name, namespace, replicas)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Recover indicates an expected call of Recover.
+func (mr *MockKubernetesInterfaceMockRecorder) Recover(name, namespace, replicas interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Recover", reflect.TypeOf((*MockKubernetesInterface)(nil).Recover), name, namespace, replicas)
+}
+
 // RemoveConfigMap mocks base method.
 func (m *MockKubernetesInterface) RemoveConfigMap(name, namespace string) error {
 	m.ctrl.T.Helper()
@@ -173,6 +247,34 @@ func (mr *MockKubernetesInterfaceMockRecorder) RemoveDeployment(name, namespace
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDeployment", reflect.TypeOf((*MockKubernetesInterface)(nil).RemoveDeployment), name, namespace)
 }
 
+// RemoveDestinationRuleSubset mocks base method.
+func (m *MockKubernetesInterface) RemoveDestinationRuleSubset(subset, namespace string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveDestinationRuleSubset", subset, namespace)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveDestinationRuleSubset indicates an expected call of RemoveDestinationRuleSubset.
+func (mr *MockKubernetesInterfaceMockRecorder) RemoveDestinationRuleSubset(subset, namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDestinationRuleSubset", reflect.TypeOf((*MockKubernetesInterface)(nil).RemoveDestinationRuleSubset), subset, namespace)
+}
+
+// RemoveLease mocks base method.
+func (m *MockKubernetesInterface) RemoveLease(name, namespace string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveLease", name, namespace)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveLease indicates an expected call of RemoveLease.
+func (mr *MockKubernetesInterfaceMockRecorder) RemoveLease(name, namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveLease", reflect.TypeOf((*MockKubernetesInterface)(nil).RemoveLease), name, namespace)
+}
+
 // RemoveService mocks base method.
 func (m *MockKubernetesInterface) RemoveService(name, namespace string) error {
 	m.ctrl.T.Helper()
@@ -243,3 +345,17 @@ func (mr *MockKubernetesInterfaceMockRecorder) UpdateDeployment(namespace, deplo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeployment", reflect.TypeOf((*MockKubernetesInterface)(nil).UpdateDeployment), namespace, deployment)
 }
+
+// WatchServiceHosts mocks base method.
+func (m *MockKubernetesInterface) WatchServiceHosts(namespaces []string, onChange func(), stop <-chan struct{}) <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WatchServiceHosts", namespaces, onChange, stop)
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// WatchServiceHosts indicates an expected call of WatchServiceHosts.
+func (mr *MockKubernetesInterfaceMockRecorder) WatchServiceHosts(namespaces, onChange, stop interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchServiceHosts", reflect.TypeOf((*MockKubernetesInterface)(nil).WatchServiceHosts), namespaces, onChange, stop)
+}
@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog/log"
+	appV1 "k8s.io/api/apps/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sLabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// ShadowConfig resources mutated by a shadow, stored as json in 'kt-config' annotation for cleanup
+type ShadowConfig struct {
+	// Origin deployment scaled down by exchange, or meshed by mesh
+	Origin string `json:"origin,omitempty"`
+	// Replicas of origin deployment before exchanged
+	Replicas int32 `json:"replicas,omitempty"`
+	// Service created by provide
+	Service string `json:"service,omitempty"`
+	// Subset version subset of istio destination rules used by mesh
+	Subset string `json:"subset,omitempty"`
+}
+
+// Annotation encode config to annotation value
+func (c *ShadowConfig) Annotation() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// ParseShadowConfig decode 'kt-config' annotation, legacy 'app=xx,replicas=n' and 'service=xx' format is also supported
+func ParseShadowConfig(annotation string) *ShadowConfig {
+	config := &ShadowConfig{}
+	if strings.HasPrefix(annotation, "{") {
+		if err := json.Unmarshal([]byte(annotation), config); err != nil {
+			log.Warn().Msgf("Invalid shadow config '%s': %s", annotation, err)
+		}
+		return config
+	}
+	legacy := util.String2Map(annotation)
+	replicas, _ := strconv.ParseInt(legacy["replicas"], 10, 32)
+	config.Origin = legacy["app"]
+	config.Replicas = int32(replicas)
+	config.Service = legacy["service"]
+	return config
+}
+
+// MarkExchanged record exchange shadow and origin replicas on deployment, in case shadow lost before recovered
+func MarkExchanged(deployment *appV1.Deployment, shadow string) {
+	if deployment.Labels == nil {
+		deployment.Labels = map[string]string{}
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	deployment.Labels[common.KTExchangedBy] = shadow
+	deployment.Annotations[common.KTOriginReplicas] = strconv.Itoa(int(replicas))
+}
+
+// GetExchangedDeployments get deployments scaled down by exchange shadows
+func (k *Kubernetes) GetExchangedDeployments(namespace string) ([]appV1.Deployment, error) {
+	requirement, err := k8sLabels.NewRequirement(common.KTExchangedBy, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	list, err := k.Clientset.AppsV1().Deployments(namespace).List(metav1.ListOptions{
+		LabelSelector: k8sLabels.NewSelector().Add(*requirement).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Recover scale exchanged deployment back and remove the exchange mark, deployment already recovered is skipped
+func (k *Kubernetes) Recover(name, namespace string, replicas int32) error {
+	deployment, err := k.Deployment(name, namespace)
+	if err != nil {
+		return err
+	}
+	_, marked := deployment.Labels[common.KTExchangedBy]
+	if !marked && deployment.Spec.Replicas != nil && *deployment.Spec.Replicas > 0 {
+		log.Debug().Msgf("Deployment %s already recovered", name)
+		return nil
+	}
+	delete(deployment.Labels, common.KTExchangedBy)
+	delete(deployment.Annotations, common.KTOriginReplicas)
+	return k.Scale(deployment, &replicas)
+}
+
+// RemoveDestinationRuleSubset remove subset of specified version from all istio destination rules in namespace
+func (k *Kubernetes) RemoveDestinationRuleSubset(subset, namespace string) error {
+	if k.Istio == nil {
+		log.Debug().Msgf("Istio client not available, skip removing subset %s", subset)
+		return nil
+	}
+	client := k.Istio.NetworkingV1alpha3().DestinationRules(namespace)
+	rules, err := client.List(metav1.ListOptions{})
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			// istio not installed
+			return nil
+		}
+		return err
+	}
+	for i := range rules.Items {
+		rule := &rules.Items[i]
+		found := false
+		for j, s := range rule.Spec.Subsets {
+			if s.Name == subset {
+				rule.Spec.Subsets = append(rule.Spec.Subsets[:j], rule.Spec.Subsets[j+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		log.Info().Msgf("Removing subset %s from destination rule %s", subset, rule.Name)
+		if _, err = client.Update(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	networking "istio.io/api/networking/v1alpha3"
+	istioV1alpha3 "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	istioFake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseShadowConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       *ShadowConfig
+	}{
+		{
+			name:       "shouldParseJsonConfig",
+			annotation: (&ShadowConfig{Origin: "app", Subset: "v1"}).Annotation(),
+			want:       &ShadowConfig{Origin: "app", Subset: "v1"},
+		},
+		{
+			name:       "shouldParseLegacyExchangeConfig",
+			annotation: "app=app,replicas=2",
+			want:       &ShadowConfig{Origin: "app", Replicas: 2},
+		},
+		{
+			name:       "shouldParseLegacyProvideConfig",
+			annotation: "service=svc",
+			want:       &ShadowConfig{Service: "svc"},
+		},
+		{
+			name:       "shouldParseEmptyConfig",
+			annotation: "",
+			want:       &ShadowConfig{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseShadowConfig(tt.annotation); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseShadowConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubernetes_Recover(t *testing.T) {
+	var replicas int32 = 3
+	app := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       appv1.DeploymentSpec{Replicas: &replicas},
+	}
+	MarkExchanged(app, "app-kt-abcde")
+	var down int32 = 0
+	app.Spec.Replicas = &down
+	k := &Kubernetes{Clientset: testclient.NewSimpleClientset(app)}
+
+	exchanged, err := k.GetExchangedDeployments("default")
+	if err != nil || len(exchanged) != 1 || exchanged[0].Annotations[common.KTOriginReplicas] != "3" {
+		t.Fatalf("exchanged deployment not found, got %v, error %v", exchanged, err)
+	}
+	if err = k.Recover("app", "default", 3); err != nil {
+		t.Fatalf("Kubernetes.Recover() error = %v", err)
+	}
+	recovered, _ := k.Deployment("app", "default")
+	if *recovered.Spec.Replicas != 3 || recovered.Labels[common.KTExchangedBy] != "" {
+		t.Errorf("deployment not recovered, got %v", recovered)
+	}
+	exchanged, _ = k.GetExchangedDeployments("default")
+	if len(exchanged) != 0 {
+		t.Errorf("exchange mark not removed")
+	}
+}
+
+func TestKubernetes_RemoveDestinationRuleSubset(t *testing.T) {
+	rule := &istioV1alpha3.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: networking.DestinationRule{
+			Host:    "app",
+			Subsets: []*networking.Subset{{Name: "v1"}, {Name: "abcde"}},
+		},
+	}
+	istio := istioFake.NewSimpleClientset(rule)
+	k := &Kubernetes{Clientset: testclient.NewSimpleClientset(), Istio: istio}
+	for i := 0; i < 2; i++ {
+		if err := k.RemoveDestinationRuleSubset("abcde", "default"); err != nil {
+			t.Fatalf("Kubernetes.RemoveDestinationRuleSubset() error = %v", err)
+		}
+	}
+	updated, _ := istio.NetworkingV1alpha3().DestinationRules("default").Get("app", metav1.GetOptions{})
+	if len(updated.Spec.Subsets) != 1 || updated.Spec.Subsets[0].Name != "v1" {
+		t.Errorf("subset not removed, got %v", updated.Spec.Subsets)
+	}
+}
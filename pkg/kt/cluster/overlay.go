@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	appV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// applyPodOverlay apply user customized spec to shadow pod template
+func applyPodOverlay(dep *appV1.Deployment, options *options.DaemonOptions) error {
+	template := &dep.Spec.Template
+	if options.NodeSelector != "" {
+		template.Spec.NodeSelector = util.String2Map(options.NodeSelector)
+	}
+	if options.PodAnnotations != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		for k, v := range util.String2Map(options.PodAnnotations) {
+			template.Annotations[k] = v
+		}
+	}
+	if options.ImagePullSecrets != "" {
+		for _, secret := range strings.Split(options.ImagePullSecrets, ",") {
+			template.Spec.ImagePullSecrets = append(template.Spec.ImagePullSecrets, v1.LocalObjectReference{Name: secret})
+		}
+	}
+	if options.PriorityClass != "" {
+		template.Spec.PriorityClassName = options.PriorityClass
+	}
+	if options.Resources != "" {
+		requirements, err := parseResources(options.Resources)
+		if err != nil {
+			return err
+		}
+		template.Spec.Containers[0].Resources = requirements
+	}
+	if options.PodPatch != "" {
+		patched, err := patchPodTemplate(template, options.PodPatch)
+		if err != nil {
+			return err
+		}
+		dep.Spec.Template = *patched
+	}
+	return nil
+}
+
+// parseResources parse 'requests.cpu=100m,limits.memory=128Mi' to resource requirements
+func parseResources(str string) (requirements v1.ResourceRequirements, err error) {
+	for key, value := range util.String2Map(str) {
+		parts := strings.SplitN(key, ".", 2)
+		if len(parts) != 2 {
+			return requirements, fmt.Errorf("invalid resource '%s', should be like 'requests.cpu'", key)
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return requirements, fmt.Errorf("invalid quantity '%s' of resource %s: %s", value, key, err)
+		}
+		switch parts[0] {
+		case "requests":
+			if requirements.Requests == nil {
+				requirements.Requests = v1.ResourceList{}
+			}
+			requirements.Requests[v1.ResourceName(parts[1])] = quantity
+		case "limits":
+			if requirements.Limits == nil {
+				requirements.Limits = v1.ResourceList{}
+			}
+			requirements.Limits[v1.ResourceName(parts[1])] = quantity
+		default:
+			return requirements, fmt.Errorf("invalid resource '%s', should start with 'requests' or 'limits'", key)
+		}
+	}
+	return
+}
+
+// patchPodTemplate apply strategic-merge patch file to pod template
+func patchPodTemplate(template *v1.PodTemplateSpec, patchFile string) (*v1.PodTemplateSpec, error) {
+	content, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := yaml.ToJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod patch file %s: %s", patchFile, err)
+	}
+	original, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, v1.PodTemplateSpec{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply pod patch %s: %s", patchFile, err)
+	}
+	patched := &v1.PodTemplateSpec{}
+	if err = json.Unmarshal(merged, patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
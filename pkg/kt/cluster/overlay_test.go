@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+)
+
+func Test_applyPodOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kt-overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	patchFile := filepath.Join(dir, "patch.yaml")
+	patch := `
+spec:
+  tolerations:
+  - key: dedicated
+    operator: Equal
+    value: dev
+    effect: NoSchedule
+  containers:
+  - name: standalone
+    resources:
+      limits:
+        cpu: 200m
+`
+	if err = ioutil.WriteFile(patchFile, []byte(patch), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewDaemonOptions()
+	opts.NodeSelector = "pool=dev"
+	opts.PodAnnotations = "sidecar.istio.io/inject=false"
+	opts.Resources = "requests.cpu=100m,requests.memory=64Mi"
+	opts.ImagePullSecrets = "regcred"
+	opts.PodPatch = patchFile
+	dep := deployment(&PodMetaAndSpec{
+		Meta: &ResourceMeta{
+			Name:        "shadow",
+			Namespace:   "default",
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Image: "shadow",
+	}, "sshcm", opts)
+
+	if err = applyPodOverlay(dep, opts); err != nil {
+		t.Fatalf("applyPodOverlay() error = %v", err)
+	}
+	spec := dep.Spec.Template.Spec
+	if spec.NodeSelector["pool"] != "dev" {
+		t.Errorf("node selector not applied: %v", spec.NodeSelector)
+	}
+	if dep.Spec.Template.Annotations["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("annotations not applied: %v", dep.Spec.Template.Annotations)
+	}
+	if len(spec.ImagePullSecrets) != 1 || spec.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("image pull secrets not applied: %v", spec.ImagePullSecrets)
+	}
+	if len(spec.Tolerations) != 1 || spec.Tolerations[0].Key != "dedicated" {
+		t.Errorf("tolerations not applied: %v", spec.Tolerations)
+	}
+	if len(spec.Containers) != 1 || len(spec.Containers[0].VolumeMounts) != 1 {
+		t.Errorf("container should be merged by name: %v", spec.Containers)
+	}
+	resources := spec.Containers[0].Resources
+	if resources.Requests.Cpu().String() != "100m" || resources.Limits.Cpu().String() != "200m" {
+		t.Errorf("resources not applied: %v", resources)
+	}
+}
+
+func Test_parseResources(t *testing.T) {
+	if _, err := parseResources("request.cpu=100m"); err == nil {
+		t.Errorf("parseResources() should fail with invalid resource type")
+	}
+	if _, err := parseResources("limits.cpu=abc"); err == nil {
+		t.Errorf("parseResources() should fail with invalid quantity")
+	}
+}
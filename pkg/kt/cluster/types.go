@@ -3,9 +3,13 @@ package cluster
 import (
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
+	versionedclient "istio.io/client-go/pkg/clientset/versioned"
 	appV1 "k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
 	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 // CreateFromClientSet kubernetes instance
@@ -15,6 +19,24 @@ func CreateFromClientSet(clientSet kubernetes.Interface) (kubernetes KubernetesI
 	}, nil
 }
 
+// CreateFromClientSetAndConfig kubernetes instance which can also operate istio and other custom resources
+func CreateFromClientSetAndConfig(clientSet kubernetes.Interface, config *rest.Config) (KubernetesInterface, error) {
+	k := &Kubernetes{
+		Clientset: clientSet,
+	}
+	if config != nil {
+		istio, err := versionedclient.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		k.Istio = istio
+		if k.Dynamic, err = dynamic.NewForConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
 // KubernetesInterface kubernetes interface
 type KubernetesInterface interface {
 	RemoveDeployment(name, namespace string) (err error)
@@ -23,18 +45,30 @@ type KubernetesInterface interface {
 	Deployment(name, namespace string) (deployment *appV1.Deployment, err error)
 	Scale(deployment *appV1.Deployment, replicas *int32) (err error)
 	ScaleTo(deployment, namespace string, replicas *int32) (err error)
+	GetServices(namespace string) ([]coreV1.Service, error)
 	ServiceHosts(namespace string) (hosts map[string]string)
+	WatchServiceHosts(namespaces []string, onChange func(), stop <-chan struct{}) <-chan struct{}
+	IngressHosts(namespace, controller string) (hosts map[string]string)
 	ClusterCidrs(namespace string, connectOptions *options.ConnectOptions) (cidrs []string, err error)
 	GetOrCreateShadow(name string, options *options.DaemonOptions, labels, annotations, envs map[string]string) (podIP, podName, sshcm string, credential *util.SSHCredential, err error)
 	GetAllExistingShadowDeployments(namespace string) (list []appV1.Deployment, err error)
-	CreateService(name, namespace string, external bool, port int, labels map[string]string) (*coreV1.Service, error)
+	CreateService(name, namespace string, external bool, port int, labels map[string]string, shadow string) (*coreV1.Service, error)
 	GetDeployment(name string, namespace string) (*appV1.Deployment, error)
 	UpdateDeployment(namespace string, deployment *appV1.Deployment) (*appV1.Deployment, error)
-	DecreaseRef(namespace string, deployment string) (cleanup bool, err error)
+	DecreaseRef(namespace, deployment, lease string) (cleanup bool, err error)
+	GetExchangedDeployments(namespace string) ([]appV1.Deployment, error)
+	Recover(name, namespace string, replicas int32) error
+	RemoveDestinationRuleSubset(subset, namespace string) error
+	GetSessionLeases(namespace string) ([]coordinationV1.Lease, error)
+	RemoveLease(name, namespace string) error
 }
 
 // Kubernetes implements KubernetesInterface
 type Kubernetes struct {
 	KubeConfig string
 	Clientset  kubernetes.Interface
+	// Istio client of istio resources, nil if not available
+	Istio versionedclient.Interface
+	// Dynamic client of resources without typed client, e.g. ingress and gateway api, nil if not available
+	Dynamic dynamic.Interface
 }
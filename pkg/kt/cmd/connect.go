@@ -2,14 +2,14 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt"
 	"github.com/alibaba/kt-connect/pkg/kt/command"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
@@ -29,7 +29,7 @@ var (
 
 func init() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	_ = common.SetupLogger(common.LogFormatConsole, util.IsWindows())
 }
 
 // NewConnectCommand ...
@@ -55,12 +55,13 @@ func NewConnectCommand(streams genericclioptions.IOStreams, version string) *cob
 	// globals options
 	cmd.Flags().StringVarP(&opt.currentNs, "namespace", "n", "", "current namespace")
 	cmd.Flags().BoolVarP(&opt.Debug, "debug", "d", false, "debug mode")
+	cmd.Flags().StringVarP(&opt.LogFormat, "logFormat", "", common.LogFormatConsole, "format of log output, 'console' or 'json'")
 	cmd.Flags().StringVarP(&opt.Image, "image", "i", "registry.cn-hangzhou.aliyuncs.com/rdc-incubator/kt-connect-shadow", "shadow image")
 	cmd.Flags().StringVarP(&opt.Labels, "labels", "l", "", "custom labels on shadow pod")
 	cmd.Flags().IntVarP(&opt.Timeout, "timeout", "", 30, "timeout to wait port-forward")
 
 	// method
-	cmd.Flags().StringVarP(&opt.Method, "method", "m", "", "connect provider vpn/socks/socks5/tun(alpha)")
+	cmd.Flags().StringVarP(&opt.Method, "method", "m", "", "connect provider vpn/socks/socks5/tun(alpha)/forward")
 	cmd.Flags().IntVarP(&opt.Port, "port", "p", 2222, "Local SSH Proxy port ")
 	cmd.Flags().BoolVarP(&opt.Global, "global", "g", false, "with cluster scope")
 
@@ -71,6 +72,7 @@ func NewConnectCommand(streams genericclioptions.IOStreams, version string) *cob
 	// tun
 	cmd.Flags().StringVarP(&opt.TunName, "tunName", "", "tun0", "The tun device name to create on client machine (Alpha). Only works on Linux")
 	cmd.Flags().StringVarP(&opt.TunCidr, "tunCidr", "", "10.1.1.0/30", "The cidr used by local tun and peer tun device, at least 4 ips. This cidr MUST NOT overlay with kubernetes service cidr and pod cidr")
+	cmd.Flags().StringVarP(&opt.TunCidr6, "tunCidr6", "", "fd00:6b74::/126", "The ipv6 cidr used by local tun and peer tun device when cluster has ipv6 network")
 
 	// socks
 	cmd.Flags().IntVarP(&opt.Proxy, "proxy", "", 2223, "when should method socks or socks5, you can choice which port to proxy")
@@ -121,8 +123,8 @@ func (o *ConnectOptions) Run() error {
 	context := &kt.Cli{Options: ops}
 	action := command.Action{}
 
-	if ops.Debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	if err := o.setupLogger(); err != nil {
+		return err
 	}
 
 	return action.Connect(context, ops)
@@ -149,6 +151,7 @@ func (o *ConnectOptions) transport() *options.DaemonOptions {
 		Dump2HostsNamespaces: strings.Split(o.Dump2hosts, ","),
 		TunName:              o.TunName,
 		TunCidr:              o.TunCidr,
+		TunCidr6:             o.TunCidr6,
 	}
 	return daemonOptions
 }
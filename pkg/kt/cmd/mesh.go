@@ -2,10 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt"
 	"github.com/alibaba/kt-connect/pkg/kt/command"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
-	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -43,6 +43,7 @@ func NewMeshCommand(streams genericclioptions.IOStreams, version string) *cobra.
 	// globals options
 	cmd.Flags().StringVarP(&opt.currentNs, "namespace", "n", "", "current namespace")
 	cmd.Flags().BoolVarP(&opt.Debug, "debug", "d", false, "debug mode")
+	cmd.Flags().StringVarP(&opt.LogFormat, "logFormat", "", common.LogFormatConsole, "format of log output, 'console' or 'json'")
 	cmd.Flags().StringVarP(&opt.Image, "image", "i", "registry.cn-hangzhou.aliyuncs.com/rdc-incubator/kt-connect-shadow", "shadow image")
 	cmd.Flags().StringVarP(&opt.Labels, "labels", "l", "", "custom labels on shadow pod")
 	cmd.Flags().IntVarP(&opt.Timeout, "timeout", "", 30, "timeout to wait port-forward")
@@ -96,10 +97,7 @@ func (o *MeshOptions) Complete(cmd *cobra.Command, args []string) error {
 
 	o.clientset = clientset
 	o.restConfig = restConfig
-	if o.Debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
-	return nil
+	return o.setupLogger()
 }
 
 // Run ...
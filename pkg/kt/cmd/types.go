@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -15,6 +17,7 @@ type GlobalOptions struct {
 	Labels    string
 	Image     string
 	Debug     bool
+	LogFormat string
 	currentNs string
 	Timeout   int
 
@@ -55,6 +58,7 @@ type ConnectOptions struct {
 	Global     bool
 	TunName    string
 	TunCidr    string
+	TunCidr6   string
 }
 
 // MeshOptions ...
@@ -83,10 +87,22 @@ type ProvideOptions struct {
 	Target   string
 }
 
+// setupLogger apply log format and debug level of global options, same as ktctl
+func (o *GlobalOptions) setupLogger() error {
+	if err := common.SetupLogger(o.LogFormat, util.IsWindows()); err != nil {
+		return err
+	}
+	if o.Debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+	return nil
+}
+
 func (o *GlobalOptions) transportGlobalOptions() *options.DaemonOptions {
 	return &options.DaemonOptions{
 		Image:     o.Image,
 		Debug:     o.Debug,
+		LogFormat: o.LogFormat,
 		Labels:    o.Labels,
 		Namespace: o.currentNs,
 		WaitTime:  o.Timeout,
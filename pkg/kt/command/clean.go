@@ -2,6 +2,7 @@ package command
 
 import (
 	"container/list"
+	"encoding/json"
 	"fmt"
 	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt"
@@ -12,11 +13,18 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	urfave "github.com/urfave/cli"
+	"io"
 	"io/ioutil"
 	"k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sLabels "k8s.io/apimachinery/pkg/labels"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -25,6 +33,18 @@ type ResourceToClean struct {
 	NamesOfServiceToDelete    *list.List
 	NamesOfConfigMapToDelete  *list.List
 	DeploymentsToScale        map[string]int32
+	SubsetsToRemove           *list.List
+	NamesOfLeaseToDelete      *list.List
+}
+
+func newResourceToClean() ResourceToClean {
+	return ResourceToClean{list.New(), list.New(), list.New(), make(map[string]int32), list.New(), list.New()}
+}
+
+func (r ResourceToClean) isEmpty() bool {
+	return r.NamesOfDeploymentToDelete.Len() == 0 && r.NamesOfServiceToDelete.Len() == 0 &&
+		r.NamesOfConfigMapToDelete.Len() == 0 && len(r.DeploymentsToScale) == 0 && r.SubsetsToRemove.Len() == 0 &&
+		r.NamesOfLeaseToDelete.Len() == 0
 }
 
 // newConnectCommand return new connect command
@@ -44,11 +64,45 @@ func newCleanCommand(cli kt.CliInterface, options *options.DaemonOptions, action
 				Destination: &options.CleanOptions.ThresholdInMinus,
 				Value:       util.ResourceHeartBeatIntervalMinus * 3,
 			},
+			urfave.BoolFlag{
+				Name:        "allNamespaces,A",
+				Usage:       "Clean shadows of all namespaces",
+				Destination: &options.CleanOptions.AllNamespaces,
+			},
+			urfave.StringFlag{
+				Name:        "selector",
+				Usage:       "Only clean shadows match the label selector, e.g. 'kt-component=connect'",
+				Destination: &options.CleanOptions.Selector,
+			},
+			urfave.StringFlag{
+				Name:        "user",
+				Usage:       "Only clean shadows created by specified local user",
+				Destination: &options.CleanOptions.User,
+			},
+			urfave.StringFlag{
+				Name:        "remoteAddress",
+				Usage:       "Only clean shadows created from specified local ip address",
+				Destination: &options.CleanOptions.RemoteAddress,
+			},
+			urfave.StringFlag{
+				Name:        "output,o",
+				Usage:       "Output format of dry run result, 'table' or 'json'",
+				Destination: &options.CleanOptions.Output,
+				Value:       "table",
+			},
+			urfave.BoolFlag{
+				Name:        "local",
+				Usage:       "Only revert changes to local machine left by crashed ktctl, without touching cluster",
+				Destination: &options.CleanOptions.LocalOnly,
+			},
 		},
 		Action: func(c *urfave.Context) error {
 			if options.Debug {
 				zerolog.SetGlobalLevel(zerolog.DebugLevel)
 			}
+			if options.CleanOptions.LocalOnly {
+				return action.Clean(cli, options)
+			}
 			if err := combineKubeOpts(options); err != nil {
 				return err
 			}
@@ -60,20 +114,34 @@ func newCleanCommand(cli kt.CliInterface, options *options.DaemonOptions, action
 //Clean delete unavailing shadow pods
 func (action *Action) Clean(cli kt.CliInterface, options *options.DaemonOptions) error {
 	action.cleanPidFiles()
-	kubernetes, deployments, err := action.getShadowDeployments(cli, options)
+	if options.CleanOptions.DryRun {
+		for _, journal := range util.StaleJournals() {
+			log.Info().Msgf("Found %d local changes left by ktctl process %d", len(journal.Mutations), journal.Pid)
+		}
+	} else {
+		RestoreLocalChanges()
+	}
+	if options.CleanOptions.LocalOnly {
+		return nil
+	}
+	kubernetes, namespace, deployments, err := action.getShadowDeployments(cli, options)
 	if err != nil {
 		return err
 	}
 	log.Debug().Msgf("Found %d shadow deployments", len(deployments))
-	resourceToClean := ResourceToClean{list.New(), list.New(), list.New(), make(map[string]int32)}
-	for _, deployment := range deployments {
-		action.analysisShadowDeployment(deployment, options, resourceToClean)
+	resourcesToClean, err := action.analysisResources(kubernetes, namespace, deployments, options)
+	if err != nil {
+		return err
 	}
-	if resourceToClean.NamesOfDeploymentToDelete.Len() > 0 {
+	if len(resourcesToClean) > 0 {
 		if options.CleanOptions.DryRun {
-			action.printResourceToClean(resourceToClean)
+			if err = printResourceToClean(os.Stdout, resourcesToClean, options.CleanOptions.Output); err != nil {
+				return err
+			}
 		} else {
-			action.cleanResource(resourceToClean, kubernetes, options.Namespace)
+			for namespace, resourceToClean := range resourcesToClean {
+				action.cleanResource(resourceToClean, kubernetes, namespace)
+			}
 		}
 	} else {
 		log.Info().Msg("No unavailing shadow deployment found (^.^)YYa!!")
@@ -99,25 +167,93 @@ func (action *Action) cleanPidFiles() {
 	}
 }
 
-func (action *Action) analysisShadowDeployment(deployment v1.Deployment, options *options.DaemonOptions, resourceToClean ResourceToClean) {
-	lastHeartBeat, err := strconv.ParseInt(deployment.ObjectMeta.Annotations[common.KTLastHeartBeat], 10, 64)
-	if err == nil && action.isExpired(lastHeartBeat, options) {
+// analysisResources find resources of expired shadows and orphaned exchanged deployments, grouped by namespace,
+// nothing is cleaned if session leases can't be listed, otherwise every lease-owned shadow would look expired
+func (action *Action) analysisResources(kubernetes cluster.KubernetesInterface, namespace string,
+	deployments []v1.Deployment, options *options.DaemonOptions) (map[string]ResourceToClean, error) {
+	resourcesToClean := map[string]ResourceToClean{}
+	resourceOf := func(namespace string) ResourceToClean {
+		if _, exists := resourcesToClean[namespace]; !exists {
+			resourcesToClean[namespace] = newResourceToClean()
+		}
+		return resourcesToClean[namespace]
+	}
+	leases, err := kubernetes.GetSessionLeases(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session leases: %s", err)
+	}
+	selector, err := k8sLabels.Parse(options.CleanOptions.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector '%s': %s", options.CleanOptions.Selector, err)
+	}
+	leaseOf := map[string]coordinationV1.Lease{}
+	for _, lease := range leases {
+		leaseOf[lease.Namespace+"/"+lease.Name] = lease
+		if action.isLeaseExpired(lease, options) && matchCleanFilter(lease.Labels, selector, options.CleanOptions) {
+			resourceOf(lease.Namespace).NamesOfLeaseToDelete.PushBack(lease.Name)
+		}
+	}
+	for _, deployment := range deployments {
+		action.analysisShadowDeployment(deployment, leaseOf, options, resourceOf(deployment.Namespace))
+	}
+	var exchanged []v1.Deployment
+	if hasCleanFilter(options.CleanOptions) {
+		// shadow of orphaned exchanged deployment is gone, so it can't tell which user it belongs to
+		log.Debug().Msgf("Skip recovering orphaned exchanged deployments since filter is specified")
+	} else if exchanged, err = kubernetes.GetExchangedDeployments(namespace); err != nil {
+		log.Warn().Msgf("Failed to list exchanged deployments: %s", err)
+	}
+	for _, deployment := range exchanged {
+		action.analysisExchangedDeployment(deployment, kubernetes, resourceOf(deployment.Namespace))
+	}
+	for ns, resourceToClean := range resourcesToClean {
+		if resourceToClean.isEmpty() {
+			delete(resourcesToClean, ns)
+		}
+	}
+	return resourcesToClean, nil
+}
+
+// analysisExchangedDeployment recover deployment whose exchange shadow no longer exists,
+// e.g. shadow deleted manually or exchange crashed before the shadow recorded it
+func (action *Action) analysisExchangedDeployment(deployment v1.Deployment, kubernetes cluster.KubernetesInterface,
+	resourceToClean ResourceToClean) {
+	shadow := deployment.Labels[common.KTExchangedBy]
+	if _, err := kubernetes.GetDeployment(shadow, deployment.Namespace); !k8sErrors.IsNotFound(err) {
+		return
+	}
+	replicas, err := strconv.ParseInt(deployment.Annotations[common.KTOriginReplicas], 10, 32)
+	if err != nil || replicas <= 0 {
+		replicas = 1
+	}
+	log.Debug().Msgf("Shadow %s of exchanged deployment %s not exist", shadow, deployment.Name)
+	resourceToClean.DeploymentsToScale[deployment.Name] = int32(replicas)
+}
+
+func (action *Action) analysisShadowDeployment(deployment v1.Deployment, leaseOf map[string]coordinationV1.Lease,
+	options *options.DaemonOptions, resourceToClean ResourceToClean) {
+	if action.isShadowExpired(deployment, leaseOf, options) {
 		resourceToClean.NamesOfDeploymentToDelete.PushBack(deployment.Name)
-		config := util.String2Map(deployment.ObjectMeta.Annotations[common.KTConfig])
-		if deployment.ObjectMeta.Labels[common.KTComponent] == common.ComponentExchange {
-			replica, _ := strconv.ParseInt(config["replicas"], 10, 32)
-			app := config["app"]
-			if replica > 0 && app != "" {
-				resourceToClean.DeploymentsToScale[app] = int32(replica)
+		// config map and service of shadow with owner are owned by the shadow, which are deleted by garbage collector,
+		// only shadow created by old version need to delete them one by one
+		legacy := len(deployment.OwnerReferences) == 0
+		config := cluster.ParseShadowConfig(deployment.ObjectMeta.Annotations[common.KTConfig])
+		switch deployment.ObjectMeta.Labels[common.KTComponent] {
+		case common.ComponentExchange:
+			if config.Replicas > 0 && config.Origin != "" {
+				resourceToClean.DeploymentsToScale[config.Origin] = config.Replicas
 			}
-		} else if deployment.ObjectMeta.Labels[common.KTComponent] == common.ComponentProvide {
-			service := config["service"]
-			if service != "" {
-				resourceToClean.NamesOfServiceToDelete.PushBack(service)
+		case common.ComponentProvide:
+			if config.Service != "" && legacy {
+				resourceToClean.NamesOfServiceToDelete.PushBack(config.Service)
+			}
+		case common.ComponentMesh:
+			if config.Subset != "" {
+				resourceToClean.SubsetsToRemove.PushBack(config.Subset)
 			}
 		}
 		for _, v := range deployment.Spec.Template.Spec.Volumes {
-			if v.ConfigMap != nil && len(v.ConfigMap.Items) == 1 && v.ConfigMap.Items[0].Key == common.SSHAuthKey {
+			if legacy && v.ConfigMap != nil && len(v.ConfigMap.Items) == 1 && v.ConfigMap.Items[0].Key == common.SSHAuthKey {
 				resourceToClean.NamesOfConfigMapToDelete.PushBack(v.ConfigMap.Name)
 			}
 		}
@@ -128,26 +264,62 @@ func (action *Action) cleanResource(r ResourceToClean, kubernetes cluster.Kubern
 	log.Info().Msgf("Deleting %d unavailing shadow deployments", r.NamesOfDeploymentToDelete.Len())
 	for name := r.NamesOfDeploymentToDelete.Front(); name != nil; name = name.Next() {
 		err := kubernetes.RemoveDeployment(name.Value.(string), namespace)
-		if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
 			log.Error().Msgf("Fail to delete deployment %s", name.Value.(string))
+		} else {
+			action.recordEvent("Deployment", "apps/v1", namespace, name.Value.(string),
+				"ShadowDeleted", "Deleted expired shadow deployment")
 		}
 	}
 	for name := r.NamesOfServiceToDelete.Front(); name != nil; name = name.Next() {
 		err := kubernetes.RemoveService(name.Value.(string), namespace)
-		if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
 			log.Error().Msgf("Fail to delete service %s", name.Value.(string))
+		} else {
+			action.recordEvent("Service", "v1", namespace, name.Value.(string),
+				"ShadowServiceDeleted", "Deleted service of expired shadow")
 		}
 	}
 	for name := r.NamesOfConfigMapToDelete.Front(); name != nil; name = name.Next() {
 		err := kubernetes.RemoveConfigMap(name.Value.(string), namespace)
-		if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
 			log.Error().Msgf("Fail to delete config map %s", name.Value.(string))
+		} else {
+			action.recordEvent("ConfigMap", "v1", namespace, name.Value.(string),
+				"ShadowConfigMapDeleted", "Deleted ssh key config map of expired shadow")
 		}
 	}
 	for name, replica := range r.DeploymentsToScale {
-		err := kubernetes.ScaleTo(name, namespace, &replica)
-		if err != nil {
+		err := kubernetes.Recover(name, namespace, replica)
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
 			log.Error().Msgf("Fail to scale deployment %s to %d", name, replica)
+		} else {
+			action.recordEvent("Deployment", "apps/v1", namespace, name,
+				"ReplicasRestored", fmt.Sprintf("Restored to %d replicas after exchange shadow expired", replica))
+		}
+	}
+	for name := r.NamesOfLeaseToDelete.Front(); name != nil; name = name.Next() {
+		err := kubernetes.RemoveLease(name.Value.(string), namespace)
+		if k8sErrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			log.Error().Msgf("Fail to delete lease %s", name.Value.(string))
+		} else {
+			action.recordEvent("Lease", "coordination.k8s.io/v1", namespace, name.Value.(string),
+				"SessionLeaseDeleted", "Deleted expired session lease")
+		}
+	}
+	for subset := r.SubsetsToRemove.Front(); subset != nil; subset = subset.Next() {
+		if err := kubernetes.RemoveDestinationRuleSubset(subset.Value.(string), namespace); err != nil {
+			log.Error().Msgf("Fail to remove subset %s from destination rules: %s", subset.Value.(string), err)
 		}
 	}
 	log.Info().Msg("Done")
@@ -166,19 +338,105 @@ func (action *Action) toPid(pidFileName string) int {
 	return -1
 }
 
-func (action *Action) printResourceToClean(r ResourceToClean) {
-	log.Info().Msgf("Found %d unavailing shadow deployments:", r.NamesOfDeploymentToDelete.Len())
-	for name := r.NamesOfDeploymentToDelete.Front(); name != nil; name = name.Next() {
-		log.Info().Msgf(" * %s", name.Value.(string))
+// cleanPlan dry run result of one namespace
+type cleanPlan struct {
+	Namespace         string           `json:"namespace"`
+	Deployments       []string         `json:"deployments"`
+	Services          []string         `json:"services"`
+	ConfigMaps        []string         `json:"configMaps"`
+	ReplicasToRestore map[string]int32 `json:"replicasToRestore"`
+	Subsets           []string         `json:"subsets"`
+	Leases            []string         `json:"leases"`
+}
+
+// printResourceToClean print resources to clean of every namespace as table or json
+func printResourceToClean(w io.Writer, resourcesToClean map[string]ResourceToClean, format string) error {
+	var plans []cleanPlan
+	for namespace, r := range resourcesToClean {
+		plans = append(plans, cleanPlan{
+			Namespace:         namespace,
+			Deployments:       listToStrings(r.NamesOfDeploymentToDelete),
+			Services:          listToStrings(r.NamesOfServiceToDelete),
+			ConfigMaps:        listToStrings(r.NamesOfConfigMapToDelete),
+			ReplicasToRestore: r.DeploymentsToScale,
+			Subsets:           listToStrings(r.SubsetsToRemove),
+			Leases:            listToStrings(r.NamesOfLeaseToDelete),
+		})
 	}
-	log.Info().Msgf("Found %d unavailing shadow service:", r.NamesOfServiceToDelete.Len())
-	for name := r.NamesOfServiceToDelete.Front(); name != nil; name = name.Next() {
-		log.Info().Msgf(" * %s", name.Value.(string))
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].Namespace < plans[j].Namespace
+	})
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plans)
+	case "table", "":
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(table, "NAMESPACE\tKIND\tNAME\tACTION")
+		for _, plan := range plans {
+			for _, name := range plan.Deployments {
+				_, _ = fmt.Fprintf(table, "%s\tDeployment\t%s\tdelete\n", plan.Namespace, name)
+			}
+			for _, name := range plan.Services {
+				_, _ = fmt.Fprintf(table, "%s\tService\t%s\tdelete\n", plan.Namespace, name)
+			}
+			for _, name := range plan.ConfigMaps {
+				_, _ = fmt.Fprintf(table, "%s\tConfigMap\t%s\tdelete\n", plan.Namespace, name)
+			}
+			var apps []string
+			for app := range plan.ReplicasToRestore {
+				apps = append(apps, app)
+			}
+			sort.Strings(apps)
+			for _, app := range apps {
+				_, _ = fmt.Fprintf(table, "%s\tDeployment\t%s\tscale to %d\n", plan.Namespace, app, plan.ReplicasToRestore[app])
+			}
+			for _, subset := range plan.Subsets {
+				_, _ = fmt.Fprintf(table, "%s\tDestinationRuleSubset\t%s\tremove\n", plan.Namespace, subset)
+			}
+			for _, name := range plan.Leases {
+				_, _ = fmt.Fprintf(table, "%s\tLease\t%s\tdelete\n", plan.Namespace, name)
+			}
+		}
+		return table.Flush()
+	default:
+		return fmt.Errorf("unsupported output format '%s', should be 'table' or 'json'", format)
 	}
-	log.Info().Msgf("Found %d exchanged deployments to recover:", len(r.DeploymentsToScale))
-	for name, replica := range r.DeploymentsToScale {
-		log.Info().Msgf(" * %s -> %d", name, replica)
+}
+
+func listToStrings(l *list.List) []string {
+	items := make([]string, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		items = append(items, e.Value.(string))
 	}
+	return items
+}
+
+// isShadowExpired shadow owned by session leases expires after all of its leases expired,
+// shadow without lease relies on the heartbeat annotation
+func (action *Action) isShadowExpired(deployment v1.Deployment, leaseOf map[string]coordinationV1.Lease,
+	options *options.DaemonOptions) bool {
+	var owners []string
+	for _, owner := range deployment.OwnerReferences {
+		if owner.Kind == "Lease" {
+			owners = append(owners, owner.Name)
+		}
+	}
+	if len(owners) == 0 {
+		lastHeartBeat, err := strconv.ParseInt(deployment.ObjectMeta.Annotations[common.KTLastHeartBeat], 10, 64)
+		return err == nil && action.isExpired(lastHeartBeat, options)
+	}
+	for _, owner := range owners {
+		if lease, exists := leaseOf[deployment.Namespace+"/"+owner]; exists && !action.isLeaseExpired(lease, options) {
+			return false
+		}
+	}
+	return true
+}
+
+func (action *Action) isLeaseExpired(lease coordinationV1.Lease, options *options.DaemonOptions) bool {
+	return cluster.IsLeaseExpired(&lease, time.Duration(options.CleanOptions.ThresholdInMinus)*time.Minute)
 }
 
 func (action *Action) isExpired(lastHeartBeat int64, options *options.DaemonOptions) bool {
@@ -186,14 +444,57 @@ func (action *Action) isExpired(lastHeartBeat int64, options *options.DaemonOpti
 }
 
 func (action *Action) getShadowDeployments(cli kt.CliInterface, options *options.DaemonOptions) (
-	cluster.KubernetesInterface, []v1.Deployment, error) {
+	cluster.KubernetesInterface, string, []v1.Deployment, error) {
 	kubernetes, err := cli.Kubernetes()
 	if err != nil {
-		return nil, nil, err
+		return nil, "", nil, err
+	}
+	namespace := options.Namespace
+	if options.CleanOptions.AllNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	deployments, err := kubernetes.GetAllExistingShadowDeployments(namespace)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	deployments, err = filterShadowDeployments(deployments, options.CleanOptions)
+	if err != nil {
+		return nil, "", nil, err
 	}
-	deployments, err := kubernetes.GetAllExistingShadowDeployments(options.Namespace)
+	return kubernetes, namespace, deployments, nil
+}
+
+// filterShadowDeployments only keep shadows match label selector, user and remote address
+func filterShadowDeployments(deployments []v1.Deployment, cleanOptions *options.CleanOptions) ([]v1.Deployment, error) {
+	selector, err := k8sLabels.Parse(cleanOptions.Selector)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("invalid selector '%s': %s", cleanOptions.Selector, err)
+	}
+	var filtered []v1.Deployment
+	for _, deployment := range deployments {
+		if matchCleanFilter(deployment.Labels, selector, cleanOptions) {
+			filtered = append(filtered, deployment)
+		}
+	}
+	return filtered, nil
+}
+
+// matchCleanFilter check labels of shadow or session lease against label selector, user and remote address
+func matchCleanFilter(labels map[string]string, selector k8sLabels.Selector, cleanOptions *options.CleanOptions) bool {
+	if !selector.Matches(k8sLabels.Set(labels)) {
+		return false
+	}
+	if cleanOptions.User != "" && labels[common.KTUser] != util.ToLabelValue(cleanOptions.User) {
+		return false
 	}
-	return kubernetes, deployments, nil
+	if cleanOptions.RemoteAddress != "" &&
+		labels[common.KTRemoteAddress] != util.IPToLabelValue(cleanOptions.RemoteAddress) {
+		return false
+	}
+	return true
+}
+
+// hasCleanFilter whether only part of resources should be cleaned
+func hasCleanFilter(cleanOptions *options.CleanOptions) bool {
+	return cleanOptions.Selector != "" || cleanOptions.User != "" || cleanOptions.RemoteAddress != ""
 }
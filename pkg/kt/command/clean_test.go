@@ -1,9 +1,20 @@
 package command
 
 import (
+	"bytes"
 	"flag"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
+	appV1 "k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/alibaba/kt-connect/pkg/kt"
 
@@ -27,6 +38,7 @@ func Test_cleanCommand(t *testing.T) {
 		expectedErr            error
 	}{
 		{testArgs: []string{"clean", "--dryRun"}, skipFlagParsing: false, useShortOptionHandling: false, expectedErr: nil},
+		{testArgs: []string{"clean", "--allNamespaces", "--user", "alice"}, skipFlagParsing: false, useShortOptionHandling: false, expectedErr: nil},
 		{testArgs: []string{"clean"}, skipFlagParsing: false, useShortOptionHandling: false, expectedErr: nil},
 	}
 
@@ -70,3 +82,151 @@ func Test_toPid(t *testing.T) {
 		t.Errorf("unmatch %d", pid)
 	}
 }
+
+func Test_filterShadowDeployments(t *testing.T) {
+	deployments := []appV1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "alice-connect", Labels: map[string]string{
+			common.KTComponent: common.ComponentConnect, common.KTUser: "alice", common.KTRemoteAddress: "192.168.1.2"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "alice-exchange", Labels: map[string]string{
+			common.KTComponent: common.ComponentExchange, common.KTUser: "alice", common.KTRemoteAddress: "192.168.1.2"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "bob-connect", Labels: map[string]string{
+			common.KTComponent: common.ComponentConnect, common.KTUser: "bob", common.KTRemoteAddress: "192.168.1.3"}}},
+	}
+	cases := []struct {
+		cleanOptions options.CleanOptions
+		expected     []string
+	}{
+		{cleanOptions: options.CleanOptions{}, expected: []string{"alice-connect", "alice-exchange", "bob-connect"}},
+		{cleanOptions: options.CleanOptions{Selector: "kt-component=connect"}, expected: []string{"alice-connect", "bob-connect"}},
+		{cleanOptions: options.CleanOptions{User: "alice"}, expected: []string{"alice-connect", "alice-exchange"}},
+		{cleanOptions: options.CleanOptions{RemoteAddress: "192.168.1.3"}, expected: []string{"bob-connect"}},
+		{cleanOptions: options.CleanOptions{Selector: "kt-component=exchange", User: "bob"}, expected: nil},
+	}
+	for _, c := range cases {
+		filtered, err := filterShadowDeployments(deployments, &c.cleanOptions)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		var names []string
+		for _, d := range filtered {
+			names = append(names, d.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("options %v expected %v but is %v", c.cleanOptions, c.expected, names)
+		}
+	}
+	if _, err := filterShadowDeployments(deployments, &options.CleanOptions{Selector: "a=(b"}); err == nil {
+		t.Errorf("invalid selector should cause error")
+	}
+}
+
+func Test_analysisResourcesWithFilter(t *testing.T) {
+	var replicas int32 = 0
+	userLease := func(name, user string) *coordinationV1.Lease {
+		lease := sessionLease(name, "ns1", time.Now().Add(-time.Hour)).(*coordinationV1.Lease)
+		lease.Labels[common.KTUser] = user
+		return lease
+	}
+	clientset := fake.NewSimpleClientset(
+		userLease("alice-session", "alice"),
+		userLease("bob-session", "bob"),
+		&appV1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app1",
+				Namespace:   "ns1",
+				Labels:      map[string]string{common.KTExchangedBy: "app1-kt-gone"},
+				Annotations: map[string]string{common.KTOriginReplicas: "3"},
+			},
+			Spec: appV1.DeploymentSpec{Replicas: &replicas},
+		},
+	)
+	kubernetes, _ := cluster.CreateFromClientSet(clientset)
+	opts := options.NewDaemonOptions()
+	opts.CleanOptions.ThresholdInMinus = 30
+	opts.CleanOptions.User = "alice"
+
+	resources, err := (&Action{}).analysisResources(kubernetes, metav1.NamespaceAll, nil, opts)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	leases := listToStrings(resources["ns1"].NamesOfLeaseToDelete)
+	if strings.Join(leases, ",") != "alice-session" {
+		t.Errorf("only lease of alice should be deleted, but got %v", leases)
+	}
+	if len(resources["ns1"].DeploymentsToScale) != 0 {
+		t.Errorf("orphaned exchanged deployment should not be recovered with filter, but got %v",
+			resources["ns1"].DeploymentsToScale)
+	}
+}
+
+func Test_printResourceToClean(t *testing.T) {
+	resourceToClean := newResourceToClean()
+	resourceToClean.NamesOfDeploymentToDelete.PushBack("kt-exchange-abc")
+	resourceToClean.NamesOfConfigMapToDelete.PushBack("kt-exchange-abc-public-key")
+	resourceToClean.DeploymentsToScale["app1"] = 2
+	resources := map[string]ResourceToClean{"ns1": resourceToClean}
+
+	buf := &bytes.Buffer{}
+	if err := printResourceToClean(buf, resources, "table"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := "NAMESPACE  KIND        NAME                        ACTION\n" +
+		"ns1        Deployment  kt-exchange-abc             delete\n" +
+		"ns1        ConfigMap   kt-exchange-abc-public-key  delete\n" +
+		"ns1        Deployment  app1                        scale to 2\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected table output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := printResourceToClean(buf, resources, "json"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !strings.Contains(buf.String(), `"replicasToRestore": {
+      "app1": 2
+    }`) || !strings.Contains(buf.String(), `"services": []`) {
+		t.Errorf("unexpected json output:\n%s", buf.String())
+	}
+
+	if err := printResourceToClean(buf, resources, "yaml"); err == nil {
+		t.Errorf("unsupported format should cause error")
+	}
+}
+
+func Test_analysisShadowDeployment(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.CleanOptions.ThresholdInMinus = 30
+	volumes := []coreV1.Volume{{
+		Name: "ssh-public-key",
+		VolumeSource: coreV1.VolumeSource{ConfigMap: &coreV1.ConfigMapVolumeSource{
+			LocalObjectReference: coreV1.LocalObjectReference{Name: "kt-provide-public-key-abcd"},
+			Items:                []coreV1.KeyToPath{{Key: common.SSHAuthKey, Path: common.SSHAuthKey}},
+		}},
+	}}
+	legacy := appV1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "legacy-provide",
+			Labels:      map[string]string{common.KTComponent: common.ComponentProvide},
+			Annotations: map[string]string{common.KTLastHeartBeat: "1", common.KTConfig: "service=legacy"},
+		},
+		Spec: appV1.DeploymentSpec{Template: coreV1.PodTemplateSpec{Spec: coreV1.PodSpec{Volumes: volumes}}},
+	}
+	owned := *legacy.DeepCopy()
+	owned.Name = "owned-provide"
+	owned.OwnerReferences = []metav1.OwnerReference{{Kind: "Lease", Name: "kt-session-provide-abcde"}}
+
+	action := Action{}
+	resourceToClean := newResourceToClean()
+	action.analysisShadowDeployment(legacy, nil, opts, resourceToClean)
+	if resourceToClean.NamesOfServiceToDelete.Len() != 1 || resourceToClean.NamesOfConfigMapToDelete.Len() != 1 {
+		t.Errorf("service and config map of legacy shadow should be deleted one by one")
+	}
+	resourceToClean = newResourceToClean()
+	action.analysisShadowDeployment(owned, nil, opts, resourceToClean)
+	if resourceToClean.NamesOfDeploymentToDelete.Len() != 1 {
+		t.Errorf("shadow with expired lease should be deleted")
+	}
+	if resourceToClean.NamesOfServiceToDelete.Len() != 0 || resourceToClean.NamesOfConfigMapToDelete.Len() != 0 {
+		t.Errorf("service and config map of owned shadow should be left to garbage collector")
+	}
+}
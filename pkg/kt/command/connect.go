@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/alibaba/kt-connect/pkg/common"
@@ -13,6 +15,7 @@ import (
 	"github.com/alibaba/kt-connect/pkg/kt/registry"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
 	"github.com/alibaba/kt-connect/pkg/process"
+	"github.com/alibaba/kt-connect/pkg/proxy/dnsserver"
 	"github.com/cilium/ipam/service/allocator"
 	"github.com/cilium/ipam/service/ipallocator"
 	"github.com/rs/zerolog"
@@ -55,7 +58,12 @@ func (action *Action) Connect(cli kt.CliInterface, options *options.DaemonOption
 	log.Info().Msgf("KtConnect start at %d", os.Getpid())
 
 	ch := SetUpCloseHandler(cli, options, common.ComponentConnect)
-	if err = connectToCluster(cli, options); err != nil {
+	if len(options.ConnectOptions.Contexts) > 0 {
+		err = connectToClusters(options)
+	} else {
+		err = connectToCluster(cli, options)
+	}
+	if err != nil {
 		return err
 	}
 	// watch background process, clean the workspace and exit if background process occur exception
@@ -71,6 +79,11 @@ func (action *Action) Connect(cli kt.CliInterface, options *options.DaemonOption
 }
 
 func completeOptions(options *options.DaemonOptions) error {
+	resolver := options.ConnectOptions.DNSResolver
+	if resolver != "" && resolver != common.DnsResolverUpstream && resolver != common.DnsResolverKubernetes {
+		return fmt.Errorf("invalid dns resolver '%s', should be '%s' or '%s'",
+			resolver, common.DnsResolverUpstream, common.DnsResolverKubernetes)
+	}
 	if options.ConnectOptions.Method == common.ConnectMethodTun {
 		srcIP, destIP, err := allocateTunIP(options.ConnectOptions.TunCidr)
 		if err != nil {
@@ -78,6 +91,14 @@ func completeOptions(options *options.DaemonOptions) error {
 		}
 		options.ConnectOptions.SourceIP = srcIP
 		options.ConnectOptions.DestIP = destIP
+		if options.ConnectOptions.TunCidr6 != "" {
+			srcIP6, destIP6, err := allocateTunIP(options.ConnectOptions.TunCidr6)
+			if err != nil {
+				return err
+			}
+			options.ConnectOptions.SourceIP6 = srcIP6
+			options.ConnectOptions.DestIP6 = destIP6
+		}
 	}
 
 	return nil
@@ -89,8 +110,16 @@ func connectToCluster(cli kt.CliInterface, options *options.DaemonOptions) (err
 		return
 	}
 
-	if util.IsWindows() || len(options.ConnectOptions.Dump2HostsNamespaces) > 0 {
+	options.RuntimeOptions.IngressHosts = getIngressHosts(options, kubernetes)
+	if options.ConnectOptions.Method == common.ConnectMethodForward {
+		if err = setupServiceForwards(options, kubernetes); err != nil {
+			return
+		}
+	} else if util.IsWindows() || len(options.ConnectOptions.Dump2HostsNamespaces) > 0 {
 		setupDump2Host(options, kubernetes)
+	} else if hosts := staticHosts(options); len(hosts) > 0 && !isDNSServedByShadow(options) {
+		util.DumpHosts(hosts)
+		options.RuntimeOptions.Dump2Host = true
 	}
 	if options.ConnectOptions.Method == common.ConnectMethodSocks {
 		err = registry.SetGlobalProxy(options.ConnectOptions.SocksPort, &options.RuntimeOptions.ProxyConfig)
@@ -136,12 +165,78 @@ func getOrCreateShadow(options *options.DaemonOptions, err error, kubernetes clu
 }
 
 func setupDump2Host(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) {
-	var namespaceToDump = options.ConnectOptions.Dump2HostsNamespaces
-	if len(namespaceToDump) == 0 {
-		namespaceToDump = append(namespaceToDump, options.Namespace)
+	hosts := dumpedHosts(options, kubernetes)
+	util.DumpHosts(hosts)
+	options.RuntimeOptions.Dump2Host = true
+
+	// keep hosts fresh as services and endpoints changed, e.g. pods of headless service restarted
+	stop := make(chan struct{})
+	options.RuntimeOptions.StopHostsRefresh = stop
+	options.RuntimeOptions.HostsRefreshDone = kubernetes.WatchServiceHosts(namespacesToDump(options), func() {
+		latest := dumpedHosts(options, kubernetes)
+		if !reflect.DeepEqual(latest, hosts) {
+			log.Info().Msgf("Services changed, refreshing hosts")
+			hosts = latest
+			util.DumpHosts(hosts)
+		}
+	}, stop)
+}
+
+// dumpedHosts hosts of services, ingresses and dns override rules
+func dumpedHosts(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) map[string]string {
+	hosts := getServiceHosts(options, kubernetes)
+	for host, ip := range staticHosts(options) {
+		hosts[host] = ip
+	}
+	return hosts
+}
+
+// staticHosts hosts of ingresses and dns override rules, wildcard hosts are only served by dns server
+func staticHosts(options *options.DaemonOptions) map[string]string {
+	return dnsserver.ParseOverrides(dnsOverrides(options)).Hosts()
+}
+
+// dnsOverrides override rules of ingress hosts, followed by user specified rules which take precedence
+func dnsOverrides(options *options.DaemonOptions) string {
+	var rules []string
+	for host, ip := range options.RuntimeOptions.IngressHosts {
+		rules = append(rules, host+"="+ip)
+	}
+	sort.Strings(rules)
+	if options.ConnectOptions.DNSOverrides != "" {
+		rules = append(rules, options.ConnectOptions.DNSOverrides)
+	}
+	return strings.Join(rules, ",")
+}
+
+// getIngressHosts hosts of ingresses and http routes in namespaces to dump, mapped to ingress controller
+func getIngressHosts(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) map[string]string {
+	hosts := map[string]string{}
+	for _, namespace := range namespacesToDump(options) {
+		for host, ip := range kubernetes.IngressHosts(namespace, options.ConnectOptions.IngressController) {
+			log.Debug().Msgf("Ingress host found: %s %s", host, ip)
+			hosts[host] = ip
+		}
+	}
+	return hosts
+}
+
+func namespacesToDump(options *options.DaemonOptions) []string {
+	if len(options.ConnectOptions.Dump2HostsNamespaces) == 0 {
+		return []string{options.Namespace}
 	}
+	return options.ConnectOptions.Dump2HostsNamespaces
+}
+
+// isDNSServedByShadow whether local dns queries are sent to shadow dns server
+func isDNSServedByShadow(options *options.DaemonOptions) bool {
+	method := options.ConnectOptions.Method
+	return !options.ConnectOptions.DisableDNS && (method == common.ConnectMethodVpn || method == common.ConnectMethodTun)
+}
+
+func getServiceHosts(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) map[string]string {
 	hosts := map[string]string{}
-	for _, namespace := range namespaceToDump {
+	for _, namespace := range namespacesToDump(options) {
 		log.Debug().Msgf("Search service in %s namespace...", namespace)
 		singleHosts := kubernetes.ServiceHosts(namespace)
 		for svc, ip := range singleHosts {
@@ -149,15 +244,21 @@ func setupDump2Host(options *options.DaemonOptions, kubernetes cluster.Kubernete
 				continue
 			}
 			log.Debug().Msgf("Service found: %s.%s %s", svc, namespace, ip)
-			if namespace == options.Namespace {
-				hosts[svc] = ip
+			for _, host := range serviceHostNames(options, svc, namespace) {
+				hosts[host] = ip
 			}
-			hosts[svc+"."+namespace] = ip
-			hosts[svc+"."+namespace+"."+options.ConnectOptions.ClusterDomain] = ip
 		}
 	}
-	util.DumpHosts(hosts)
-	options.RuntimeOptions.Dump2Host = true
+	return hosts
+}
+
+// serviceHostNames names of service written to hosts, short name is only for services in current namespace
+func serviceHostNames(options *options.DaemonOptions, svc, namespace string) []string {
+	names := []string{svc + "." + namespace, svc + "." + namespace + "." + options.ConnectOptions.ClusterDomain}
+	if namespace == options.Namespace {
+		names = append(names, svc)
+	}
+	return names
 }
 
 func envs(options *options.DaemonOptions) map[string]string {
@@ -167,10 +268,31 @@ func envs(options *options.DaemonOptions) map[string]string {
 		log.Debug().Msgf("Found local domains: %s", localDomains)
 		envs[common.EnvVarLocalDomains] = localDomains
 	}
+	if options.ConnectOptions.DNSUpstreams != "" {
+		envs[common.EnvVarDnsUpstreams] = options.ConnectOptions.DNSUpstreams
+	}
+	if options.ConnectOptions.DNSForwards != "" {
+		envs[common.EnvVarDnsForwards] = options.ConnectOptions.DNSForwards
+	}
+	if overrides := dnsOverrides(options); overrides != "" {
+		envs[common.EnvVarDnsOverrides] = overrides
+	}
+	if options.ConnectOptions.DNSResolver == common.DnsResolverKubernetes {
+		envs[common.EnvVarDnsResolver] = options.ConnectOptions.DNSResolver
+		envs[common.EnvVarClusterDomain] = options.ConnectOptions.ClusterDomain
+	}
+	if options.LogFormat == common.LogFormatJson {
+		envs[common.EnvVarLogFormat] = options.LogFormat
+	}
 	if options.ConnectOptions.Method == common.ConnectMethodTun {
 		envs[common.ClientTunIP] = options.ConnectOptions.SourceIP
 		envs[common.ServerTunIP] = options.ConnectOptions.DestIP
 		envs[common.TunMaskLength] = util.ExtractNetMaskFromCidr(options.ConnectOptions.TunCidr)
+		if options.ConnectOptions.SourceIP6 != "" {
+			envs[common.ClientTunIP6] = options.ConnectOptions.SourceIP6
+			envs[common.ServerTunIP6] = options.ConnectOptions.DestIP6
+			envs[common.TunMaskLength6] = util.ExtractNetMaskFromCidr(options.ConnectOptions.TunCidr6)
+		}
 	}
 	return envs
 }
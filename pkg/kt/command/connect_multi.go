@@ -0,0 +1,231 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/alibaba/kt-connect/pkg/proxy/dnsserver"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// port offset between clusters, e.g. 2222, 2232, 2242
+	clusterPortStep = 10
+	// address of local dns router
+	dnsRouterAddress = "127.0.0.1:53"
+)
+
+// connectToClusters connect to every kubeconfig context with its own shadow,
+// and dispatch dns queries to each cluster via local dns router
+func connectToClusters(options *options.DaemonOptions) (err error) {
+	if options.ConnectOptions.Method != common.ConnectMethodVpn && options.ConnectOptions.Method != common.ConnectMethodTun {
+		return fmt.Errorf("connect to multiple contexts only supports '%s' and '%s' method",
+			common.ConnectMethodVpn, common.ConnectMethodTun)
+	}
+
+	var routes []dnsserver.Route
+	hosts := map[string]string{}
+	clusterCidrs := map[string][]string{}
+	ingressHosts := map[string]string{}
+	for i, contextAndAlias := range options.ConnectOptions.Contexts {
+		context, alias := parseContextAlias(contextAndAlias)
+		clusterOptions, err := contextOptions(options, context, i)
+		if err != nil {
+			return err
+		}
+		// record cluster options in order to clean up when exit
+		options.RuntimeOptions.Clusters = append(options.RuntimeOptions.Clusters, clusterOptions)
+
+		cli := &kt.Cli{Options: clusterOptions}
+		kubernetes, err := cli.Kubernetes()
+		if err != nil {
+			return err
+		}
+		endPointIP, podName, credential, err := getOrCreateShadow(clusterOptions, nil, kubernetes)
+		if err != nil {
+			return err
+		}
+		cidrs, err := kubernetes.ClusterCidrs(clusterOptions.Namespace, clusterOptions.ConnectOptions)
+		if err != nil {
+			return err
+		}
+		if err = checkCidrOverlap(context, cidrs, clusterCidrs); err != nil {
+			return err
+		}
+		clusterCidrs[context] = cidrs
+
+		if util.IsWindows() || len(options.ConnectOptions.Dump2HostsNamespaces) > 0 {
+			for host, ip := range getServiceHosts(clusterOptions, kubernetes) {
+				if i == 0 || strings.Count(host, ".") > 0 {
+					hosts[aliasHost(host, clusterOptions, alias)] = ip
+				}
+			}
+		}
+		for host, ip := range getIngressHosts(clusterOptions, kubernetes) {
+			ingressHosts[host] = ip
+		}
+		if dnsIP, exists := kubernetes.ServiceHosts("kube-system")["kube-dns"]; exists && dnsIP != "" {
+			routes = append(routes, dnsserver.Route{
+				Alias:     alias,
+				Domain:    clusterOptions.ConnectOptions.ClusterDomain,
+				Namespace: clusterOptions.Namespace,
+				Upstream:  net.JoinHostPort(dnsIP, "53"),
+			})
+		} else {
+			log.Warn().Msgf("Cluster dns service not found in context %s, skip dns routing", context)
+		}
+
+		log.Info().Msgf("Connecting to context %s (alias '%s')", context, alias)
+		if err = cli.Shadow().Outbound(podName, endPointIP, credential, cidrs, cli.Exec()); err != nil {
+			return err
+		}
+	}
+
+	options.RuntimeOptions.IngressHosts = ingressHosts
+	overrides := dnsserver.ParseOverrides(dnsOverrides(options))
+	if len(hosts) > 0 || (len(overrides) > 0 && options.ConnectOptions.DisableDNS) {
+		for host, ip := range overrides.Hosts() {
+			hosts[host] = ip
+		}
+		util.DumpHosts(hosts)
+		options.RuntimeOptions.Dump2Host = true
+	}
+	if !options.ConnectOptions.DisableDNS && len(routes) > 0 {
+		return startDNSRouter(routes, overrides)
+	}
+	return nil
+}
+
+// startDNSRouter start local dns router and use it as nameserver
+func startDNSRouter(routes []dnsserver.Route, overrides dnsserver.Overrides) error {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return err
+	}
+	if _, err = dnsserver.StartDNSRouter(dnsRouterAddress, routes, config, overrides); err != nil {
+		return fmt.Errorf("failed to start dns router on %s: %s", dnsRouterAddress, err)
+	}
+	host, _, _ := net.SplitHostPort(dnsRouterAddress)
+	if err = util.AddNameserver(host); err != nil {
+		return err
+	}
+	log.Info().Msgf("Add nameserver %s successful", host)
+	return nil
+}
+
+// contextOptions create options for specified kubeconfig context
+func contextOptions(options *options.DaemonOptions, context string, index int) (*options.DaemonOptions, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: options.KubeConfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context})
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterOptions := *options
+	runtimeOptions := *options.RuntimeOptions
+	connectOptions := *options.ConnectOptions
+	clusterOptions.RuntimeOptions = &runtimeOptions
+	clusterOptions.ConnectOptions = &connectOptions
+
+	runtimeOptions.Clusters = nil
+	runtimeOptions.Context = context
+	runtimeOptions.Clientset = clientset
+	runtimeOptions.RestConfig = restConfig
+
+	// namespace in context is used unless specified by user
+	if namespace, _, err := clientConfig.Namespace(); err == nil && options.Namespace == common.DefNamespace {
+		clusterOptions.Namespace = namespace
+	}
+	var kubeOptions []string
+	for _, opt := range options.KubeOptions {
+		if !strings.HasPrefix(opt, "--namespace") && !strings.HasPrefix(opt, "--context") {
+			kubeOptions = append(kubeOptions, opt)
+		}
+	}
+	clusterOptions.KubeOptions = append(kubeOptions,
+		fmt.Sprintf("--namespace=%s", clusterOptions.Namespace), fmt.Sprintf("--context=%s", context))
+
+	// dns is served by local dns router
+	connectOptions.DisableDNS = true
+	connectOptions.SSHPort = options.ConnectOptions.SSHPort + index*clusterPortStep
+	connectOptions.SocksPort = options.ConnectOptions.SocksPort + index*clusterPortStep
+	if connectOptions.Method == common.ConnectMethodTun {
+		if err = shiftTunOptions(&connectOptions, index); err != nil {
+			return nil, err
+		}
+	}
+	return &clusterOptions, nil
+}
+
+// shiftTunOptions use different tun device and tun cidr for each cluster
+func shiftTunOptions(connectOptions *options.ConnectOptions, index int) (err error) {
+	connectOptions.TunName = fmt.Sprintf("tun%d", util.TunIndex(connectOptions.TunName)+index)
+	if connectOptions.TunCidr, err = util.ShiftCidr(connectOptions.TunCidr, index); err != nil {
+		return
+	}
+	if connectOptions.SourceIP, connectOptions.DestIP, err = allocateTunIP(connectOptions.TunCidr); err != nil {
+		return
+	}
+	if connectOptions.TunCidr6 != "" {
+		if connectOptions.TunCidr6, err = util.ShiftCidr(connectOptions.TunCidr6, index); err != nil {
+			return
+		}
+		connectOptions.SourceIP6, connectOptions.DestIP6, err = allocateTunIP(connectOptions.TunCidr6)
+	}
+	return
+}
+
+// parseContextAlias parse '<context>=<alias>' format, alias default to context name
+func parseContextAlias(contextAndAlias string) (string, string) {
+	pos := strings.LastIndex(contextAndAlias, "=")
+	if pos > 0 {
+		return contextAndAlias[:pos], contextAndAlias[pos+1:]
+	}
+	return contextAndAlias, contextAndAlias
+}
+
+// aliasHost convert 'svc.ns' and 'svc.ns.cluster.local' to 'svc.ns.alias'
+func aliasHost(host string, options *options.DaemonOptions, alias string) string {
+	host = strings.TrimSuffix(host, "."+options.ConnectOptions.ClusterDomain)
+	if strings.Count(host, ".") == 0 {
+		return host
+	}
+	return host + "." + alias
+}
+
+// checkCidrOverlap make sure routes of different clusters not conflict
+func checkCidrOverlap(context string, cidrs []string, clusterCidrs map[string][]string) error {
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return err
+		}
+		for otherContext, otherCidrs := range clusterCidrs {
+			for _, otherCidr := range otherCidrs {
+				_, otherNet, err := net.ParseCIDR(otherCidr)
+				if err != nil {
+					return err
+				}
+				if ipNet.Contains(otherNet.IP) || otherNet.Contains(ipNet.IP) {
+					return fmt.Errorf("cidr %s of context %s overlaps with cidr %s of context %s",
+						cidr, context, otherCidr, otherContext)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"github.com/alibaba/kt-connect/pkg/kt/cluster"
@@ -15,6 +16,8 @@ import (
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/golang/mock/gomock"
 	"github.com/urfave/cli"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/alibaba/kt-connect/pkg/kt"
 )
@@ -73,6 +76,7 @@ func Test_shouldConnectToCluster(t *testing.T) {
 	kubernetes.EXPECT().GetOrCreateShadow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
 		"172.168.0.2", "shadowName", "sshcm", nil, nil).AnyTimes()
 	kubernetes.EXPECT().ClusterCidrs(gomock.Any(), gomock.Any()).Return([]string{"10.10.10.0/24"}, nil)
+	kubernetes.EXPECT().IngressHosts("default", "").Return(map[string]string{"orders.internal.corp": "10.96.0.100"})
 
 	shadow.EXPECT().Outbound("shadowName", "172.168.0.2", gomock.Any(), []string{"10.10.10.0/24"}, gomock.Any()).Return(nil)
 	ktctl.EXPECT().Shadow().AnyTimes().Return(shadow)
@@ -85,6 +89,9 @@ func Test_shouldConnectToCluster(t *testing.T) {
 	if err := connectToCluster(ktctl, opts); err != nil {
 		t.Errorf("connectToCluster() error = %v, wantErr %v", err, false)
 	}
+	if envs(opts)["DNS_OVERRIDES"] != "orders.internal.corp=10.96.0.100" {
+		t.Errorf("ingress hosts should be passed to shadow as dns overrides, got %v", envs(opts))
+	}
 
 }
 
@@ -97,6 +104,7 @@ func Test_shouldConnectClusterFailWhenFailCreateShadow(t *testing.T) {
 	shadow := connect.NewMockShadowInterface(ctl)
 	kubernetes.EXPECT().GetOrCreateShadow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
 		"", "", "", nil, errors.New("")).AnyTimes()
+	kubernetes.EXPECT().IngressHosts(gomock.Any(), gomock.Any()).Return(map[string]string{}).AnyTimes()
 
 	ktctl.EXPECT().Shadow().AnyTimes().Return(shadow)
 	ktctl.EXPECT().Kubernetes().AnyTimes().Return(kubernetes, nil)
@@ -118,6 +126,7 @@ func Test_shouldConnectClusterFailWhenFailGetCrids(t *testing.T) {
 	kubernetes.EXPECT().GetOrCreateShadow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
 		"172.168.0.2", "shadowName", "sshcm", nil, nil).AnyTimes()
 	kubernetes.EXPECT().ClusterCidrs(gomock.Any(), gomock.Any()).Return([]string{}, errors.New("fail to get cidr"))
+	kubernetes.EXPECT().IngressHosts(gomock.Any(), gomock.Any()).Return(map[string]string{}).AnyTimes()
 
 	ktctl.EXPECT().Shadow().AnyTimes().Return(shadow)
 	ktctl.EXPECT().Kubernetes().AnyTimes().Return(kubernetes, nil)
@@ -147,3 +156,127 @@ func TestAllocateIP(t *testing.T) {
 		t.Errorf("allocateTunIP() failed, current: %s, want: %s", destIP, "10.1.1.2")
 	}
 }
+
+func TestAllocateIPv6(t *testing.T) {
+	cidr := "fd00:6b74::/126"
+
+	srcIP, destIP, err := allocateTunIP(cidr)
+	if err != nil {
+		t.Errorf("allocateTunIP() error: %v", err)
+	}
+
+	if srcIP != "fd00:6b74::1" {
+		t.Errorf("allocateTunIP() failed, current: %s, want: %s", srcIP, "fd00:6b74::1")
+	}
+
+	if destIP != "fd00:6b74::2" {
+		t.Errorf("allocateTunIP() failed, current: %s, want: %s", destIP, "fd00:6b74::2")
+	}
+}
+
+func Test_checkCidrOverlap(t *testing.T) {
+	clusterCidrs := map[string][]string{"staging": {"10.96.0.0/16", "172.20.0.0/16"}}
+	if err := checkCidrOverlap("dev", []string{"10.100.0.0/16"}, clusterCidrs); err != nil {
+		t.Errorf("checkCidrOverlap() unexpected error %v", err)
+	}
+	if err := checkCidrOverlap("dev", []string{"172.20.1.0/24"}, clusterCidrs); err == nil {
+		t.Errorf("checkCidrOverlap() expected error but got nil")
+	}
+}
+
+func Test_parseContextAlias(t *testing.T) {
+	context, alias := parseContextAlias("arn:aws:eks:us-east-1:123:cluster/prod=prod")
+	if context != "arn:aws:eks:us-east-1:123:cluster/prod" || alias != "prod" {
+		t.Errorf("parseContextAlias() = %s, %s", context, alias)
+	}
+	context, alias = parseContextAlias("staging")
+	if context != "staging" || alias != "staging" {
+		t.Errorf("parseContextAlias() = %s, %s", context, alias)
+	}
+}
+
+func Test_isDNSServedByShadow(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.ConnectOptions.Method = "vpn"
+	if !isDNSServedByShadow(opts) {
+		t.Errorf("dns of vpn method should be served by shadow")
+	}
+	opts.ConnectOptions.DisableDNS = true
+	if isDNSServedByShadow(opts) {
+		t.Errorf("dns should not be served by shadow when disabled")
+	}
+	opts.ConnectOptions.DisableDNS = false
+	opts.ConnectOptions.Method = "socks5"
+	if isDNSServedByShadow(opts) {
+		t.Errorf("dns of socks5 method should not be served by shadow")
+	}
+}
+
+func Test_envsWithDNSOverrides(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.ConnectOptions.DNSOverrides = "tomcat=127.0.0.1"
+	if envs(opts)["DNS_OVERRIDES"] != "tomcat=127.0.0.1" {
+		t.Errorf("dns overrides should be passed to shadow")
+	}
+	opts.RuntimeOptions.IngressHosts = map[string]string{"tomcat": "10.96.0.100", "*.example.com": "10.96.0.100"}
+	if overrides := dnsOverrides(opts); overrides != "*.example.com=10.96.0.100,tomcat=10.96.0.100,tomcat=127.0.0.1" {
+		t.Errorf("dnsOverrides() = %s", overrides)
+	}
+	if hosts := staticHosts(opts); len(hosts) != 1 || hosts["tomcat"] != "127.0.0.1" {
+		t.Errorf("user rules should take precedence and wildcard hosts should be skipped, got %v", hosts)
+	}
+}
+
+func Test_serviceForwards(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.Namespace = "default"
+	opts.ConnectOptions.ClusterDomain = "cluster.local"
+	services := []coreV1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: coreV1.ServiceSpec{ClusterIP: "10.96.0.10", Ports: []coreV1.ServicePort{
+				{Port: 80}, {Port: 53, Protocol: coreV1.ProtocolUDP}, {Port: 443, Protocol: coreV1.ProtocolTCP}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "kafka", Namespace: "data"},
+			Spec:       coreV1.ServiceSpec{ClusterIP: coreV1.ClusterIPNone, Ports: []coreV1.ServicePort{{Port: 9092}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       coreV1.ServiceSpec{Type: coreV1.ServiceTypeExternalName, ExternalName: "db.example.com"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns", Namespace: "default"},
+			Spec: coreV1.ServiceSpec{ClusterIP: "10.96.0.53", Ports: []coreV1.ServicePort{
+				{Port: 53, Protocol: coreV1.ProtocolUDP}}},
+		},
+	}
+	forwards, hosts, loopbackIPs, err := serviceForwards(opts, 1, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantForwards := map[string]string{
+		"127.3.0.1:9092": "kafka.data.svc.cluster.local:9092",
+		"127.3.0.2:80":   "10.96.0.10:80",
+		"127.3.0.2:443":  "10.96.0.10:443",
+	}
+	if !reflect.DeepEqual(forwards, wantForwards) {
+		t.Errorf("forwards = %v, want %v", forwards, wantForwards)
+	}
+	wantHosts := map[string]string{
+		"kafka.data":                "127.3.0.1",
+		"kafka.data.cluster.local":  "127.3.0.1",
+		"web":                       "127.3.0.2",
+		"web.default":               "127.3.0.2",
+		"web.default.cluster.local": "127.3.0.2",
+	}
+	if !reflect.DeepEqual(hosts, wantHosts) {
+		t.Errorf("hosts = %v, want %v", hosts, wantHosts)
+	}
+	if !reflect.DeepEqual(loopbackIPs, map[string]string{"10.96.0.10": "127.3.0.2"}) {
+		t.Errorf("loopbackIPs = %v", loopbackIPs)
+	}
+	if ips := forwardedLoopbackIPs(forwards); !reflect.DeepEqual(ips, []string{"127.3.0.1", "127.3.0.2"}) {
+		t.Errorf("forwardedLoopbackIPs() = %v", ips)
+	}
+}
@@ -2,12 +2,12 @@ package command
 
 import (
 	"errors"
-	"fmt"
 	"os"
 	"strings"
 
 	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt"
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
 	"github.com/alibaba/kt-connect/pkg/kt/connect"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
@@ -78,7 +78,7 @@ func (action *Action) Exchange(deploymentName string, cli kt.CliInterface, optio
 
 	workload := app.GetName() + "-kt-" + strings.ToLower(util.RandomString(5))
 
-	envs := make(map[string]string)
+	envs := map[string]string{common.EnvVarProbePorts: remotePorts(options.ExchangeOptions.Expose)}
 	podIP, podName, sshcm, credential, err := kubernetes.GetOrCreateShadow(workload, options,
 		getExchangeLabels(options, workload, app), getExchangeAnnotation(options), envs)
 	log.Info().Msgf("Create exchange shadow %s in namespace %s", workload, options.Namespace)
@@ -92,6 +92,7 @@ func (action *Action) Exchange(deploymentName string, cli kt.CliInterface, optio
 	options.RuntimeOptions.SSHCM = sshcm
 
 	down := int32(0)
+	cluster.MarkExchanged(app, workload)
 	if err = kubernetes.Scale(app, &down); err != nil {
 		return err
 	}
@@ -115,9 +116,12 @@ func (action *Action) Exchange(deploymentName string, cli kt.CliInterface, optio
 }
 
 func getExchangeAnnotation(options *options.DaemonOptions) map[string]string {
+	config := cluster.ShadowConfig{
+		Origin:   options.RuntimeOptions.Origin,
+		Replicas: options.RuntimeOptions.Replicas,
+	}
 	return map[string]string{
-		common.KTConfig: fmt.Sprintf("app=%s,replicas=%d",
-			options.RuntimeOptions.Origin, options.RuntimeOptions.Replicas),
+		common.KTConfig: config.Annotation(),
 	}
 }
 
@@ -140,3 +144,12 @@ func getExchangeLabels(options *options.DaemonOptions, workload string, origin *
 	labels[common.KTVersion] = splits[len(splits)-1]
 	return labels
 }
+
+// remotePorts shadow side ports of exposed port pairs, e.g. '7001,8080:80' to '7001,80'
+func remotePorts(expose string) string {
+	var ports []string
+	for _, pair := range strings.Split(expose, ",") {
+		ports = append(ports, pair[strings.LastIndex(pair, ":")+1:])
+	}
+	return strings.Join(ports, ",")
+}
@@ -56,3 +56,9 @@ func Test_exchangeCommand(t *testing.T) {
 	}
 
 }
+
+func Test_remotePorts(t *testing.T) {
+	if ports := remotePorts("7001,8080:80"); ports != "7001,80" {
+		t.Errorf("remote ports should be '7001,80', but got '%s'", ports)
+	}
+}
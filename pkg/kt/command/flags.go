@@ -65,6 +65,75 @@ func AppFlags(options *options.DaemonOptions, version string) []cli.Flag {
 			Usage:       "use kubectl for port-forward",
 			Destination: &options.UseKubectl,
 		},
+		cli.StringFlag{
+			Name:        "podPatch",
+			Usage:       "Path of strategic-merge patch file (yaml or json PodTemplateSpec) applied to shadow pod, shadow container is named 'standalone'",
+			Destination: &options.PodPatch,
+		},
+		cli.StringFlag{
+			Name:        "nodeSelector",
+			Usage:       "Node selector of shadow pod e.g. 'key1=val1,key2=val2'",
+			Destination: &options.NodeSelector,
+		},
+		cli.StringFlag{
+			Name:        "podAnnotations",
+			Usage:       "Extra annotations on shadow pod e.g. 'sidecar.istio.io/inject=false'",
+			Destination: &options.PodAnnotations,
+		},
+		cli.StringFlag{
+			Name:        "resources",
+			Usage:       "Resource requests and limits of shadow container e.g. 'requests.cpu=100m,limits.memory=128Mi'",
+			Destination: &options.Resources,
+		},
+		cli.StringFlag{
+			Name:        "imagePullSecrets",
+			Usage:       "Secrets to pull shadow image, use ',' separated",
+			Destination: &options.ImagePullSecrets,
+		},
+		cli.StringFlag{
+			Name:        "priorityClass",
+			Usage:       "Priority class name of shadow pod",
+			Destination: &options.PriorityClass,
+		},
+		cli.BoolFlag{
+			Name:        "restricted",
+			Usage:       "Run shadow pod as non-root without privilege, auto enabled in namespace enforcing 'restricted' pod security",
+			Destination: &options.Restricted,
+		},
+		cli.StringFlag{
+			Name:        "transport",
+			Usage:       "Transport between ktctl and shadow, 'ssh' or 'agent' (multiplexed streams over single connection, only for socks5 method and inbound traffic)",
+			Value:       common.TransportSsh,
+			Destination: &options.Transport,
+		},
+		cli.StringFlag{
+			Name:        "keyType",
+			Usage:       "Type of ssh key used to access shadow, 'rsa' or 'ed25519'",
+			Value:       common.KeyTypeRsa,
+			Destination: &options.KeyType,
+		},
+		cli.BoolFlag{
+			Name:        "cacheKey",
+			Usage:       "Reuse ssh key cached in kt home instead of generating a new one for every session, ssh config map is still created per session",
+			Destination: &options.CacheKey,
+		},
+		cli.IntFlag{
+			Name:        "keyRotation",
+			Usage:       "Days before cached ssh key get regenerated",
+			Value:       7,
+			Destination: &options.KeyRotation,
+		},
+		cli.StringFlag{
+			Name:        "logFormat",
+			Usage:       "Format of log output, 'console' or 'json'",
+			Value:       common.LogFormatConsole,
+			Destination: &options.LogFormat,
+		},
+		cli.StringFlag{
+			Name:        "metricsAddress",
+			Usage:       "Expose prometheus metrics of current session at specified address, e.g. ':9180'",
+			Destination: &options.MetricsAddress,
+		},
 	}
 }
 
@@ -126,10 +195,22 @@ func ConnectActionFlag(options *options.DaemonOptions) []cli.Flag {
 			Value:       "10.1.1.0/30",
 			Destination: &options.ConnectOptions.TunCidr,
 		},
+		cli.StringFlag{
+			Name:        "tunCidr6",
+			Usage:       "The ipv6 cidr used by local tun and peer tun device when cluster has ipv6 network, at least 4 ips. This cidr MUST NOT overlay with kubernetes service cidr and pod cidr",
+			Value:       "fd00:6b74::/126",
+			Destination: &options.ConnectOptions.TunCidr6,
+		},
+		cli.IntFlag{
+			Name:        "tunMtu",
+			Usage:       "The mtu of tun device",
+			Value:       1500,
+			Destination: &options.ConnectOptions.TunMTU,
+		},
 		cli.StringFlag{
 			Name:        "clusterDomain",
 			Usage:       "The cluster domain provided to kubernetes api-server",
-			Value:       "cluster.local",
+			Value:       common.DefaultClusterDomain,
 			Destination: &options.ConnectOptions.ClusterDomain,
 		},
 		cli.StringFlag{
@@ -137,6 +218,37 @@ func ConnectActionFlag(options *options.DaemonOptions) []cli.Flag {
 			Usage:       "Generate .jvmrc file to specified folder",
 			Destination: &options.ConnectOptions.JvmrcDir,
 		},
+		cli.StringSliceFlag{
+			Name:  "context",
+			Usage: "Kubeconfig contexts to connect at the same time, in '<context>' or '<context>=<alias>' format, e.g. --context staging --context dev",
+			Value: &options.ConnectOptions.Contexts,
+		},
+		cli.StringFlag{
+			Name:        "dnsUpstreams",
+			Usage:       "Upstream nameservers of shadow dns server instead of cluster dns, use ',' separated, e.g. '10.96.0.10,10.96.0.11:5353'",
+			Destination: &options.ConnectOptions.DNSUpstreams,
+		},
+		cli.StringFlag{
+			Name:        "dnsForwards",
+			Usage:       "Forward dns queries of specified domains to other nameservers, e.g. 'corp.example.com=10.0.0.2,internal=10.0.0.3:5353'",
+			Destination: &options.ConnectOptions.DNSForwards,
+		},
+		cli.StringFlag{
+			Name:        "dnsOverrides",
+			Usage:       "Resolve specified names to fixed ip, e.g. 'tomcat=127.0.0.1,*.example.com=10.0.0.2', use 127.0.0.1 for locally exchanged service",
+			Destination: &options.ConnectOptions.DNSOverrides,
+		},
+		cli.StringFlag{
+			Name:        "dnsResolver",
+			Usage:       "How shadow resolves cluster names, 'upstream' forwards to cluster dns, 'kubernetes' answers from informer caches of shadow",
+			Value:       common.DnsResolverUpstream,
+			Destination: &options.ConnectOptions.DNSResolver,
+		},
+		cli.StringFlag{
+			Name:        "ingressController",
+			Usage:       "Service of ingress controller in '<namespace>/<name>' format, ingress and http route hosts are resolved to its cluster ip, auto detected if not specified",
+			Destination: &options.ConnectOptions.IngressController,
+		},
 	}
 }
 
@@ -149,9 +261,9 @@ func methodDefaultValue() string {
 
 func methodDefaultUsage() string {
 	if util.IsWindows() {
-		return "Connect method 'socks' or 'socks5'"
+		return "Connect method 'socks', 'socks5' or 'forward'"
 	} else if util.IsLinux() {
-		return "Connect method 'vpn', 'socks', 'socks5' or 'tun'"
+		return "Connect method 'vpn', 'socks', 'socks5', 'tun' or 'forward'"
 	}
-	return "Connect method 'vpn', 'socks' or 'socks5'"
+	return "Connect method 'vpn', 'socks', 'socks5' or 'forward'"
 }
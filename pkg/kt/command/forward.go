@@ -0,0 +1,130 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog/log"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+// setupServiceForwards allocate a loopback ip to each service in namespaces to dump and write them to hosts,
+// tcp ports of service on its loopback ip are forwarded to the service through shadow
+func setupServiceForwards(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) error {
+	var services []coreV1.Service
+	for _, namespace := range namespacesToDump(options) {
+		items, err := kubernetes.GetServices(namespace)
+		if err != nil {
+			return err
+		}
+		services = append(services, items...)
+	}
+	// loopback ips are taken from a block owned by current session, so that concurrent sessions won't collide
+	block, err := util.AllocateLoopbackBlock()
+	if err != nil {
+		return err
+	}
+	options.RuntimeOptions.LoopbackBlock = block
+	forwards, hosts, loopbackIPs, err := serviceForwards(options, block, services)
+	if err != nil {
+		return err
+	}
+	options.RuntimeOptions.ServiceForwards = forwards
+	for _, ip := range forwardedLoopbackIPs(forwards) {
+		if err = util.AddLoopbackAlias(ip); err != nil {
+			return err
+		}
+	}
+
+	// ingress hosts are mapped to cluster ip of ingress controller, which is replaced by its loopback ip
+	for host, ip := range staticHosts(options) {
+		if loopbackIP, exists := loopbackIPs[ip]; exists {
+			ip = loopbackIP
+		}
+		hosts[host] = ip
+	}
+	util.DumpHosts(hosts)
+	options.RuntimeOptions.Dump2Host = true
+	return nil
+}
+
+// serviceForwards get remote endpoint of each local endpoint, hosts of services,
+// and loopback ip in block allocated to each service, indexed by cluster ip of the service
+func serviceForwards(options *options.DaemonOptions, block int, services []coreV1.Service) (
+	forwards, hosts, loopbackIPs map[string]string, err error) {
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].Name < services[j].Name
+	})
+	forwards, hosts, loopbackIPs = map[string]string{}, map[string]string{}, map[string]string{}
+	index := 0
+	for _, svc := range services {
+		ports := tcpPorts(svc)
+		if svc.Spec.Type == coreV1.ServiceTypeExternalName || len(ports) == 0 {
+			continue
+		}
+		loopbackIP, err := util.LoopbackIP(block, index)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		index++
+		// headless service is dialed by name, so that shadow picks one of its endpoints
+		remoteHost := svc.Spec.ClusterIP
+		if remoteHost == coreV1.ClusterIPNone || remoteHost == "" {
+			remoteHost = fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, options.ConnectOptions.ClusterDomain)
+		} else {
+			loopbackIPs[remoteHost] = loopbackIP
+		}
+		for _, port := range ports {
+			local := net.JoinHostPort(loopbackIP, strconv.Itoa(port))
+			forwards[local] = net.JoinHostPort(remoteHost, strconv.Itoa(port))
+			log.Debug().Msgf("Forward %s to %s.%s:%d", local, svc.Name, svc.Namespace, port)
+		}
+		for _, host := range serviceHostNames(options, svc.Name, svc.Namespace) {
+			hosts[host] = loopbackIP
+		}
+	}
+	return
+}
+
+// tcpPorts tcp ports of service, other protocols can't be forwarded
+func tcpPorts(svc coreV1.Service) (ports []int) {
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol == "" || port.Protocol == coreV1.ProtocolTCP {
+			ports = append(ports, int(port.Port))
+		}
+	}
+	return
+}
+
+// cleanupServiceForwards remove loopback ips allocated to services, and release their block
+func cleanupServiceForwards(options *options.DaemonOptions) {
+	for _, ip := range forwardedLoopbackIPs(options.RuntimeOptions.ServiceForwards) {
+		if err := util.RemoveLoopbackAlias(ip); err != nil {
+			log.Warn().Msgf("%s", err)
+		}
+	}
+	if err := util.ReleaseLoopbackBlock(options.RuntimeOptions.LoopbackBlock); err != nil {
+		log.Warn().Msgf("Failed to release loopback block %d: %s", options.RuntimeOptions.LoopbackBlock, err)
+	}
+}
+
+// forwardedLoopbackIPs distinct loopback ips of local endpoints
+func forwardedLoopbackIPs(forwards map[string]string) (ips []string) {
+	found := map[string]bool{}
+	for local := range forwards {
+		if ip, _, err := net.SplitHostPort(local); err == nil && !found[ip] {
+			found[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	return
+}
@@ -0,0 +1,53 @@
+package command
+
+import (
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/rs/zerolog/log"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RunGarbageCollector delete expired shadows of all namespaces periodically, until stop channel closed
+func (action *Action) RunGarbageCollector(kubernetes cluster.KubernetesInterface, options *options.DaemonOptions,
+	interval time.Duration, stop <-chan struct{}) {
+	log.Info().Msgf("Collecting expired shadows every %s, threshold %d minutes", interval, options.CleanOptions.ThresholdInMinus)
+	wait.Until(func() {
+		action.collectGarbage(kubernetes, options)
+	}, interval, stop)
+}
+
+// collectGarbage clean expired shadows namespace by namespace
+func (action *Action) collectGarbage(kubernetes cluster.KubernetesInterface, options *options.DaemonOptions) {
+	deployments, err := kubernetes.GetAllExistingShadowDeployments(metav1.NamespaceAll)
+	if err != nil {
+		log.Error().Msgf("Failed to list shadow deployments: %s", err)
+		return
+	}
+	log.Debug().Msgf("Found %d shadow deployments", len(deployments))
+	resourcesToClean, err := action.analysisResources(kubernetes, metav1.NamespaceAll, deployments, options)
+	if err != nil {
+		log.Error().Msgf("Skip this round: %s", err)
+		return
+	}
+	for namespace, resourceToClean := range resourcesToClean {
+		log.Info().Msgf("Cleaning expired shadows in namespace %s", namespace)
+		action.cleanResource(resourceToClean, kubernetes, namespace)
+	}
+}
+
+// recordEvent emit event of cleaned resource if recorder available
+func (action *Action) recordEvent(kind, apiVersion, namespace, name, reason, message string) {
+	if action.Recorder == nil {
+		return
+	}
+	action.Recorder.Event(&coreV1.ObjectReference{
+		Kind:       kind,
+		APIVersion: apiVersion,
+		Namespace:  namespace,
+		Name:       name,
+	}, coreV1.EventTypeNormal, reason, message)
+}
@@ -0,0 +1,164 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/cluster"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	appV1 "k8s.io/api/apps/v1"
+	coordinationV1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_collectGarbage(t *testing.T) {
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	alive := strconv.FormatInt(time.Now().Unix(), 10)
+	var replicas int32 = 0
+	clientset := fake.NewSimpleClientset(
+		shadowDeployment("expired-exchange", "ns1", common.ComponentExchange, expired, "app=app1,replicas=2"),
+		shadowDeployment("alive-connect", "ns1", common.ComponentConnect, alive, ""),
+		shadowDeployment("expired-connect", "ns2", common.ComponentConnect, expired, ""),
+		&appV1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "ns1"},
+			Spec:       appV1.DeploymentSpec{Replicas: &replicas},
+		},
+		&appV1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app2",
+				Namespace:   "ns3",
+				Labels:      map[string]string{common.KTExchangedBy: "app2-kt-gone"},
+				Annotations: map[string]string{common.KTOriginReplicas: "3"},
+			},
+			Spec: appV1.DeploymentSpec{Replicas: &replicas},
+		},
+		sessionLease("expired-session", "ns4", time.Now().Add(-time.Hour)),
+		sessionLease("alive-session", "ns4", time.Now()),
+		leaseOwnedDeployment("expired-lease-connect", "ns4", "expired-session"),
+		leaseOwnedDeployment("shared-connect", "ns4", "expired-session", "alive-session"),
+	)
+	kubernetes, _ := cluster.CreateFromClientSet(clientset)
+	recorder := record.NewFakeRecorder(20)
+	action := Action{Recorder: recorder}
+	opts := options.NewDaemonOptions()
+	opts.CleanOptions.ThresholdInMinus = 30
+
+	action.collectGarbage(kubernetes, opts)
+
+	for _, d := range []struct{ name, namespace string }{{"expired-exchange", "ns1"}, {"expired-connect", "ns2"}} {
+		if _, err := clientset.AppsV1().Deployments(d.namespace).Get(d.name, metav1.GetOptions{}); err == nil {
+			t.Errorf("deployment %s/%s should be deleted", d.namespace, d.name)
+		}
+	}
+	for _, d := range []struct{ name, namespace string }{{"alive-connect", "ns1"}, {"shared-connect", "ns4"}} {
+		if _, err := clientset.AppsV1().Deployments(d.namespace).Get(d.name, metav1.GetOptions{}); err != nil {
+			t.Errorf("deployment %s/%s should be kept, but got %s", d.namespace, d.name, err)
+		}
+	}
+	if _, err := clientset.AppsV1().Deployments("ns4").Get("expired-lease-connect", metav1.GetOptions{}); err == nil {
+		t.Errorf("deployment expired-lease-connect should be deleted")
+	}
+	leases, _ := clientset.CoordinationV1().Leases("ns4").List(metav1.ListOptions{})
+	if len(leases.Items) != 1 || leases.Items[0].Name != "alive-session" {
+		t.Errorf("only alive-session lease should be kept, but got %v", leases.Items)
+	}
+	app, _ := clientset.AppsV1().Deployments("ns1").Get("app1", metav1.GetOptions{})
+	if *app.Spec.Replicas != 2 {
+		t.Errorf("deployment app1 should be scaled to 2, but is %d", *app.Spec.Replicas)
+	}
+	orphan, _ := clientset.AppsV1().Deployments("ns3").Get("app2", metav1.GetOptions{})
+	if *orphan.Spec.Replicas != 3 || orphan.Labels[common.KTExchangedBy] != "" {
+		t.Errorf("orphaned deployment app2 should be recovered, but is %v", orphan)
+	}
+
+	close(recorder.Events)
+	reasons := map[string]int{}
+	for event := range recorder.Events {
+		reasons[strings.Split(event, " ")[1]]++
+	}
+	if reasons["ShadowDeleted"] != 3 || reasons["SessionLeaseDeleted"] != 1 || reasons["ReplicasRestored"] != 2 {
+		t.Errorf("unexpected events %v", reasons)
+	}
+}
+
+func Test_collectGarbageWithLeaseListFailure(t *testing.T) {
+	var replicas int32 = 0
+	clientset := fake.NewSimpleClientset(
+		sessionLease("alive-session", "ns1", time.Now()),
+		leaseOwnedDeployment("alive-connect", "ns1", "alive-session"),
+		&appV1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app1",
+				Namespace:   "ns1",
+				Labels:      map[string]string{common.KTExchangedBy: "app1-kt-gone"},
+				Annotations: map[string]string{common.KTOriginReplicas: "3"},
+			},
+			Spec: appV1.DeploymentSpec{Replicas: &replicas},
+		},
+	)
+	clientset.PrependReactor("list", "leases", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	kubernetes, _ := cluster.CreateFromClientSet(clientset)
+	opts := options.NewDaemonOptions()
+	opts.CleanOptions.ThresholdInMinus = 30
+
+	(&Action{}).collectGarbage(kubernetes, opts)
+
+	if _, err := clientset.AppsV1().Deployments("ns1").Get("alive-connect", metav1.GetOptions{}); err != nil {
+		t.Errorf("shadow should be kept when leases can't be listed, but got %s", err)
+	}
+	app, _ := clientset.AppsV1().Deployments("ns1").Get("app1", metav1.GetOptions{})
+	if *app.Spec.Replicas != 0 {
+		t.Errorf("nothing should be recovered when leases can't be listed, but app1 scaled to %d", *app.Spec.Replicas)
+	}
+}
+
+func shadowDeployment(name, namespace, component, lastHeartBeat, config string) runtime.Object {
+	return &appV1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				common.ControlBy:   common.KubernetesTool,
+				common.KTComponent: component,
+			},
+			Annotations: map[string]string{
+				common.KTLastHeartBeat: lastHeartBeat,
+				common.KTConfig:        config,
+			},
+		},
+	}
+}
+
+func sessionLease(name, namespace string, renewTime time.Time) runtime.Object {
+	renewed := metav1.NewMicroTime(renewTime)
+	return &coordinationV1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{common.ControlBy: common.KubernetesTool},
+		},
+		Spec: coordinationV1.LeaseSpec{RenewTime: &renewed},
+	}
+}
+
+func leaseOwnedDeployment(name, namespace string, leases ...string) runtime.Object {
+	deployment := shadowDeployment(name, namespace, common.ComponentConnect, "", "").(*appV1.Deployment)
+	for _, lease := range leases {
+		deployment.OwnerReferences = append(deployment.OwnerReferences, metav1.OwnerReference{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Name:       lease,
+		})
+	}
+	return deployment
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/alibaba/kt-connect/pkg/kt/exec/tunnel"
+	"github.com/alibaba/kt-connect/pkg/kt/registry"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog/log"
+)
+
+// mutationReverters undo local mutation of each kind recorded in journal
+var mutationReverters = map[string]func(m util.Mutation) error{
+	util.MutationHosts: func(m util.Mutation) error {
+		util.DropHosts()
+		return nil
+	},
+	util.MutationNameserver: func(m util.Mutation) error {
+		return util.RestoreConfig()
+	},
+	util.MutationTunDevice:   revertTunDevice,
+	util.MutationGlobalProxy: revertGlobalProxy,
+	util.MutationProxyEnv:    revertProxyEnv,
+	util.MutationLoopback: func(m util.Mutation) error {
+		return util.RemoveLoopbackAlias(m.Target)
+	},
+	util.MutationNetns: revertNetns,
+	util.MutationIPForward: func(m util.Mutation) error {
+		return tunnel.RestoreIPForward(tunnel.NativeHost(), tunnel.NativeLink(), "")
+	},
+	util.MutationPidFile: func(m util.Mutation) error {
+		if err := os.Remove(m.Target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	},
+}
+
+// RestoreLocalChanges revert local changes recorded in journals of ktctl processes which exited without cleanup,
+// a journal is kept if any of its change failed to revert, e.g. lack of permission
+func RestoreLocalChanges() {
+	for _, journal := range util.StaleJournals() {
+		log.Info().Msgf("Restoring local changes left by ktctl process %d", journal.Pid)
+		if !revertJournal(journal) {
+			log.Warn().Msgf("Journal %s is kept, please retry with 'ktctl clean --local' as administrator",
+				journal.Path)
+			continue
+		}
+		if err := os.Remove(journal.Path); err != nil {
+			log.Warn().Msgf("Failed to remove journal %s: %s", journal.Path, err)
+		}
+	}
+}
+
+// revertJournal undo mutations in reverse order, return whether all of them succeed
+func revertJournal(journal util.Journal) bool {
+	succeed := true
+	for i := len(journal.Mutations) - 1; i >= 0; i-- {
+		m := journal.Mutations[i]
+		revert, ok := mutationReverters[m.Kind]
+		if !ok {
+			log.Warn().Msgf("Unknown change '%s' in journal, skipped", m.Kind)
+			continue
+		}
+		if err := revert(m); err != nil {
+			log.Warn().Msgf("Failed to revert %s change %s: %s", m.Kind, m.Target, err)
+			succeed = false
+		} else {
+			log.Debug().Msgf("Reverted %s change %s", m.Kind, m.Target)
+		}
+	}
+	return succeed
+}
+
+func revertTunDevice(m util.Mutation) error {
+	if _, err := net.InterfaceByName(m.Target); err != nil {
+		// device already gone with its owner process or network namespace
+		return nil
+	}
+	routes, err := tunnel.RemoveDevice(tunnel.NativeLink(), m.Target)
+	for _, route := range routes {
+		if route.Err != nil {
+			log.Warn().Msgf("Failed to remove route %s: %s", route.Cidr, route.Err)
+		}
+	}
+	return err
+}
+
+func revertGlobalProxy(m util.Mutation) error {
+	var config registry.ProxyConfig
+	if err := json.Unmarshal([]byte(m.Data), &config); err != nil {
+		return fmt.Errorf("invalid proxy config '%s': %s", m.Data, err)
+	}
+	registry.CleanGlobalProxy(&config)
+	return nil
+}
+
+func revertProxyEnv(m util.Mutation) error {
+	var config registry.ProxyConfig
+	if err := json.Unmarshal([]byte(m.Data), &config); err != nil {
+		return fmt.Errorf("invalid proxy config '%s': %s", m.Data, err)
+	}
+	registry.CleanHttpProxyEnvironmentVariable(&config)
+	return nil
+}
+
+func revertNetns(m util.Mutation) error {
+	if errs := tunnel.RemoveNamespace(tunnel.NativeHost(), tunnel.NativeLink(), m.Target, m.Data); len(errs) > 0 {
+		return errs[0]
+	}
+	return util.RemoveNetnsConfig(m.Target)
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+)
+
+func Test_RestoreLocalChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kt-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	originHome := util.KtHome
+	util.KtHome = dir
+	defer func() { util.KtHome = originHome }()
+
+	var reverted []string
+	originReverters := mutationReverters
+	defer func() { mutationReverters = originReverters }()
+	mutationReverters = map[string]func(m util.Mutation) error{
+		util.MutationHosts: func(m util.Mutation) error {
+			reverted = append(reverted, m.Kind)
+			return nil
+		},
+		util.MutationTunDevice: func(m util.Mutation) error {
+			reverted = append(reverted, m.Kind+":"+m.Target)
+			if m.Target == "kt1" {
+				return fmt.Errorf("permission denied")
+			}
+			return nil
+		},
+	}
+
+	util.CreateDirIfNotExist(util.JournalDir())
+	succeedJournal := filepath.Join(util.JournalDir(), "4194304.journal")
+	failedJournal := filepath.Join(util.JournalDir(), "4194305.journal")
+	_ = ioutil.WriteFile(succeedJournal, []byte(`{"kind":"tun","target":"kt0"}
+{"kind":"unknown"}
+{"kind":"hosts"}
+`), 0644)
+	_ = ioutil.WriteFile(failedJournal, []byte(`{"kind":"tun","target":"kt1"}
+`), 0644)
+
+	RestoreLocalChanges()
+	expected := []string{"hosts", "tun:kt0", "tun:kt1"}
+	if !reflect.DeepEqual(reverted, expected) {
+		t.Errorf("changes should be reverted in reverse order, expect %v got %v", expected, reverted)
+	}
+	if _, err = os.Stat(succeedJournal); !os.IsNotExist(err) {
+		t.Errorf("journal should be removed after all changes reverted")
+	}
+	if _, err = os.Stat(failedJournal); err != nil {
+		t.Errorf("journal should be kept when any change failed to revert")
+	}
+}
@@ -82,8 +82,14 @@ func (action *Action) Mesh(deploymentName string, cli kt.CliInterface, options *
 
 	workload := app.GetObjectMeta().GetName() + "-kt-" + meshVersion
 	labels := getMeshLabels(workload, meshVersion, app, options)
+	config := cluster.ShadowConfig{Origin: app.GetName(), Subset: meshVersion}
+	annotations := map[string]string{
+		common.KTConfig: config.Annotation(),
+	}
+	// subset may be added to istio destination rules by user, which should be removed when exit
+	options.RuntimeOptions.Subset = meshVersion
 
-	err = createShadowAndInbound(workload, labels, options, kubernetes)
+	err = createShadowAndInbound(workload, labels, annotations, options, kubernetes)
 	if err != nil {
 		return err
 	}
@@ -106,11 +112,10 @@ func (action *Action) Mesh(deploymentName string, cli kt.CliInterface, options *
 	return nil
 }
 
-func createShadowAndInbound(workload string, labels map[string]string, options *options.DaemonOptions,
+func createShadowAndInbound(workload string, labels, annotations map[string]string, options *options.DaemonOptions,
 	kubernetes cluster.KubernetesInterface) error {
 
 	envs := make(map[string]string)
-	annotations := make(map[string]string)
 	podIP, podName, sshcm, credential, err := kubernetes.GetOrCreateShadow(workload, options, labels, annotations, envs)
 	if err != nil {
 		return err
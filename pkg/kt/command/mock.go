@@ -146,3 +146,17 @@ func (mr *MockActionInterfaceMockRecorder) Provide(serviceName, cli, options int
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Provide", reflect.TypeOf((*MockActionInterface)(nil).Provide), serviceName, cli, options)
 }
+
+// Run mocks base method.
+func (m *MockActionInterface) Run(command []string, cli kt.CliInterface, options *options.DaemonOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Run", command, cli, options)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Run indicates an expected call of Run.
+func (mr *MockActionInterfaceMockRecorder) Run(command, cli, options interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockActionInterface)(nil).Run), command, cli, options)
+}
@@ -93,8 +93,9 @@ func provide(serviceName string, cli kt.CliInterface, options *options.DaemonOpt
 		common.KTName:      deploymentName,
 		common.KTVersion:   version,
 	}
+	config := cluster.ShadowConfig{Service: serviceName}
 	annotations := map[string]string{
-		common.KTConfig: fmt.Sprintf("service=%s", serviceName),
+		common.KTConfig: config.Annotation(),
 	}
 
 	// extra labels must be applied after origin labels
@@ -109,7 +110,7 @@ func provide(serviceName string, cli kt.CliInterface, options *options.DaemonOpt
 func exposeLocalService(serviceName, deploymentName string, labels, annotations map[string]string,
 	options *options.DaemonOptions, kubernetes cluster.KubernetesInterface, cli kt.CliInterface) (err error) {
 
-	envs := make(map[string]string)
+	envs := map[string]string{common.EnvVarProbePorts: strconv.Itoa(options.ProvideOptions.Expose)}
 	podIP, podName, sshcm, credential, err := kubernetes.GetOrCreateShadow(deploymentName, options, labels, annotations, envs)
 	if err != nil {
 		return err
@@ -117,7 +118,8 @@ func exposeLocalService(serviceName, deploymentName string, labels, annotations
 	log.Info().Msgf("Create shadow pod %s ip %s", podName, podIP)
 
 	log.Info().Msgf("Expose deployment %s to service %s:%v", deploymentName, serviceName, options.ProvideOptions.Expose)
-	_, err = kubernetes.CreateService(serviceName, options.Namespace, options.ProvideOptions.External, options.ProvideOptions.Expose, labels)
+	_, err = kubernetes.CreateService(serviceName, options.Namespace, options.ProvideOptions.External, options.ProvideOptions.Expose, labels,
+		deploymentName)
 	if err != nil {
 		return err
 	}
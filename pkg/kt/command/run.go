@@ -0,0 +1,151 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	osExec "os/exec"
+	"strings"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	urfave "github.com/urfave/cli"
+)
+
+// connect flags which also apply to run command
+var runFlagNames = []string{"sshPort", "disableDNS", "cidr", "shareShadow", "tunCidr", "tunCidr6", "clusterDomain",
+	"dnsUpstreams", "dnsForwards", "dnsOverrides", "dnsResolver", "global"}
+
+// newRunCommand return new run command
+func newRunCommand(cli kt.CliInterface, options *options.DaemonOptions, action ActionInterface) urfave.Command {
+	return urfave.Command{
+		Name:      "run",
+		Usage:     "run a command which can access kubernetes cluster, without changing network of host (linux only)",
+		ArgsUsage: "-- <command> [args...]",
+		Flags:     runActionFlags(options),
+		Action: func(c *urfave.Context) error {
+			if options.Debug {
+				zerolog.SetGlobalLevel(zerolog.DebugLevel)
+			}
+			if len(c.Args()) == 0 {
+				return errors.New("command to run is required, e.g. 'ktctl run -- curl http://tomcat:8080'")
+			}
+			if err := combineKubeOpts(options); err != nil {
+				return err
+			}
+			return action.Run(c.Args(), cli, options)
+		},
+	}
+}
+
+func runActionFlags(options *options.DaemonOptions) (flags []urfave.Flag) {
+	for _, flag := range ConnectActionFlag(options) {
+		for _, name := range runFlagNames {
+			if flag.GetName() == name {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return
+}
+
+// Run run command in a network namespace connected to kubernetes cluster
+func (action *Action) Run(command []string, cli kt.CliInterface, options *options.DaemonOptions) error {
+	if !util.IsLinux() {
+		return errors.New("run command is only supported on linux")
+	}
+	if options.Transport == common.TransportAgent || options.Restricted {
+		return errors.New("run command requires ssh transport and privileged shadow")
+	}
+	options.RuntimeOptions.Component = common.ComponentRun
+	if err := util.WritePidFile(common.ComponentRun); err != nil {
+		return err
+	}
+	log.Info().Msgf("KtConnect start at %d", os.Getpid())
+
+	if err := completeRunOptions(options); err != nil {
+		return err
+	}
+	SetUpCloseHandler(cli, options, common.ComponentRun)
+	kubernetes, err := cli.Kubernetes()
+	if err != nil {
+		return err
+	}
+	endPointIP, podName, credential, err := getOrCreateShadow(options, err, kubernetes)
+	if err != nil {
+		return err
+	}
+	cidrs, err := kubernetes.ClusterCidrs(options.Namespace, options.ConnectOptions)
+	if err != nil {
+		return err
+	}
+	if err = cli.Shadow().Outbound(podName, endPointIP, credential, cidrs, cli.Exec()); err != nil {
+		return err
+	}
+
+	if ns := options.RuntimeOptions.Namespace; ns != nil {
+		log.Info().Msgf("Traffic outside cluster cidrs %s goes via host with nat, host is reachable at the first address of %s",
+			strings.Join(cidrs, ","), ns.Subnet)
+	}
+	cmd := cli.Exec().Tunnel().RunInNetns(command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	log.Info().Msgf("Running '%s' in network namespace %s", strings.Join(command, " "), options.RuntimeOptions.Netns)
+	err = cmd.Run()
+	CleanupWorkspace(cli, options)
+	if exitErr, ok := err.(*osExec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+// completeRunOptions allocate network namespace, tun device and its addresses of current session
+func completeRunOptions(options *options.DaemonOptions) error {
+	options.RuntimeOptions.Netns = "kt-" + strings.ToLower(util.RandomString(5))
+	options.ConnectOptions.TunName = freeTunName()
+	srcIP, destIP, err := allocateTunIP(options.ConnectOptions.TunCidr)
+	if err != nil {
+		return err
+	}
+	options.ConnectOptions.SourceIP, options.ConnectOptions.DestIP = srcIP, destIP
+	if options.ConnectOptions.TunCidr6 != "" {
+		srcIP6, destIP6, err := allocateTunIP(options.ConnectOptions.TunCidr6)
+		if err != nil {
+			return err
+		}
+		options.ConnectOptions.SourceIP6, options.ConnectOptions.DestIP6 = srcIP6, destIP6
+	}
+	return nil
+}
+
+// freeTunName first tun device name not used in host, the device only stays in host until moved into network namespace
+func freeTunName() string {
+	used := map[string]bool{}
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, i := range interfaces {
+			used[i.Name] = true
+		}
+	}
+	for index := 0; ; index++ {
+		if name := fmt.Sprintf("tun%d", index); !used[name] {
+			return name
+		}
+	}
+}
+
+// cleanupNetns remove network namespace created by run command with its veth pair and nat rules,
+// tun device in it is removed as well
+func cleanupNetns(options *options.DaemonOptions) {
+	if ns := options.RuntimeOptions.Namespace; ns != nil {
+		if errs := ns.Rollback(); len(errs) > 0 {
+			log.Error().Msgf("Failed to remove network namespace %s completely", ns.Name)
+		}
+	}
+	if err := util.RemoveNetnsConfig(options.RuntimeOptions.Netns); err != nil {
+		log.Error().Err(err).Msgf("Failed to remove config of network namespace %s", options.RuntimeOptions.Netns)
+	}
+}
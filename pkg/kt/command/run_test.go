@@ -0,0 +1,73 @@
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/alibaba/kt-connect/pkg/kt"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/golang/mock/gomock"
+	"github.com/urfave/cli"
+)
+
+func Test_newRunCommand(t *testing.T) {
+	ctl := gomock.NewController(t)
+	fakeKtCli := kt.NewMockCliInterface(ctl)
+	mockAction := NewMockActionInterface(ctl)
+
+	mockAction.EXPECT().Run([]string{"curl", "http://tomcat:8080"}, fakeKtCli, gomock.Any()).Return(nil)
+
+	cases := []struct {
+		testArgs    []string
+		expectedErr bool
+	}{
+		{testArgs: []string{"run", "curl", "http://tomcat:8080"}, expectedErr: false},
+		{testArgs: []string{"run"}, expectedErr: true},
+	}
+
+	for _, c := range cases {
+		app := &cli.App{Writer: ioutil.Discard}
+		set := flag.NewFlagSet("test", 0)
+		_ = set.Parse(c.testArgs)
+		context := cli.NewContext(app, set, nil)
+
+		opts := options.NewDaemonOptions()
+		command := newRunCommand(fakeKtCli, opts, mockAction)
+		if err := command.Run(context); (err != nil) != c.expectedErr {
+			t.Errorf("args %v, expected error %v but is %v", c.testArgs, c.expectedErr, err)
+		}
+	}
+}
+
+func Test_runActionFlags(t *testing.T) {
+	var names []string
+	for _, flag := range runActionFlags(options.NewDaemonOptions()) {
+		names = append(names, flag.GetName())
+	}
+	if len(names) != len(runFlagNames) {
+		t.Errorf("flags of run command = %v, want %v", names, runFlagNames)
+	}
+	for _, name := range []string{"method", "dump2hosts", "proxyPort"} {
+		for _, n := range names {
+			if n == name {
+				t.Errorf("flag %s should not apply to run command", name)
+			}
+		}
+	}
+}
+
+func Test_completeRunOptions(t *testing.T) {
+	opts := options.NewDaemonOptions()
+	opts.ConnectOptions.TunCidr = "10.1.1.0/30"
+	if err := completeRunOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.RuntimeOptions.Netns) != len("kt-abcde") || opts.ConnectOptions.TunName == "" {
+		t.Errorf("netns %s and tun %s should be allocated", opts.RuntimeOptions.Netns, opts.ConnectOptions.TunName)
+	}
+	if got := []string{opts.ConnectOptions.SourceIP, opts.ConnectOptions.DestIP}; !reflect.DeepEqual(got, []string{"10.1.1.1", "10.1.1.2"}) {
+		t.Errorf("tun ips = %v", got)
+	}
+}
@@ -3,12 +3,14 @@ package command
 import (
 	"github.com/alibaba/kt-connect/pkg/kt"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"k8s.io/client-go/tools/record"
 )
 
 // ActionInterface all action defined
 type ActionInterface interface {
 	OpenDashboard(cli kt.CliInterface, options *options.DaemonOptions) error
 	Connect(cli kt.CliInterface, options *options.DaemonOptions) error
+	Run(command []string, cli kt.CliInterface, options *options.DaemonOptions) error
 	Check(cli kt.CliInterface) error
 	Provide(serviceName string, cli kt.CliInterface, options *options.DaemonOptions) error
 	Exchange(deploymentName string, cli kt.CliInterface, options *options.DaemonOptions) error
@@ -20,4 +22,6 @@ type ActionInterface interface {
 // Action cmd action
 type Action struct {
 	Options *options.DaemonOptions
+	// Recorder emit kubernetes events when cleaning resources, optional
+	Recorder record.EventRecorder
 }
@@ -5,10 +5,10 @@ import (
 	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt"
 	"github.com/alibaba/kt-connect/pkg/kt/cluster"
-	"github.com/alibaba/kt-connect/pkg/kt/exec"
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/registry"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/alibaba/kt-connect/pkg/metrics"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli"
 	"k8s.io/client-go/kubernetes"
@@ -17,8 +17,12 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// max time to wait for running hosts refresh before dropping hosts
+const hostsRefreshWaitTimeout = 5 * time.Second
+
 // NewCommands return new Connect Action
 func NewCommands(kt kt.CliInterface, action ActionInterface, options *options.DaemonOptions) []cli.Command {
 	return []cli.Command{
@@ -29,7 +33,19 @@ func NewCommands(kt kt.CliInterface, action ActionInterface, options *options.Da
 		newCleanCommand(kt, options, action),
 		newDashboardCommand(kt, options, action),
 		newCheckCommand(kt, options, action),
+		newRunCommand(kt, options, action),
+	}
+}
+
+// SetUpLogAndMetrics apply log format and start metrics endpoint specified by global options
+func SetUpLogAndMetrics(options *options.DaemonOptions) error {
+	if err := common.SetupLogger(options.LogFormat, util.IsWindows()); err != nil {
+		return err
+	}
+	if options.MetricsAddress != "" {
+		metrics.Serve(options.MetricsAddress)
 	}
+	return nil
 }
 
 // SetUpWaitingChannel registry waiting channel
@@ -60,21 +76,69 @@ func CleanupWorkspace(cli kt.CliInterface, options *options.DaemonOptions) {
 	}
 
 	log.Info().Msgf("Cleaning workspace")
+	defer util.CloseJournal()
 	cleanLocalFiles(options)
-	removePrivateKey(options)
 
+	if options.RuntimeOptions.StopHostsRefresh != nil {
+		close(options.RuntimeOptions.StopHostsRefresh)
+		waitHostsRefreshDone(options.RuntimeOptions.HostsRefreshDone)
+	}
 	if options.RuntimeOptions.Dump2Host {
+		// refresh not finished in time won't dump hosts again after dropped
+		util.StopDumpHosts()
 		util.DropHosts()
 	}
+	if options.ConnectOptions.Method == common.ConnectMethodForward {
+		cleanupServiceForwards(options)
+	}
+	if options.RuntimeOptions.Netns != "" {
+		cleanupNetns(options)
+	}
 	if options.ConnectOptions.Method == common.ConnectMethodSocks {
 		registry.CleanGlobalProxy(&options.RuntimeOptions.ProxyConfig)
 		registry.CleanHttpProxyEnvironmentVariable(&options.RuntimeOptions.ProxyConfig)
 	}
 
+	if len(options.RuntimeOptions.Clusters) > 0 {
+		for _, clusterOptions := range options.RuntimeOptions.Clusters {
+			log.Info().Msgf("Cleaning context %s", clusterOptions.RuntimeOptions.Context)
+			cleanupCluster(&kt.Cli{Options: clusterOptions}, clusterOptions)
+		}
+		if err := util.RestoreConfig(); err != nil {
+			log.Error().Msgf("Restore resolv.conf failed, error: %s", err)
+		}
+		return
+	}
+	cleanupCluster(cli, options)
+}
+
+// cleanupCluster clean tun device and shadow resources of one cluster
+// waitHostsRefreshDone wait for running hosts refresh, which may be slow when api server is unreachable
+func waitHostsRefreshDone(done <-chan struct{}) {
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(hostsRefreshWaitTimeout):
+		log.Warn().Msgf("Hosts refresh not finished in %s, dropping hosts anyway", hostsRefreshWaitTimeout)
+	}
+}
+
+func cleanupCluster(cli kt.CliInterface, options *options.DaemonOptions) {
+	removePrivateKey(options)
+
 	if options.ConnectOptions.Method == common.ConnectMethodTun {
-		err := exec.RunAndWait(cli.Exec().Tunnel().RemoveDevice(), "del_device")
+		routes, err := cli.Exec().Tunnel().Teardown()
+		for _, route := range routes {
+			if route.Err != nil {
+				log.Error().Msgf("Failed to remove route %s: %s", route.Cidr, route.Err)
+			} else {
+				log.Info().Msgf("Route %s removed", route.Cidr)
+			}
+		}
 		if err != nil {
-			log.Error().Msgf("Fails to delete tun device")
+			log.Error().Msgf("Fails to delete tun device: %s", err)
 			return
 		}
 
@@ -95,7 +159,7 @@ func CleanupWorkspace(cli kt.CliInterface, options *options.DaemonOptions) {
 
 	if len(options.RuntimeOptions.Origin) > 0 {
 		log.Info().Msgf("Recovering origin deployment %s", options.RuntimeOptions.Origin)
-		err := kubernetes.ScaleTo(options.RuntimeOptions.Origin, options.Namespace, &options.RuntimeOptions.Replicas)
+		err := kubernetes.Recover(options.RuntimeOptions.Origin, options.Namespace, options.RuntimeOptions.Replicas)
 		if err != nil {
 			log.Error().
 				Str("namespace", options.Namespace).
@@ -103,8 +167,25 @@ func CleanupWorkspace(cli kt.CliInterface, options *options.DaemonOptions) {
 		}
 	}
 
-	cleanDeploymentAndConfigMap(options, kubernetes)
-	cleanService(options, kubernetes)
+	if options.RuntimeOptions.Subset != "" {
+		if err = kubernetes.RemoveDestinationRuleSubset(options.RuntimeOptions.Subset, options.Namespace); err != nil {
+			log.Error().Err(err).Msgf("Remove subset %s from destination rules failed", options.RuntimeOptions.Subset)
+		}
+	}
+
+	// config map and service are owned by shadow deployment, which will be deleted by garbage collector
+	cleanDeployment(options, kubernetes)
+	cleanLease(options, kubernetes)
+}
+
+func cleanLease(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) {
+	if options.RuntimeOptions.Lease != nil {
+		log.Info().Msgf("Cleaning session lease %s", options.RuntimeOptions.Lease.Name)
+		err := kubernetes.RemoveLease(options.RuntimeOptions.Lease.Name, options.Namespace)
+		if err != nil {
+			log.Error().Err(err).Msgf("Delete lease %s failed", options.RuntimeOptions.Lease.Name)
+		}
+	}
 }
 
 func cleanLocalFiles(options *options.DaemonOptions) {
@@ -126,48 +207,30 @@ func cleanLocalFiles(options *options.DaemonOptions) {
 	}
 }
 
-func cleanService(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) {
-	if options.RuntimeOptions.Service != "" {
-		log.Info().Msgf("Cleaning service %s", options.RuntimeOptions.Service)
-		err := kubernetes.RemoveService(options.RuntimeOptions.Service, options.Namespace)
-		if err != nil {
-			log.Error().Err(err).Msgf("Delete service %s failed", options.RuntimeOptions.Service)
-		}
-	}
-}
-
-func cleanDeploymentAndConfigMap(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) {
-	shouldDelWithShared := false
-	var err error
+func cleanDeployment(options *options.DaemonOptions, kubernetes cluster.KubernetesInterface) {
 	if options.RuntimeOptions.Shadow != "" {
 		if options.ConnectOptions != nil && options.ConnectOptions.ShareShadow {
-			shouldDelWithShared, err = decreaseRefOrRemoveTheShadow(kubernetes, options)
+			_, err := decreaseRefOrRemoveTheShadow(kubernetes, options)
 			if err != nil {
 				log.Error().Err(err).Msgf("Delete shared deployment %s failed", options.RuntimeOptions.Shadow)
 			}
 		} else {
 			log.Info().Msgf("Cleaning shadow %s", options.RuntimeOptions.Shadow)
-			err = kubernetes.RemoveDeployment(options.RuntimeOptions.Shadow, options.Namespace)
+			err := kubernetes.RemoveDeployment(options.RuntimeOptions.Shadow, options.Namespace)
 			if err != nil {
 				log.Error().Err(err).Msgf("Delete deployment %s failed", options.RuntimeOptions.Shadow)
 			}
 		}
 	}
-
-	if options.RuntimeOptions.SSHCM != "" && options.ConnectOptions != nil {
-		if shouldDelWithShared || !options.ConnectOptions.ShareShadow {
-			log.Info().Msgf("Cleaning config map %s", options.RuntimeOptions.SSHCM)
-			err = kubernetes.RemoveConfigMap(options.RuntimeOptions.SSHCM, options.Namespace)
-			if err != nil {
-				log.Error().Err(err).Msgf("Delete configmap %s failed", options.RuntimeOptions.SSHCM)
-			}
-		}
-	}
 }
 
 // decreaseRefOrRemoveTheShadow
 func decreaseRefOrRemoveTheShadow(kubernetes cluster.KubernetesInterface, options *options.DaemonOptions) (bool, error) {
-	return kubernetes.DecreaseRef(options.Namespace, options.RuntimeOptions.Shadow)
+	lease := ""
+	if options.RuntimeOptions.Lease != nil {
+		lease = options.RuntimeOptions.Lease.Name
+	}
+	return kubernetes.DecreaseRef(options.Namespace, options.RuntimeOptions.Shadow, lease)
 }
 
 // removePrivateKey remove the private key of ssh
@@ -177,10 +240,14 @@ func removePrivateKey(options *options.DaemonOptions) {
 	}
 	splits := strings.Split(options.RuntimeOptions.SSHCM, "-")
 	component, version := splits[1], splits[len(splits)-1]
-	file := util.PrivateKeyPath(component, version)
+	file := util.PrivateKeyPath(component, version, options.KeyType)
 	if err := os.Remove(file); os.IsNotExist(err) {
 		log.Error().Err(err).Msgf("Can't delete %s", file)
 	}
+	if options.CacheKey {
+		// cached key is kept for later sessions until expired
+		util.CleanCachedKeys(time.Duration(options.KeyRotation) * 24 * time.Hour)
+	}
 }
 
 // validateKubeOpts support like '-n default | --kubeconfig=/path/to/kubeconfig'
@@ -3,6 +3,7 @@ package connect
 import (
 	"fmt"
 	"github.com/alibaba/kt-connect/pkg/kt/exec"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,48 +14,52 @@ import (
 )
 
 // Inbound mapping local port from cluster
-func (s *Shadow) Inbound(exposePorts, podName, remoteIP string, _ *util.SSHCredential) (err error) {
-	return inbound(s, exposePorts, podName, remoteIP, &sshchannel.SSHChannel{}, &exec.Cli{})
+func (s *Shadow) Inbound(exposePorts, podName, remoteIP string, credential *util.SSHCredential) (err error) {
+	cli := &exec.Cli{Transport: s.Options.Transport}
+	return inbound(s, exposePorts, podName, remoteIP, credential, cli.SshChannel(), cli)
 }
 
-func inbound(s *Shadow, exposePorts, podName, remoteIP string, ssh sshchannel.Channel, cli exec.CliInterface) (err error) {
+func inbound(s *Shadow, exposePorts, podName, remoteIP string, credential *util.SSHCredential,
+	ssh sshchannel.Channel, cli exec.CliInterface) (err error) {
 	log.Info().Msgf("Remote %s forward to local %s", remoteIP, exposePorts)
 	localSSHPort, err := strconv.Atoi(util.GetRandomSSHPort(remoteIP))
 	if err != nil {
 		return
 	}
+	certificate, err := sshCertificate(credential)
+	if err != nil {
+		return
+	}
 
 	_, _, err = forwardSSHTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName, localSSHPort)
 	if err != nil {
 		return
 	}
 
-	exposeLocalPorts(ssh, exposePorts, localSSHPort)
+	exposeLocalPorts(ssh, certificate, exposePorts, remoteIP, localSSHPort)
 	return nil
 }
 
-func exposeLocalPorts(ssh sshchannel.Channel, exposePorts string, localSSHPort int) {
+func exposeLocalPorts(ssh sshchannel.Channel, certificate *sshchannel.Certificate, exposePorts, remoteIP string, localSSHPort int) {
 	var wg sync.WaitGroup
 	// supports multi port pairs
 	portPairs := strings.Split(exposePorts, ",")
 	for _, exposePort := range portPairs {
-		exposeLocalPort(&wg, ssh, exposePort, localSSHPort)
+		exposeLocalPort(&wg, ssh, certificate, exposePort, remoteIP, localSSHPort)
 	}
 	wg.Wait()
 }
 
-func exposeLocalPort(wg *sync.WaitGroup, ssh sshchannel.Channel, exposePort string, localSSHPort int) {
+func exposeLocalPort(wg *sync.WaitGroup, ssh sshchannel.Channel, certificate *sshchannel.Certificate,
+	exposePort, remoteIP string, localSSHPort int) {
 	localPort, remotePort := getPortMapping(exposePort)
 	wg.Add(1)
 	go func(wg *sync.WaitGroup) {
 		log.Debug().Msgf("Exposing remote pod:%s to local port localhost:%s", remotePort, localPort)
 		err := ssh.ForwardRemoteToLocal(
-			&sshchannel.Certificate{
-				Username: "root",
-				Password: "root",
-			},
+			certificate,
 			fmt.Sprintf("127.0.0.1:%d", localSSHPort),
-			fmt.Sprintf("0.0.0.0:%s", remotePort),
+			net.JoinHostPort(util.AnyAddress(remoteIP), remotePort),
 			fmt.Sprintf("127.0.0.1:%s", localPort),
 		)
 		if err != nil {
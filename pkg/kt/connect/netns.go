@@ -0,0 +1,159 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/kt/exec"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/tunnel"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// max time to wait for ssh attaching to tun device
+	tunAttachTimeout = 10 * time.Second
+	// first /30 subnet of veth pair between network namespace and host, in link local range to avoid conflicts
+	vethCidr = "169.254.231.0/30"
+	// max count of network namespaces connected at the same time
+	maxVethSubnets = 64
+)
+
+// interfaceAddrs addresses of host devices
+var interfaceAddrs = net.InterfaceAddrs
+
+// netnsLockDir locked while allocating veth subnet and creating network namespace
+var netnsLockDir = tunnel.NetnsDir
+
+// tunCarrier read carrier state of tun device, which is on once a process attached to it
+var tunCarrier = func(tunName string) string {
+	content, _ := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/carrier", tunName))
+	return strings.TrimSpace(string(content))
+}
+
+// startNetnsConnection connect a network namespace to cluster, tun device is created and attached by ssh in host,
+// then moved into the network namespace with routes and nameserver, so that host network is not changed at all,
+// other traffic of the network namespace goes out via a veth pair to host with nat
+func startNetnsConnection(rootCtx context.Context, cli exec.CliInterface, credential *util.SSHCredential,
+	options *options.DaemonOptions, podIP string, cidrs []string, stop chan struct{}) (err error) {
+	ns, err := createNamespace(cli, options.RuntimeOptions.Netns)
+	if err != nil {
+		return
+	}
+	options.RuntimeOptions.Namespace = ns
+	defer func() {
+		if err != nil {
+			ns.Rollback()
+			options.RuntimeOptions.Namespace = nil
+		}
+	}()
+	log.Info().Msgf("Add network namespace %s with veth subnet %s successful", ns.Name, ns.Subnet)
+
+	// 1. Create tun device in host, ssh must attach to it before it's moved away
+	util.RecordMutation(util.MutationTunDevice, options.ConnectOptions.TunName, "")
+	if err = ns.AddTun(options.ConnectOptions.TunName, options.ConnectOptions.TunMTU); err != nil {
+		return
+	}
+	err = exec.BackgroundRunWithCtx(&exec.CMDContext{
+		Ctx:  rootCtx,
+		Cmd:  cli.SSH().TunnelToRemote(util.TunIndex(options.ConnectOptions.TunName), credential.RemoteHost, credential.PrivateKeyPath, options.ConnectOptions.SSHPort),
+		Name: "ssh_tun",
+		Stop: stop,
+	})
+	if err != nil {
+		return
+	}
+	if err = waitTunAttached(options.ConnectOptions.TunName); err != nil {
+		return
+	}
+	log.Info().Msgf("Create ssh tun successful")
+
+	// 2. Move tun device into network namespace, where its address is lost and should be set again
+	withIPv6 := options.ConnectOptions.SourceIP6 != "" && hasIPv6Cidr(cidrs)
+	addresses := cli.Tunnel().Device(withIPv6).Addresses
+	if err = ns.MoveTun(options.ConnectOptions.TunName, addresses, cidrs); err != nil {
+		return
+	}
+	log.Info().Msgf("Add routes %s in %s successful", strings.Join(cidrs, ","), ns.Name)
+
+	// 3. Point resolv.conf of network namespace to shadow
+	if !options.ConnectOptions.DisableDNS {
+		if err = util.SetupNetnsResolvConf(ns.Name, podIP); err != nil {
+			return
+		}
+		log.Info().Msgf("Add nameserver %s in %s successful", podIP, ns.Name)
+	}
+	return nil
+}
+
+// createNamespace create network namespace with veth pair in a free subnet,
+// subnets are allocated under lock so that concurrent run commands won't take the same one
+func createNamespace(cli exec.CliInterface, name string) (*tunnel.Namespace, error) {
+	if err := os.MkdirAll(netnsLockDir, 0755); err != nil {
+		return nil, err
+	}
+	unlock, err := util.LockFile(netnsLockDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	subnet, err := freeVethSubnet()
+	if err != nil {
+		return nil, err
+	}
+	ns := cli.Tunnel().Namespace(subnet)
+	if !ns.ForwardEnabled() {
+		// recorded before namespace, so that it's reverted after veth pair removed
+		util.RecordMutation(util.MutationIPForward, "ipv4", "")
+	}
+	util.RecordMutation(util.MutationNetns, name, subnet)
+	if err = ns.Create(); err != nil {
+		ns.Rollback()
+		return nil, err
+	}
+	return ns, nil
+}
+
+// freeVethSubnet first /30 subnet from vethCidr which doesn't overlap addresses of host
+func freeVethSubnet() (string, error) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < maxVethSubnets; i++ {
+		subnet, err := util.ShiftCidr(vethCidr, i)
+		if err != nil {
+			return "", err
+		}
+		_, ipNet, _ := net.ParseCIDR(subnet)
+		used := false
+		for _, addr := range addrs {
+			if ip, _, err := net.ParseCIDR(addr.String()); err == nil && ipNet.Contains(ip) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return subnet, nil
+		}
+	}
+	return "", fmt.Errorf("no free subnet for veth pair after %s", vethCidr)
+}
+
+// waitTunAttached wait until ssh attached to tun device
+func waitTunAttached(tunName string) error {
+	deadline := time.Now().Add(tunAttachTimeout)
+	for tunCarrier(tunName) != "1" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for ssh attaching to %s", tunName)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
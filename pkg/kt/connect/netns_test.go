@@ -0,0 +1,148 @@
+package connect
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	fakeExec "github.com/alibaba/kt-connect/pkg/kt/exec"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/portforward"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/ssh"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/tunnel"
+	"github.com/alibaba/kt-connect/pkg/kt/options"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+	"github.com/golang/mock/gomock"
+)
+
+func Test_shouldConnectNetnsToCluster(t *testing.T) {
+	ctl := gomock.NewController(t)
+	execCli := fakeExec.NewMockCliInterface(ctl)
+	hostTunnel := tunnel.NewMockCliInterface(ctl)
+	sshCli := ssh.NewMockCliInterface(ctl)
+	portForward := portforward.NewMockCliInterface(ctl)
+
+	original := tunCarrier
+	defer func() { tunCarrier = original }()
+	tunCarrier = func(string) string { return "1" }
+
+	dir, err := ioutil.TempDir("", "kt-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	originHome := util.KtHome
+	util.KtHome = dir
+	defer func() { util.KtHome = originHome }()
+
+	originLockDir := netnsLockDir
+	netnsLockDir = dir
+	defer func() { netnsLockDir = originLockDir }()
+	originAddrs := interfaceAddrs
+	interfaceAddrs = func() ([]net.Addr, error) { return nil, nil }
+	defer func() { interfaceAddrs = originAddrs }()
+
+	inner := &nopLink{}
+	host := &nopHost{inner: inner}
+	link := &nopLink{}
+	ok := func() *exec.Cmd { return exec.Command("true") }
+	hostTunnel.EXPECT().Namespace("169.254.231.0/30").
+		Return(tunnel.NewNamespace(host, link, "kt-abcde", "169.254.231.0/30"))
+	hostTunnel.EXPECT().Device(false).Return(tunnel.NewDevice(link, "tun1", 0, []string{"10.1.1.1/30"}))
+	sshCli.EXPECT().TunnelToRemote(1, "127.0.0.1", "/tmp/key", 2222).Return(ok())
+	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), "name", common.SshPort, 2222).Return(make(chan struct{}), nil, nil)
+	execCli.EXPECT().Tunnel().AnyTimes().Return(hostTunnel)
+	execCli.EXPECT().SSH().AnyTimes().Return(sshCli)
+	execCli.EXPECT().PortForward().AnyTimes().Return(portForward)
+	execCli.EXPECT().Kubectl().AnyTimes().Return(nil)
+
+	runOptions := options.NewDaemonOptions()
+	runOptions.RuntimeOptions.Netns = "kt-abcde"
+	runOptions.ConnectOptions.TunName = "tun1"
+	runOptions.ConnectOptions.SSHPort = 2222
+	runOptions.ConnectOptions.DisableDNS = true
+
+	s := &Shadow{Options: runOptions}
+	credential := &util.SSHCredential{RemoteHost: "127.0.0.1", PrivateKeyPath: "/tmp/key"}
+	if err := outbound(s, "name", "172.168.0.2", credential, []string{"10.96.0.0/16"}, execCli); err != nil {
+		t.Errorf("expect no error, actual is %v", err)
+	}
+	if runOptions.RuntimeOptions.Namespace == nil {
+		t.Fatal("namespace should be kept for cleanup")
+	}
+	if !contains(link.ops, "move tun1 into kt-abcde") || !contains(inner.ops, "route add tun1 10.96.0.0/16") {
+		t.Errorf("tun should be moved into namespace and routed, operations %v %v", link.ops, inner.ops)
+	}
+}
+
+func Test_freeVethSubnet(t *testing.T) {
+	originAddrs := interfaceAddrs
+	defer func() { interfaceAddrs = originAddrs }()
+	interfaceAddrs = func() ([]net.Addr, error) {
+		_, used, _ := net.ParseCIDR("169.254.231.1/30")
+		used.IP = net.ParseIP("169.254.231.1")
+		return []net.Addr{used}, nil
+	}
+	if subnet, err := freeVethSubnet(); err != nil || subnet != "169.254.231.4/30" {
+		t.Errorf("freeVethSubnet() = %s, %v", subnet, err)
+	}
+}
+
+func contains(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// nopLink record operations on links, other operations are not expected
+type nopLink struct {
+	tunnel.Link
+	ops []string
+}
+
+func (l *nopLink) do(op string) error {
+	l.ops = append(l.ops, op)
+	return nil
+}
+
+func (l *nopLink) AddTun(name string) error              { return l.do("add " + name) }
+func (l *nopLink) AddVeth(name, peer string) error       { return l.do("add veth " + name) }
+func (l *nopLink) SetUp(name string) error               { return l.do("up " + name) }
+func (l *nopLink) AddAddress(name, cidr string) error    { return l.do("addr add " + name) }
+func (l *nopLink) AddRoute(name, cidr string) error      { return l.do("route add " + name + " " + cidr) }
+func (l *nopLink) AddDefaultRoute(name, gw string) error { return l.do("route add default " + name) }
+func (l *nopLink) MoveToNetns(name, netns string) error {
+	return l.do("move " + name + " into " + netns)
+}
+
+// nopHost succeed operations on host, other operations are not expected
+type nopHost struct {
+	tunnel.Host
+	inner tunnel.Link
+}
+
+func (h *nopHost) AddNetns(name string) error                 { return nil }
+func (h *nopHost) NetnsLink(name string) (tunnel.Link, error) { return h.inner, nil }
+func (h *nopHost) IPForward() (bool, error)                   { return true, nil }
+func (h *nopHost) AddRule(rule tunnel.Rule) error             { return nil }
+
+func Test_waitTunAttached(t *testing.T) {
+	original := tunCarrier
+	defer func() { tunCarrier = original }()
+	calls := 0
+	tunCarrier = func(string) string {
+		calls++
+		if calls < 3 {
+			return "0"
+		}
+		return "1"
+	}
+	if err := waitTunAttached("tun1"); err != nil || calls != 3 {
+		t.Errorf("waitTunAttached() = %v after %d checks", err, calls)
+	}
+}
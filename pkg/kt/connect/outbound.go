@@ -2,6 +2,7 @@ package connect
 
 import (
 	"context"
+	"fmt"
 	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/alibaba/kt-connect/pkg/kt/exec"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
@@ -16,6 +17,18 @@ func (s *Shadow) Outbound(name, podIP string, credential *util.SSHCredential, ci
 func outbound(s *Shadow, podName, podIP string, credential *util.SSHCredential, cidrs []string, cli exec.CliInterface) (err error) {
 	var stop chan struct{}
 	var rootCtx context.Context
+	if s.Options.Transport == common.TransportAgent && s.Options.ConnectOptions.Method != common.ConnectMethodSocks5 &&
+		s.Options.ConnectOptions.Method != common.ConnectMethodForward {
+		return fmt.Errorf("'%s' transport only supports '%s' and '%s' method",
+			common.TransportAgent, common.ConnectMethodSocks5, common.ConnectMethodForward)
+	}
+	if s.Options.RuntimeOptions.Netns != "" {
+		stop, rootCtx, err = forwardSSHTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName, s.Options.ConnectOptions.SSHPort)
+		if err == nil {
+			err = startNetnsConnection(rootCtx, cli, credential, s.Options, podIP, cidrs, stop)
+		}
+		return
+	}
 	switch s.Options.ConnectOptions.Method {
 	case common.ConnectMethodSocks:
 		err = forwardSocksTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName)
@@ -27,16 +40,25 @@ func outbound(s *Shadow, podName, podIP string, credential *util.SSHCredential,
 	case common.ConnectMethodSocks5:
 		_, _, err = forwardSSHTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName, s.Options.ConnectOptions.SSHPort)
 		if err == nil {
-			err = startSocks5Connection(cli.SshChannel(), s.Options)
+			err = startSocks5Connection(cli.SshChannel(), s.Options, credential)
+		}
+	case common.ConnectMethodForward:
+		_, _, err = forwardSSHTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName, s.Options.ConnectOptions.SSHPort)
+		if err == nil {
+			err = startServiceForwards(cli.SshChannel(), s.Options, credential)
 		}
 	default:
+		if cidrs, err = vpnCidrs(cidrs); err != nil {
+			return
+		}
 		stop, rootCtx, err = forwardSSHTunnelToLocal(cli.PortForward(), cli.Kubectl(), s.Options, podName, s.Options.ConnectOptions.SSHPort)
 		if err == nil {
 			err = startVPNConnection(rootCtx, cli, SSHVPNRequest{
+				RemoteSSHUser:          credential.RemoteUser,
 				RemoteSSHHost:          credential.RemoteHost,
 				RemoteSSHPKPath:        credential.PrivateKeyPath,
 				RemoteSSHPort:          s.Options.ConnectOptions.SSHPort,
-				RemoteDNSServerAddress: podIP,
+				RemoteDNSServerAddress: shadowDNSAddress(s.Options, podIP),
 				DisableDNS:             s.Options.ConnectOptions.DisableDNS,
 				CustomCRID:             cidrs,
 				Stop:                   stop,
@@ -10,7 +10,10 @@ import (
 	"github.com/alibaba/kt-connect/pkg/kt/options"
 	"github.com/alibaba/kt-connect/pkg/kt/util"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -18,7 +21,20 @@ func Test_shouldConnectToClusterWithSocks5Methods(t *testing.T) {
 
 	execCli, _, kubectl, sshChannel, portForward := getHandlers(t)
 
-	sshChannel.EXPECT().StartSocks5Proxy(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	dir, err := ioutil.TempDir("", "kt-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	generator, err := util.Generate(filepath.Join(dir, "kt_id_rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshChannel.EXPECT().StartSocks5Proxy(&sshchannel.Certificate{
+		Username:   common.ShadowUser,
+		PrivateKey: string(generator.PrivateKey),
+	}, gomock.Any(), gomock.Any()).Return(nil)
 	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(make(chan struct{}), nil, nil)
 	execCli.EXPECT().Kubectl().AnyTimes().Return(kubectl)
 	execCli.EXPECT().SshChannel().AnyTimes().Return(sshChannel)
@@ -32,9 +48,10 @@ func Test_shouldConnectToClusterWithSocks5Methods(t *testing.T) {
 		name:  "name",
 		podIP: "172.168.0.2",
 		credential: &util.SSHCredential{
+			RemoteUser:     common.ShadowUser,
 			RemoteHost:     "127.0.0.1",
 			Port:           "223",
-			PrivateKeyPath: "/tmp/path",
+			PrivateKeyPath: generator.PrivateKeyPath,
 		},
 		cidrs: []string{},
 	}
@@ -51,7 +68,7 @@ func Test_shouldConnectToClusterWithVpnMethods(t *testing.T) {
 
 	execCli, sshuttle, kubectl, sshChannel, portForward := getHandlers(t)
 
-	sshuttle.EXPECT().Connect(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(exec.Command("echo", "sshuttle conect"))
+	sshuttle.EXPECT().Connect(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(exec.Command("echo", "sshuttle conect"))
 	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(make(chan struct{}), nil, nil)
 	execCli.EXPECT().Sshuttle().AnyTimes().Return(sshuttle)
 	execCli.EXPECT().Kubectl().AnyTimes().Return(kubectl)
@@ -80,6 +97,131 @@ func Test_shouldConnectToClusterWithVpnMethods(t *testing.T) {
 	}
 }
 
+func Test_shouldConnectToRestrictedShadowWithVpnMethods(t *testing.T) {
+
+	execCli, sshuttle, kubectl, sshChannel, portForward := getHandlers(t)
+
+	sshuttle.EXPECT().Connect(common.RestrictedShadowUser, "127.0.0.1", gomock.Any(), gomock.Any(), "172.168.0.2:10053",
+		gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(exec.Command("echo", "sshuttle conect"))
+	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), gomock.Any(), common.RestrictedSshPort, gomock.Any()).Times(1).Return(make(chan struct{}), nil, nil)
+	execCli.EXPECT().Sshuttle().AnyTimes().Return(sshuttle)
+	execCli.EXPECT().Kubectl().AnyTimes().Return(kubectl)
+	execCli.EXPECT().SshChannel().AnyTimes().Return(sshChannel)
+	execCli.EXPECT().PortForward().AnyTimes().Return(portForward)
+
+	vpnOptions := options.NewDaemonOptions()
+	vpnOptions.WaitTime = 0
+	vpnOptions.Restricted = true
+
+	args := OutboundArgs{
+		name:  "name",
+		podIP: "172.168.0.2",
+		credential: &util.SSHCredential{
+			RemoteUser:     common.RestrictedShadowUser,
+			RemoteHost:     "127.0.0.1",
+			Port:           "223",
+			PrivateKeyPath: "/tmp/path",
+		},
+		cidrs: []string{},
+	}
+
+	s := &Shadow{
+		Options: vpnOptions,
+	}
+	if err := outbound(s, args.name, args.podIP, args.credential, args.cidrs, execCli); err != nil {
+		t.Errorf("expect no error, actual is %v", err)
+	}
+}
+
+func Test_shouldRejectVpnMethodWithAgentTransport(t *testing.T) {
+
+	execCli, _, _, _, _ := getHandlers(t)
+
+	vpnOptions := options.NewDaemonOptions()
+	vpnOptions.Transport = common.TransportAgent
+
+	s := &Shadow{
+		Options: vpnOptions,
+	}
+	if err := outbound(s, "name", "172.168.0.2", &util.SSHCredential{}, []string{}, execCli); err == nil {
+		t.Errorf("expect error with agent transport and vpn method")
+	}
+}
+
+func Test_shouldRejectVpnMethodWithIPv6OnlyCluster(t *testing.T) {
+
+	execCli, _, _, _, _ := getHandlers(t)
+
+	s := &Shadow{
+		Options: options.NewDaemonOptions(),
+	}
+	if err := outbound(s, "name", "fd00::2", &util.SSHCredential{}, []string{"fd00::/64", "fd01::/112"}, execCli); err == nil {
+		t.Errorf("expect error with vpn method in ipv6-only cluster")
+	}
+}
+
+func Test_shouldSkipIPv6CidrsWithVpnMethod(t *testing.T) {
+
+	execCli, sshuttle, kubectl, sshChannel, portForward := getHandlers(t)
+
+	sshuttle.EXPECT().Connect(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		[]string{"172.168.0.0/16"}, gomock.Any()).Times(1).Return(exec.Command("echo", "sshuttle conect"))
+	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(make(chan struct{}), nil, nil)
+	execCli.EXPECT().Sshuttle().AnyTimes().Return(sshuttle)
+	execCli.EXPECT().Kubectl().AnyTimes().Return(kubectl)
+	execCli.EXPECT().SshChannel().AnyTimes().Return(sshChannel)
+	execCli.EXPECT().PortForward().AnyTimes().Return(portForward)
+
+	vpnOptions := options.NewDaemonOptions()
+	vpnOptions.WaitTime = 0
+
+	s := &Shadow{
+		Options: vpnOptions,
+	}
+	credential := &util.SSHCredential{RemoteHost: "127.0.0.1", Port: "223", PrivateKeyPath: "/tmp/path"}
+	if err := outbound(s, "name", "172.168.0.2", credential, []string{"172.168.0.0/16", "fd00::/64"}, execCli); err != nil {
+		t.Errorf("expect no error, actual is %v", err)
+	}
+}
+
+func Test_shouldForwardServicePortsWithForwardMethod(t *testing.T) {
+
+	execCli, _, kubectl, sshChannel, portForward := getHandlers(t)
+
+	dir, err := ioutil.TempDir("", "kt-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	generator, err := util.Generate(filepath.Join(dir, "kt_id_rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forwardOptions := options.NewDaemonOptions()
+	forwardOptions.ConnectOptions.Method = common.ConnectMethodForward
+	forwardOptions.Transport = common.TransportAgent
+	forwardOptions.WaitTime = 0
+	forwardOptions.RuntimeOptions.ServiceForwards = map[string]string{"127.2.0.1:80": "10.96.0.10:80"}
+
+	sshChannel.EXPECT().ForwardLocalToRemote(&sshchannel.Certificate{
+		Username:   common.ShadowUser,
+		PrivateKey: string(generator.PrivateKey),
+	}, gomock.Any(), forwardOptions.RuntimeOptions.ServiceForwards).Return(nil)
+	portForward.EXPECT().ForwardPodPortToLocal(gomock.Any(), gomock.Any(), common.AgentPort, gomock.Any()).Return(make(chan struct{}), nil, nil)
+	execCli.EXPECT().Kubectl().AnyTimes().Return(kubectl)
+	execCli.EXPECT().SshChannel().AnyTimes().Return(sshChannel)
+	execCli.EXPECT().PortForward().AnyTimes().Return(portForward)
+
+	s := &Shadow{
+		Options: forwardOptions,
+	}
+	credential := &util.SSHCredential{RemoteUser: common.ShadowUser, PrivateKeyPath: generator.PrivateKeyPath}
+	if err := outbound(s, "name", "172.168.0.2", credential, []string{}, execCli); err != nil {
+		t.Errorf("expect no error, actual is %v", err)
+	}
+}
+
 func getHandlers(t *testing.T) (*fakeExec.MockCliInterface, *sshuttle.MockCliInterface, *kubectl.MockCliInterface, *sshchannel.MockChannel, *portforward.MockCliInterface) {
 	ctl := gomock.NewController(t)
 	execCli := fakeExec.NewMockCliInterface(ctl)
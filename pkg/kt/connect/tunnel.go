@@ -13,18 +13,52 @@ import (
 	"github.com/alibaba/kt-connect/pkg/kt/util"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
 )
 
 func forwardSSHTunnelToLocal(cli portforward.CliInterface, kubectlCli kubectl.CliInterface,
 	options *options.DaemonOptions, podName string, localSSHPort int) (stop chan struct{}, rootCtx context.Context, err error) {
 	if options.UseKubectl {
-		err = portForwardViaKubectl(kubectlCli, options, podName, common.SshPort, localSSHPort)
+		err = portForwardViaKubectl(kubectlCli, options, podName, shadowSSHPort(options), localSSHPort)
 	} else {
-		stop, rootCtx, err = cli.ForwardPodPortToLocal(options, podName, common.SshPort, localSSHPort)
+		stop, rootCtx, err = cli.ForwardPodPortToLocal(options, podName, shadowSSHPort(options), localSSHPort)
 	}
 	return stop, rootCtx, err
 }
 
+// shadowSSHPort sshd or agent port of shadow pod
+func shadowSSHPort(options *options.DaemonOptions) int {
+	if options.Transport == common.TransportAgent {
+		return common.AgentPort
+	}
+	if options.Restricted {
+		return common.RestrictedSshPort
+	}
+	return common.SshPort
+}
+
+// shadowDNSAddress dns server address of shadow pod
+func shadowDNSAddress(options *options.DaemonOptions, podIP string) string {
+	if options.Restricted {
+		return net.JoinHostPort(podIP, strconv.Itoa(common.RestrictedDnsPort))
+	}
+	return podIP
+}
+
+// sshCertificate login shadow with private key generated for current session
+func sshCertificate(credential *util.SSHCredential) (*sshchannel.Certificate, error) {
+	privateKey, err := ioutil.ReadFile(credential.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key %s: %s", credential.PrivateKeyPath, err)
+	}
+	return &sshchannel.Certificate{
+		Username:   credential.RemoteUser,
+		PrivateKey: string(privateKey),
+	}, nil
+}
+
 func forwardSocksTunnelToLocal(pfCli portforward.CliInterface, kubectlCli kubectl.CliInterface,
 	options *options.DaemonOptions, podName string) (err error) {
 	showSetupSocksMessage(common.ConnectMethodSocks, options.ConnectOptions.SocksPort)
@@ -48,24 +82,71 @@ func portForwardViaKubectl(kubectlCli kubectl.CliInterface, options *options.Dae
 	return err
 }
 
-func startSocks5Connection(ssh sshchannel.Channel, options *options.DaemonOptions) (err error) {
+func startSocks5Connection(ssh sshchannel.Channel, options *options.DaemonOptions, credential *util.SSHCredential) (err error) {
 	jvmrcFilePath := util.GetJvmrcFilePath(options.ConnectOptions.JvmrcDir)
 	if jvmrcFilePath != "" {
 		ioutil.WriteFile(jvmrcFilePath, []byte(fmt.Sprintf("-DsocksProxyHost=127.0.0.1\n-DsocksProxyPort=%d",
 			options.ConnectOptions.SocksPort)), 0644)
 	}
 
+	certificate, err := sshCertificate(credential)
+	if err != nil {
+		return
+	}
 	showSetupSocksMessage(common.ConnectMethodSocks5, options.ConnectOptions.SocksPort)
 	return ssh.StartSocks5Proxy(
-		&sshchannel.Certificate{
-			Username: "root",
-			Password: "root",
-		},
+		certificate,
 		fmt.Sprintf("127.0.0.1:%d", options.ConnectOptions.SSHPort),
 		fmt.Sprintf("127.0.0.1:%d", options.ConnectOptions.SocksPort),
 	)
 }
 
+// startServiceForwards forward loopback endpoints allocated to services through shadow
+func startServiceForwards(ssh sshchannel.Channel, options *options.DaemonOptions, credential *util.SSHCredential) (err error) {
+	certificate, err := sshCertificate(credential)
+	if err != nil {
+		return
+	}
+	err = ssh.ForwardLocalToRemote(certificate, fmt.Sprintf("127.0.0.1:%d", options.ConnectOptions.SSHPort),
+		options.RuntimeOptions.ServiceForwards)
+	if err == nil {
+		log.Info().Msgf("Forwarding %d service ports via loopback ips", len(options.RuntimeOptions.ServiceForwards))
+	}
+	return
+}
+
+func hasIPv6Cidr(cidrs []string) bool {
+	for _, cidr := range cidrs {
+		if util.IsIPv6Cidr(cidr) {
+			return true
+		}
+	}
+	return false
+}
+
+// vpnCidrs ipv4 cidrs routed by sshuttle, which only redirects ipv4 traffic with its default nat method,
+// ipv6 cidrs of dual-stack cluster are skipped, and ipv6-only cluster is rejected
+func vpnCidrs(cidrs []string) ([]string, error) {
+	var ipv4Cidrs, ipv6Cidrs []string
+	for _, cidr := range cidrs {
+		if util.IsIPv6Cidr(cidr) {
+			ipv6Cidrs = append(ipv6Cidrs, cidr)
+		} else {
+			ipv4Cidrs = append(ipv4Cidrs, cidr)
+		}
+	}
+	if len(ipv6Cidrs) == 0 {
+		return cidrs, nil
+	}
+	if len(ipv4Cidrs) == 0 {
+		return nil, fmt.Errorf("'%s' method doesn't support ipv6-only cluster (cidrs %s), use '%s' method instead",
+			common.ConnectMethodVpn, strings.Join(ipv6Cidrs, ","), common.ConnectMethodTun)
+	}
+	log.Warn().Msgf("'%s' method only routes ipv4 traffic, ipv6 cidrs %s are skipped, use '%s' method for dual-stack",
+		common.ConnectMethodVpn, strings.Join(ipv6Cidrs, ","), common.ConnectMethodTun)
+	return ipv4Cidrs, nil
+}
+
 func showSetupSocksMessage(protocol string, port int) {
 	log.Info().Msgf("Starting up %s proxy ...", protocol)
 	if util.IsWindows() && protocol == common.ConnectMethodSocks {
@@ -88,7 +169,7 @@ func showSetupSocksMessage(protocol string, port int) {
 func startVPNConnection(rootCtx context.Context, cli exec.CliInterface, request SSHVPNRequest) (err error) {
 	err = exec.BackgroundRunWithCtx(&exec.CMDContext{
 		Ctx: rootCtx,
-		Cmd: cli.Sshuttle().Connect(request.RemoteSSHHost, request.RemoteSSHPKPath, request.RemoteSSHPort,
+		Cmd: cli.Sshuttle().Connect(request.RemoteSSHUser, request.RemoteSSHHost, request.RemoteSSHPKPath, request.RemoteSSHPort,
 			request.RemoteDNSServerAddress, request.DisableDNS, request.CustomCRID, request.Debug),
 		Name: "vpn(sshuttle)",
 		Stop: request.Stop,
@@ -96,68 +177,50 @@ func startVPNConnection(rootCtx context.Context, cli exec.CliInterface, request
 	return err
 }
 
-// startTunConnection creates a ssh tunnel to pod
+// startTunConnection creates a ssh tunnel to pod, device and routes already added are rolled back if any step failed
 func startTunConnection(rootCtx context.Context, cli exec.CliInterface, credential *util.SSHCredential,
 	options *options.DaemonOptions, podIP string, cidrs []string, stop chan struct{}) (err error) {
 
-	// 1. Create tun device.
-	err = exec.RunAndWait(cli.Tunnel().AddDevice(), "add_device")
-	if err != nil {
-		return err
-	} else {
-		log.Info().Msgf("Add tun device successful")
-	}
-
-	// 2. Setup device ip
-	err = exec.RunAndWait(cli.Tunnel().SetDeviceIP(), "set_device_ip")
-	if err != nil {
-		// clean up
-		return err
-	} else {
-		log.Info().Msgf("Set tun device ip successful")
-	}
+	device := cli.Tunnel().Device(options.ConnectOptions.SourceIP6 != "" && hasIPv6Cidr(cidrs))
+	defer func() {
+		if err != nil {
+			log.Warn().Msgf("Failed to setup tun device, rolling back: %s", err)
+			device.Rollback()
+		}
+	}()
 
-	// 3. Set device up.
-	err = exec.RunAndWait(cli.Tunnel().SetDeviceUp(), "set_device_up")
-	if err != nil {
+	// 1. Create tun device with addresses and mtu, and set it up.
+	util.RecordMutation(util.MutationTunDevice, device.Name, "")
+	if err = device.Create(); err != nil {
 		return err
-	} else {
-		log.Info().Msgf("Set tun device up successful")
 	}
+	log.Info().Msgf("Create tun device %s successful", device.Name)
 
-	// 4. Create ssh tunnel.
+	// 2. Create ssh tunnel.
 	err = exec.BackgroundRunWithCtx(&exec.CMDContext{
 		Ctx:  rootCtx,
-		Cmd:  cli.SSH().TunnelToRemote(0, credential.RemoteHost, credential.PrivateKeyPath, options.ConnectOptions.SSHPort),
+		Cmd:  cli.SSH().TunnelToRemote(util.TunIndex(options.ConnectOptions.TunName), credential.RemoteHost, credential.PrivateKeyPath, options.ConnectOptions.SSHPort),
 		Name: "ssh_tun",
 		Stop: stop,
 	})
-
 	if err != nil {
 		return err
-	} else {
-		log.Info().Msgf("Create ssh tun successful")
 	}
+	log.Info().Msgf("Create ssh tun successful")
 
-	// 5. Add route to kubernetes cluster.
-	for i := range cidrs {
-		err = exec.RunAndWait(cli.Tunnel().AddRoute(cidrs[i]), "add_route")
-		if err != nil {
-			// clean up
-			return err
-		} else {
-			log.Info().Msgf("Add route %s successful", cidrs[i])
-		}
+	// 3. Add route to kubernetes cluster.
+	if err = device.AddRoutes(cidrs); err != nil {
+		return err
 	}
+	log.Info().Msgf("Add routes %s successful", strings.Join(cidrs, ","))
 
 	if !options.ConnectOptions.DisableDNS {
-		// 6. Setup dns config.
+		// 4. Setup dns config.
 		// This will overwrite the file /etc/resolv.conf
-		err = util.AddNameserver(podIP)
-		if err == nil {
-			log.Info().Msgf("Add nameserver %s successful", podIP)
+		if err = util.AddNameserver(podIP); err != nil {
+			return err
 		}
-		return err
+		log.Info().Msgf("Add nameserver %s successful", podIP)
 	}
 
 	return nil
@@ -27,6 +27,7 @@ func Create(options *options.DaemonOptions) (shadow Shadow) {
 
 // SSHVPNRequest ...
 type SSHVPNRequest struct {
+	RemoteSSHUser          string
 	RemoteSSHHost          string
 	RemoteSSHPort          int
 	RemoteSSHPKPath        string
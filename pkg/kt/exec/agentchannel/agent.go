@@ -0,0 +1,78 @@
+package agentchannel
+
+import (
+	"net"
+
+	"github.com/alibaba/kt-connect/pkg/kt/exec/sshchannel"
+	"github.com/alibaba/kt-connect/pkg/metrics"
+	"github.com/alibaba/kt-connect/pkg/proxy/agent"
+	"github.com/armon/go-socks5"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/context"
+)
+
+// AgentChannel channel to the agent of shadow, all traffic is multiplexed over one connection
+type AgentChannel struct{}
+
+// StartSocks5Proxy start socks5 proxy
+func (c *AgentChannel) StartSocks5Proxy(certificate *sshchannel.Certificate, agentAddress, socks5Address string) (err error) {
+	client, err := agent.Connect(agentAddress, []byte(certificate.PrivateKey))
+	if err != nil {
+		log.Error().Msgf("Fail to connect agent: %s", err)
+		return err
+	}
+	defer client.Close()
+
+	conf := &socks5.Config{
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			remote, err := client.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			metrics.SocksConnections.Inc()
+			return metrics.CountConn(remote, metrics.PortOf(socks5Address)), nil
+		},
+	}
+
+	serverSocks, err := socks5.New(conf)
+	if err != nil {
+		return err
+	}
+
+	// Process will hang at here
+	if err = serverSocks.ListenAndServe("tcp", socks5Address); err != nil {
+		log.Error().Msgf("Failed to create socks5 server: %s", err)
+	}
+	return
+}
+
+// ForwardRemoteToLocal forward remote request to local
+func (c *AgentChannel) ForwardRemoteToLocal(certificate *sshchannel.Certificate, agentAddress, remoteEndpoint, localEndpoint string) (err error) {
+	client, err := agent.Connect(agentAddress, []byte(certificate.PrivateKey))
+	if err != nil {
+		log.Error().Msgf("Fail to connect agent: %s", err)
+		return err
+	}
+	defer client.Close()
+
+	log.Info().Msgf("Forward %s to localEndpoint %s", remoteEndpoint, localEndpoint)
+	// process will hang at here
+	if err = client.Forward(remoteEndpoint, localEndpoint); err != nil {
+		log.Error().Msgf("Fail to listen remote endpoint: %s", err)
+	}
+	return
+}
+
+// ForwardLocalToRemote forward local endpoints to remote endpoints, forwards keep serving in background
+func (c *AgentChannel) ForwardLocalToRemote(certificate *sshchannel.Certificate, agentAddress string, forwards map[string]string) (err error) {
+	client, err := agent.Connect(agentAddress, []byte(certificate.PrivateKey))
+	if err != nil {
+		log.Error().Msgf("Fail to connect agent: %s", err)
+		return err
+	}
+	if _, err = sshchannel.ListenAndForward(forwards, client.Dial); err != nil {
+		_ = client.Close()
+		log.Error().Msgf("Fail to listen local endpoint: %s", err)
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package sshchannel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// DialFunc open a connection to remote address through the channel
+type DialFunc func(network, address string) (net.Conn, error)
+
+// Conn connection which remote addresses are dialed through, e.g. ssh client
+type Conn interface {
+	Dial(network, address string) (net.Conn, error)
+	// Wait block until connection closed
+	Wait() error
+	Close() error
+}
+
+// first and max interval between attempts to re-establish lost connection
+var (
+	reconnectInterval    = time.Second
+	maxReconnectInterval = 10 * time.Second
+)
+
+// ListenAndForwardWithReconnect same as ListenAndForward, remote endpoints are dialed through connection created by connect,
+// which is re-established once lost, so that listeners keep serving until the returned stop function called
+func ListenAndForwardWithReconnect(forwards map[string]string, connect func() (Conn, error)) (stop func(), err error) {
+	conn, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &reconnectingDialer{conn: conn, connect: connect, stopped: make(chan struct{}),
+		interval: reconnectInterval, maxInterval: maxReconnectInterval}
+	stopListeners, err := ListenAndForward(forwards, dialer.Dial)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go dialer.keepAlive()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stopListeners()
+			dialer.stop()
+		})
+	}, nil
+}
+
+// reconnectingDialer dial through current connection, which is replaced once re-established
+type reconnectingDialer struct {
+	lock    sync.RWMutex
+	conn    Conn
+	connect func() (Conn, error)
+	stopped chan struct{}
+	// interval first interval between attempts to reconnect, doubled after each failure until maxInterval
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+func (d *reconnectingDialer) current() Conn {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.conn
+}
+
+func (d *reconnectingDialer) Dial(network, address string) (net.Conn, error) {
+	return d.current().Dial(network, address)
+}
+
+// keepAlive re-establish connection whenever it's lost, until stopped
+func (d *reconnectingDialer) keepAlive() {
+	for {
+		_ = d.current().Wait()
+		interval := d.interval
+		for {
+			select {
+			case <-d.stopped:
+				return
+			case <-time.After(interval):
+			}
+			conn, err := d.connect()
+			if err == nil {
+				d.lock.Lock()
+				d.conn = conn
+				d.lock.Unlock()
+				select {
+				case <-d.stopped:
+					// stopped while reconnecting
+					_ = conn.Close()
+					return
+				default:
+				}
+				log.Info().Msgf("Connection re-established, forwarding resumed")
+				break
+			}
+			if interval *= 2; interval > d.maxInterval {
+				interval = d.maxInterval
+			}
+			log.Warn().Msgf("Failed to re-establish connection, retry in %s: %s", interval, err)
+		}
+	}
+}
+
+func (d *reconnectingDialer) stop() {
+	close(d.stopped)
+	_ = d.current().Close()
+}
+
+// ListenAndForward listen on local endpoint of each forward, and relay accepted connections to its remote endpoint,
+// listeners keep serving in background until the returned stop function called
+func ListenAndForward(forwards map[string]string, dial DialFunc) (stop func(), err error) {
+	var listeners []net.Listener
+	stop = func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+	for local, remote := range forwards {
+		listener, err := net.Listen("tcp", local)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		go acceptAndRelay(listener, remote, dial)
+	}
+	return stop, nil
+}
+
+func acceptAndRelay(listener net.Listener, remote string, dial DialFunc) {
+	port := metrics.PortOf(listener.Addr().String())
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			target, err := dial("tcp", remote)
+			if err != nil {
+				log.Debug().Msgf("Failed to dial %s for %s: %s", remote, listener.Addr(), err)
+				_ = client.Close()
+				return
+			}
+			relay(metrics.CountConn(client, port), target)
+		}()
+	}
+}
+
+// relay copy data in both direction until either side closed
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+	<-done
+}
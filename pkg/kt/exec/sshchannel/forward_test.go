@@ -0,0 +1,129 @@
+package sshchannel
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenAndForward(t *testing.T) {
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	go func() {
+		conn, err := remote.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("pong"))
+		_ = conn.Close()
+	}()
+
+	// reserve a free local port
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := reserved.Addr().String()
+	_ = reserved.Close()
+
+	var dialed string
+	stop, err := ListenAndForward(map[string]string{local: "svc.default:80"}, func(network, address string) (net.Conn, error) {
+		dialed = address
+		return net.Dial(network, remote.Addr().String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	conn, err := net.Dial("tcp", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "pong" || dialed != "svc.default:80" {
+		t.Errorf("got %q via %s, want %q via %s", data, dialed, "pong", "svc.default:80")
+	}
+
+	if _, err = ListenAndForward(map[string]string{remote.Addr().String(): "svc.default:80"}, nil); err == nil {
+		t.Errorf("expect error when local endpoint in use")
+	}
+}
+
+// fakeConn dial remote address directly, and is lost when closed
+type fakeConn struct {
+	remote string
+	closed chan struct{}
+}
+
+func (c *fakeConn) Dial(network, address string) (net.Conn, error) {
+	select {
+	case <-c.closed:
+		return nil, errors.New("connection lost")
+	default:
+		return net.Dial(network, c.remote)
+	}
+}
+func (c *fakeConn) Wait() error  { <-c.closed; return nil }
+func (c *fakeConn) Close() error { close(c.closed); return nil }
+
+func TestListenAndForwardWithReconnect(t *testing.T) {
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	go func() {
+		for {
+			conn, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("pong"))
+			_ = conn.Close()
+		}
+	}()
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := reserved.Addr().String()
+	_ = reserved.Close()
+
+	originInterval := reconnectInterval
+	reconnectInterval = 10 * time.Millisecond
+	defer func() { reconnectInterval = originInterval }()
+	connected := make(chan *fakeConn, 2)
+	stop, err := ListenAndForwardWithReconnect(map[string]string{local: "svc.default:80"}, func() (Conn, error) {
+		conn := &fakeConn{remote: remote.Addr().String(), closed: make(chan struct{})}
+		connected <- conn
+		return conn, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// connection lost, e.g. port forward to shadow reconnected
+	_ = (<-connected).Close()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("connection not re-established")
+	}
+	conn, err := net.Dial("tcp", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(conn); string(data) != "pong" {
+		t.Errorf("forward should keep serving after reconnected, got %q", data)
+	}
+}
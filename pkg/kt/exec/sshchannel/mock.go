@@ -33,6 +33,20 @@ func (m *MockChannel) EXPECT() *MockChannelMockRecorder {
 	return m.recorder
 }
 
+// ForwardLocalToRemote mocks base method.
+func (m *MockChannel) ForwardLocalToRemote(certificate *Certificate, sshAddress string, forwards map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForwardLocalToRemote", certificate, sshAddress, forwards)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForwardLocalToRemote indicates an expected call of ForwardLocalToRemote.
+func (mr *MockChannelMockRecorder) ForwardLocalToRemote(certificate, sshAddress, forwards interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForwardLocalToRemote", reflect.TypeOf((*MockChannel)(nil).ForwardLocalToRemote), certificate, sshAddress, forwards)
+}
+
 // ForwardRemoteToLocal mocks base method.
 func (m *MockChannel) ForwardRemoteToLocal(certificate *Certificate, sshAddress, remoteEndpoint, localEndpoint string) error {
 	m.ctrl.T.Helper()
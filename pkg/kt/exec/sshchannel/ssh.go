@@ -4,6 +4,7 @@ import (
 	"io"
 	"net"
 
+	"github.com/alibaba/kt-connect/pkg/metrics"
 	"github.com/armon/go-socks5"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/ssh"
@@ -15,7 +16,7 @@ type SSHChannel struct{}
 
 // StartSocks5Proxy start socks5 proxy
 func (c *SSHChannel) StartSocks5Proxy(certificate *Certificate, sshAddress, socks5Address string) (err error) {
-	conn, err := connection(certificate.Username, certificate.Password, sshAddress)
+	conn, err := connection(certificate, sshAddress)
 	if err != nil {
 		return err
 	}
@@ -23,7 +24,12 @@ func (c *SSHChannel) StartSocks5Proxy(certificate *Certificate, sshAddress, sock
 
 	conf := &socks5.Config{
 		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return conn.Dial(network, addr)
+			remote, err := conn.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			metrics.SocksConnections.Inc()
+			return metrics.CountConn(remote, metrics.PortOf(socks5Address)), nil
 		},
 	}
 
@@ -41,7 +47,7 @@ func (c *SSHChannel) StartSocks5Proxy(certificate *Certificate, sshAddress, sock
 
 // ForwardRemoteToLocal forward remote request to local
 func (c *SSHChannel) ForwardRemoteToLocal(certificate *Certificate, sshAddress, remoteEndpoint, localEndpoint string) (err error) {
-	conn, err := connection(certificate.Username, certificate.Password, sshAddress)
+	conn, err := connection(certificate, sshAddress)
 	if err != nil {
 		log.Error().Msgf("Fail to create ssh tunnel: %s", err)
 		return err
@@ -73,17 +79,38 @@ func (c *SSHChannel) ForwardRemoteToLocal(certificate *Certificate, sshAddress,
 			return err
 		}
 
-		handleClient(client, local)
+		handleClient(metrics.CountConn(client, metrics.PortOf(localEndpoint)), local)
 	}
 }
 
-func connection(username string, password string, address string) (*ssh.Client, error) {
+// ForwardLocalToRemote forward local endpoints to remote endpoints, ssh connection is re-established once lost,
+// e.g. port forward to shadow reconnected, so that forwards keep serving in background
+func (c *SSHChannel) ForwardLocalToRemote(certificate *Certificate, sshAddress string, forwards map[string]string) (err error) {
+	_, err = ListenAndForwardWithReconnect(forwards, func() (Conn, error) {
+		conn, err := connection(certificate, sshAddress)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+	if err != nil {
+		log.Error().Msgf("Fail to forward local endpoints: %s", err)
+	}
+	return err
+}
+
+func connection(certificate *Certificate, address string) (*ssh.Client, error) {
 	config := &ssh.ClientConfig{
-		User:            username,
+		User:            certificate.Username,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
+	signer, err := ssh.ParsePrivateKey([]byte(certificate.PrivateKey))
+	if err != nil {
+		log.Error().Msgf("Invalid ssh private key: %s", err)
+		return nil, err
+	}
 	config.Auth = []ssh.AuthMethod{
-		ssh.Password(password),
+		ssh.PublicKeys(signer),
 	}
 
 	conn, err := ssh.Dial("tcp", address, config)
@@ -2,8 +2,8 @@ package sshchannel
 
 // Certificate certificate
 type Certificate struct {
-	Username   string
-	Password   string
+	Username string
+	// PrivateKey content of PEM encoded private key
 	PrivateKey string
 }
 
@@ -11,4 +11,5 @@ type Certificate struct {
 type Channel interface {
 	StartSocks5Proxy(certificate *Certificate, sshAddress, socks5Address string) error
 	ForwardRemoteToLocal(certificate *Certificate, sshAddress, remoteEndpoint, localEndpoint string) error
+	ForwardLocalToRemote(certificate *Certificate, sshAddress string, forwards map[string]string) error
 }
@@ -13,7 +13,7 @@ func (s *Cli) Version() *exec.Cmd {
 }
 
 // Connect ssh-baed vpn connect
-func (s *Cli) Connect(remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd {
+func (s *Cli) Connect(remoteUser, remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd {
 	var args []string
 	if !disableDNS {
 		args = append(args, "--dns", "--to-ns", DNSServer)
@@ -24,7 +24,7 @@ func (s *Cli) Connect(remoteHost, privateKeyPath string, remotePort int, DNSServ
 	}
 
 	subCommand := fmt.Sprintf("ssh -oStrictHostKeyChecking=no -oUserKnownHostsFile=/dev/null -i %s", privateKeyPath)
-	remoteAddr := fmt.Sprintf("root@%s:%d", remoteHost, remotePort)
+	remoteAddr := fmt.Sprintf("%s@%s:%d", remoteUser, remoteHost, remotePort)
 	args = append(args, "--ssh-cmd", subCommand, "--remote", remoteAddr, "--exclude", remoteHost)
 	args = append(args, cidrs...)
 	cmd := exec.Command("sshuttle", args...)
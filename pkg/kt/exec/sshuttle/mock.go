@@ -35,17 +35,17 @@ func (m *MockCliInterface) EXPECT() *MockCliInterfaceMockRecorder {
 }
 
 // Connect mocks base method.
-func (m *MockCliInterface) Connect(remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd {
+func (m *MockCliInterface) Connect(remoteUser, remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Connect", remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug)
+	ret := m.ctrl.Call(m, "Connect", remoteUser, remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug)
 	ret0, _ := ret[0].(*exec.Cmd)
 	return ret0
 }
 
 // Connect indicates an expected call of Connect.
-func (mr *MockCliInterfaceMockRecorder) Connect(remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug interface{}) *gomock.Call {
+func (mr *MockCliInterfaceMockRecorder) Connect(remoteUser, remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Connect", reflect.TypeOf((*MockCliInterface)(nil).Connect), remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Connect", reflect.TypeOf((*MockCliInterface)(nil).Connect), remoteUser, remoteHost, privateKeyPath, remotePort, DNSServer, disableDNS, cidrs, debug)
 }
 
 // Version mocks base method.
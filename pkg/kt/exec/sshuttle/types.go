@@ -5,7 +5,7 @@ import "os/exec"
 // CliInterface ...
 type CliInterface interface {
 	Version() *exec.Cmd
-	Connect(remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd
+	Connect(remoteUser, remoteHost, privateKeyPath string, remotePort int, DNSServer string, disableDNS bool, cidrs []string, debug bool) *exec.Cmd
 }
 
 // Cli ...
@@ -2,6 +2,7 @@ package tunnel
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 )
 
@@ -43,6 +44,19 @@ func (s *Cli) SetDeviceIP() *exec.Cmd {
 	)
 }
 
+// SetDeviceIP6 set the ipv6 address of tun device
+func (s *Cli) SetDeviceIP6() *exec.Cmd {
+	// run command: ip -6 address add fd00:6b74::1/126 dev tun0
+	return exec.Command("ip",
+		"-6",
+		"address",
+		"add",
+		fmt.Sprintf("%s/%s", s.SourceIP6, s.MaskLen6),
+		"dev",
+		s.TunName,
+	)
+}
+
 func (s *Cli) SetDeviceUp() *exec.Cmd {
 	// run command: ip link set dev tun0 up
 	return exec.Command("ip",
@@ -54,11 +68,31 @@ func (s *Cli) SetDeviceUp() *exec.Cmd {
 	)
 }
 
-func (s *Cli) RemoveDevice() *exec.Cmd {
-	// run command: ip link delete tun0
-	return exec.Command("ip",
-		"link",
-		"delete",
-		s.TunName,
-	)
+// Device tun device with its addresses, which is managed natively instead of via commands
+func (s *Cli) Device(withIPv6 bool) *Device {
+	addresses := []string{fmt.Sprintf("%s/%s", s.SourceIP, s.MaskLen)}
+	if withIPv6 && s.SourceIP6 != "" {
+		addresses = append(addresses, fmt.Sprintf("%s/%s", s.SourceIP6, s.MaskLen6))
+	}
+	return NewDevice(NativeLink(), s.TunName, s.MTU, addresses)
+}
+
+// Teardown remove routes of tun device one by one, then the device itself
+func (s *Cli) Teardown() ([]RouteResult, error) {
+	return RemoveDevice(NativeLink(), s.TunName)
+}
+
+// Namespace network namespace of process scoped connection, with a veth pair in subnet to host
+func (s *Cli) Namespace(subnet string) *Namespace {
+	return NewNamespace(NativeHost(), NativeLink(), s.Netns, subnet)
+}
+
+// RunInNetns run command in network namespace, as the user invoked sudo if any
+func (s *Cli) RunInNetns(command []string) *exec.Cmd {
+	// run command: ip netns exec kt-abcde sudo -E -u alice -- curl http://tomcat:8080
+	args := []string{"netns", "exec", s.Netns}
+	if user := os.Getenv("SUDO_USER"); user != "" {
+		args = append(args, "sudo", "-E", "-u", user, "--")
+	}
+	return exec.Command("ip", append(args, command...)...)
 }
@@ -0,0 +1,128 @@
+package tunnel
+
+import (
+	"fmt"
+)
+
+// Link native operations on network devices and routes
+type Link interface {
+	AddTun(name string) error
+	DeleteLink(name string) error
+	MTU(name string) (int, error)
+	SetMTU(name string, mtu int) error
+	AddAddress(name, cidr string) error
+	DeleteAddress(name, cidr string) error
+	SetUp(name string) error
+	SetDown(name string) error
+	AddRoute(name, cidr string) error
+	DeleteRoute(name, cidr string) error
+	Routes(name string) ([]string, error)
+	AddVeth(name, peer string) error
+	// MoveToNetns move device into network namespace, or back to host network namespace if netns is empty
+	MoveToNetns(name, netns string) error
+	AddDefaultRoute(name, gateway string) error
+	Exists(name string) bool
+}
+
+// Device tun device to shadow, every change is recorded so that a failed setup can be rolled back
+type Device struct {
+	Name string
+	// MTU mtu of device, kernel default is used if 0
+	MTU int
+	// Addresses addresses of device in cidr notation, e.g. '10.1.1.1/30'
+	Addresses []string
+	link      Link
+	tx        *Transaction
+}
+
+// RouteResult result of removing a route of device
+type RouteResult struct {
+	Cidr string
+	Err  error
+}
+
+// NewDevice create device operated via link
+func NewDevice(link Link, name string, mtu int, addresses []string) *Device {
+	return &Device{Name: name, MTU: mtu, Addresses: addresses, link: link, tx: &Transaction{}}
+}
+
+// Create add tun device with its addresses and mtu, and set it up
+func (d *Device) Create() error {
+	if err := d.add(); err != nil {
+		return err
+	}
+	return d.Configure()
+}
+
+// add tun device with its mtu
+func (d *Device) add() error {
+	err := d.tx.Do(fmt.Sprintf("add device %s", d.Name),
+		func() error { return d.link.AddTun(d.Name) },
+		func() error { return d.link.DeleteLink(d.Name) })
+	if err != nil {
+		return err
+	}
+	if d.MTU > 0 {
+		// mtu attribute is ignored when creating tun device, so it's set afterwards
+		origin := 0
+		err = d.tx.Do(fmt.Sprintf("set mtu of %s to %d", d.Name, d.MTU),
+			func() (err error) {
+				if origin, err = d.link.MTU(d.Name); err != nil {
+					return err
+				}
+				return d.link.SetMTU(d.Name, d.MTU)
+			},
+			func() error { return d.link.SetMTU(d.Name, origin) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Configure add addresses of device and set it up, which is also required after device moved to other namespace
+func (d *Device) Configure() error {
+	for _, address := range d.Addresses {
+		cidr := address
+		err := d.tx.Do(fmt.Sprintf("add address %s to %s", cidr, d.Name),
+			func() error { return d.link.AddAddress(d.Name, cidr) },
+			func() error { return d.link.DeleteAddress(d.Name, cidr) })
+		if err != nil {
+			return err
+		}
+	}
+	return d.tx.Do(fmt.Sprintf("set device %s up", d.Name),
+		func() error { return d.link.SetUp(d.Name) },
+		func() error { return d.link.SetDown(d.Name) })
+}
+
+// AddRoutes route cidrs to device
+func (d *Device) AddRoutes(cidrs []string) error {
+	for _, c := range cidrs {
+		cidr := c
+		err := d.tx.Do(fmt.Sprintf("add route %s to %s", cidr, d.Name),
+			func() error { return d.link.AddRoute(d.Name, cidr) },
+			func() error { return d.link.DeleteRoute(d.Name, cidr) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback undo all changes of device in reverse order
+func (d *Device) Rollback() []error {
+	return d.tx.Rollback()
+}
+
+// RemoveDevice remove routes of device one by one, then the device itself
+func RemoveDevice(link Link, name string) (routes []RouteResult, err error) {
+	cidrs, err := link.Routes(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, cidr := range cidrs {
+		routes = append(routes, RouteResult{Cidr: cidr, Err: link.DeleteRoute(name, cidr)})
+	}
+	return routes, link.DeleteLink(name)
+}
@@ -0,0 +1,142 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fakeLink record operations, and fail the operation specified
+type fakeLink struct {
+	ops    []string
+	failOn string
+	routes []string
+	// links existing links
+	links []string
+}
+
+func (l *fakeLink) do(op string) error {
+	if op == l.failOn {
+		return errors.New("operation not permitted")
+	}
+	l.ops = append(l.ops, op)
+	return nil
+}
+
+func (l *fakeLink) AddTun(name string) error     { return l.do("add " + name) }
+func (l *fakeLink) DeleteLink(name string) error { return l.do("del " + name) }
+func (l *fakeLink) MTU(name string) (int, error) { return 1500, nil }
+func (l *fakeLink) SetMTU(name string, mtu int) error {
+	return l.do(fmt.Sprintf("mtu %s %d", name, mtu))
+}
+func (l *fakeLink) AddAddress(name, cidr string) error {
+	return l.do(fmt.Sprintf("addr add %s %s", name, cidr))
+}
+func (l *fakeLink) DeleteAddress(name, cidr string) error {
+	return l.do(fmt.Sprintf("addr del %s %s", name, cidr))
+}
+func (l *fakeLink) SetUp(name string) error   { return l.do("up " + name) }
+func (l *fakeLink) SetDown(name string) error { return l.do("down " + name) }
+func (l *fakeLink) AddRoute(name, cidr string) error {
+	return l.do(fmt.Sprintf("route add %s %s", name, cidr))
+}
+func (l *fakeLink) DeleteRoute(name, cidr string) error {
+	return l.do(fmt.Sprintf("route del %s %s", name, cidr))
+}
+func (l *fakeLink) Routes(name string) ([]string, error) { return l.routes, nil }
+func (l *fakeLink) AddVeth(name, peer string) error {
+	return l.do(fmt.Sprintf("add veth %s %s", name, peer))
+}
+func (l *fakeLink) MoveToNetns(name, netns string) error {
+	return l.do(fmt.Sprintf("move %s to '%s'", name, netns))
+}
+func (l *fakeLink) AddDefaultRoute(name, gateway string) error {
+	return l.do(fmt.Sprintf("route add %s default via %s", name, gateway))
+}
+func (l *fakeLink) Exists(name string) bool {
+	for _, link := range l.links {
+		if link == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDevice_Create(t *testing.T) {
+	link := &fakeLink{}
+	device := NewDevice(link, "tun0", 1400, []string{"10.1.1.1/30", "fd00:6b74::1/126"})
+	if err := device.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.AddRoutes([]string{"10.96.0.0/16", "172.16.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"add tun0", "mtu tun0 1400", "addr add tun0 10.1.1.1/30", "addr add tun0 fd00:6b74::1/126", "up tun0",
+		"route add tun0 10.96.0.0/16", "route add tun0 172.16.0.0/16"}
+	if !reflect.DeepEqual(link.ops, want) {
+		t.Errorf("operations = %v, want %v", link.ops, want)
+	}
+}
+
+func TestDevice_RollbackPartialSetup(t *testing.T) {
+	link := &fakeLink{failOn: "route add tun0 172.16.0.0/16"}
+	device := NewDevice(link, "tun0", 0, []string{"10.1.1.1/30"})
+	if err := device.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.AddRoutes([]string{"10.96.0.0/16", "172.16.0.0/16"}); err == nil {
+		t.Fatal("expect error of adding route")
+	}
+	link.ops = nil
+	if errs := device.Rollback(); len(errs) != 0 {
+		t.Errorf("unexpected rollback errors %v", errs)
+	}
+	want := []string{"route del tun0 10.96.0.0/16", "down tun0", "addr del tun0 10.1.1.1/30", "del tun0"}
+	if !reflect.DeepEqual(link.ops, want) {
+		t.Errorf("rollback operations = %v, want %v", link.ops, want)
+	}
+	if errs := device.Rollback(); len(errs) != 0 || len(link.ops) != len(want) {
+		t.Errorf("rollback should only undo once")
+	}
+}
+
+func TestDevice_RollbackFailedCreate(t *testing.T) {
+	link := &fakeLink{failOn: "addr add tun0 10.1.1.1/30"}
+	device := NewDevice(link, "tun0", 0, []string{"10.1.1.1/30"})
+	if err := device.Create(); err == nil {
+		t.Fatal("expect error of adding address")
+	}
+	link.ops = nil
+	device.Rollback()
+	if !reflect.DeepEqual(link.ops, []string{"del tun0"}) {
+		t.Errorf("rollback operations = %v", link.ops)
+	}
+}
+
+func TestDevice_RollbackMTU(t *testing.T) {
+	link := &fakeLink{failOn: "up tun0"}
+	device := NewDevice(link, "tun0", 1400, nil)
+	if err := device.Create(); err == nil {
+		t.Fatal("expect error of setting device up")
+	}
+	link.ops = nil
+	device.Rollback()
+	if !reflect.DeepEqual(link.ops, []string{"mtu tun0 1500", "del tun0"}) {
+		t.Errorf("mtu should be restored on rollback, operations %v", link.ops)
+	}
+}
+
+func TestRemoveDevice(t *testing.T) {
+	link := &fakeLink{routes: []string{"10.96.0.0/16", "172.16.0.0/16"}, failOn: "route del tun0 172.16.0.0/16"}
+	routes, err := RemoveDevice(link, "tun0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Err != nil || routes[1].Err == nil || routes[1].Cidr != "172.16.0.0/16" {
+		t.Errorf("route results = %v", routes)
+	}
+	if link.ops[len(link.ops)-1] != "del tun0" {
+		t.Errorf("device should be removed after routes, operations %v", link.ops)
+	}
+}
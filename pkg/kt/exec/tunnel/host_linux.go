@@ -0,0 +1,127 @@
+package tunnel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+const ipForwardFile = "/proc/sys/net/ipv4/ip_forward"
+
+// nativeHost operate network namespaces via syscalls, and nat rules via iptables
+type nativeHost struct{}
+
+// NativeHost host operations of current platform
+func NativeHost() Host {
+	return &nativeHost{}
+}
+
+// AddNetns same as 'ip netns add', namespace is kept after creator exited by bind mounting it to a file
+func (h *nativeHost) AddNetns(name string) error {
+	if err := os.MkdirAll(NetnsDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(NetnsDir, name)
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	done := make(chan error, 1)
+	go func() {
+		// thread is never unlocked, so that it's terminated instead of reused after switched to new namespace
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			done <- err
+			return
+		}
+		done <- unix.Mount(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), path, "none", unix.MS_BIND, "")
+	}()
+	if err = <-done; err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// DeleteNetns same as 'ip netns delete', namespace is destroyed with virtual devices in it once no process uses it
+func (h *nativeHost) DeleteNetns(name string) error {
+	path := filepath.Join(NetnsDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && err != unix.EINVAL {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (h *nativeHost) Netns() (names []string, err error) {
+	files, err := ioutil.ReadDir(NetnsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return
+}
+
+func (h *nativeHost) NetnsLink(name string) (Link, error) {
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, err
+	}
+	return &netlinkLink{h: handle}, nil
+}
+
+func (h *nativeHost) IPForward() (bool, error) {
+	content, err := ioutil.ReadFile(ipForwardFile)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(content)) == "1", nil
+}
+
+func (h *nativeHost) SetIPForward(enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return ioutil.WriteFile(ipForwardFile, []byte(value), 0644)
+}
+
+func (h *nativeHost) AddRule(rule Rule) error {
+	return iptables(rule, "-I")
+}
+
+func (h *nativeHost) DeleteRule(rule Rule) error {
+	if iptables(rule, "-C") != nil {
+		// rule not exists
+		return nil
+	}
+	return iptables(rule, "-D")
+}
+
+// iptables run iptables command on rule, waiting for xtables lock held by other process
+func iptables(rule Rule, action string) error {
+	args := append([]string{"-w", "-t", rule.Table, action, rule.Chain}, rule.Spec...)
+	if out, err := exec.Command("iptables", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("iptables %s: %s %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
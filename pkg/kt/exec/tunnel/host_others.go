@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package tunnel
+
+// unsupportedHost host operations of platforms without network namespace support
+type unsupportedHost struct{}
+
+// NativeHost host operations of current platform
+func NativeHost() Host {
+	return &unsupportedHost{}
+}
+
+func (h *unsupportedHost) AddNetns(name string) error          { return errUnsupported }
+func (h *unsupportedHost) DeleteNetns(name string) error       { return errUnsupported }
+func (h *unsupportedHost) Netns() ([]string, error)            { return nil, errUnsupported }
+func (h *unsupportedHost) NetnsLink(name string) (Link, error) { return nil, errUnsupported }
+func (h *unsupportedHost) IPForward() (bool, error)            { return false, errUnsupported }
+func (h *unsupportedHost) SetIPForward(enabled bool) error     { return errUnsupported }
+func (h *unsupportedHost) AddRule(rule Rule) error             { return errUnsupported }
+func (h *unsupportedHost) DeleteRule(rule Rule) error          { return errUnsupported }
@@ -0,0 +1,176 @@
+package tunnel
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// netlinkLink operate devices and routes via netlink, in network namespace of its handle
+type netlinkLink struct {
+	h *netlink.Handle
+}
+
+// NativeLink link operations of current platform
+func NativeLink() Link {
+	// zero handle works in network namespace of current process
+	return &netlinkLink{h: &netlink.Handle{}}
+}
+
+func (l *netlinkLink) AddTun(name string) error {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = name
+	return l.h.LinkAdd(&netlink.Tuntap{LinkAttrs: attrs, Mode: netlink.TUNTAP_MODE_TUN, Flags: netlink.TUNTAP_NO_PI})
+}
+
+func (l *netlinkLink) AddVeth(name, peer string) error {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = name
+	return l.h.LinkAdd(&netlink.Veth{LinkAttrs: attrs, PeerName: peer})
+}
+
+func (l *netlinkLink) MTU(name string) (int, error) {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return link.Attrs().MTU, nil
+}
+
+func (l *netlinkLink) SetMTU(name string, mtu int) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return l.h.LinkSetMTU(link, mtu)
+}
+
+func (l *netlinkLink) Exists(name string) bool {
+	_, err := l.h.LinkByName(name)
+	return err == nil
+}
+
+func (l *netlinkLink) DeleteLink(name string) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return l.h.LinkDel(link)
+}
+
+func (l *netlinkLink) MoveToNetns(name, netnsName string) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	var ns netns.NsHandle
+	if netnsName == "" {
+		// main thread never leaves host network namespace
+		ns, err = netns.GetFromPid(unix.Getpid())
+	} else {
+		ns, err = netns.GetFromName(netnsName)
+	}
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	return l.h.LinkSetNsFd(link, int(ns))
+}
+
+func (l *netlinkLink) AddAddress(name, cidr string) error {
+	return l.modifyAddress(name, cidr, l.h.AddrAdd)
+}
+
+func (l *netlinkLink) DeleteAddress(name, cidr string) error {
+	return l.modifyAddress(name, cidr, l.h.AddrDel)
+}
+
+func (l *netlinkLink) modifyAddress(name, cidr string, modify func(netlink.Link, *netlink.Addr) error) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return err
+	}
+	return modify(link, addr)
+}
+
+func (l *netlinkLink) SetUp(name string) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return l.h.LinkSetUp(link)
+}
+
+func (l *netlinkLink) SetDown(name string) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return l.h.LinkSetDown(link)
+}
+
+func (l *netlinkLink) AddRoute(name, cidr string) error {
+	route, err := l.route(name, cidr)
+	if err != nil {
+		return err
+	}
+	return l.h.RouteAdd(route)
+}
+
+func (l *netlinkLink) DeleteRoute(name, cidr string) error {
+	route, err := l.route(name, cidr)
+	if err != nil {
+		return err
+	}
+	return l.h.RouteDel(route)
+}
+
+func (l *netlinkLink) AddDefaultRoute(name, gateway string) error {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	// same as 'ip route add default via <gateway> dev <name>'
+	return l.h.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Gw: net.ParseIP(gateway)})
+}
+
+func (l *netlinkLink) route(name, cidr string) (*netlink.Route, error) {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst}
+	if dst.IP.To4() != nil {
+		// same as 'ip route add <cidr> dev <tun>'
+		route.Scope = netlink.SCOPE_LINK
+	}
+	return route, nil
+}
+
+// Routes cidrs routed to device, excluding routes added by kernel for its addresses
+func (l *netlinkLink) Routes(name string) (cidrs []string, err error) {
+	link, err := l.h.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := l.h.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		if route.Dst != nil && route.Protocol != unix.RTPROT_KERNEL {
+			cidrs = append(cidrs, route.Dst.String())
+		}
+	}
+	return
+}
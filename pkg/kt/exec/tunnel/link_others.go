@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+package tunnel
+
+import (
+	"errors"
+)
+
+var errUnsupported = errors.New("tun device is only supported on linux")
+
+// unsupportedLink link operations of platforms without tun support
+type unsupportedLink struct{}
+
+// NativeLink link operations of current platform
+func NativeLink() Link {
+	return &unsupportedLink{}
+}
+
+func (l *unsupportedLink) AddTun(name string) error              { return errUnsupported }
+func (l *unsupportedLink) DeleteLink(name string) error          { return errUnsupported }
+func (l *unsupportedLink) MTU(name string) (int, error)          { return 0, errUnsupported }
+func (l *unsupportedLink) SetMTU(name string, mtu int) error     { return errUnsupported }
+func (l *unsupportedLink) AddAddress(name, cidr string) error    { return errUnsupported }
+func (l *unsupportedLink) DeleteAddress(name, cidr string) error { return errUnsupported }
+func (l *unsupportedLink) SetUp(name string) error               { return errUnsupported }
+func (l *unsupportedLink) SetDown(name string) error             { return errUnsupported }
+func (l *unsupportedLink) AddRoute(name, cidr string) error      { return errUnsupported }
+func (l *unsupportedLink) DeleteRoute(name, cidr string) error   { return errUnsupported }
+func (l *unsupportedLink) Routes(name string) ([]string, error)  { return nil, errUnsupported }
+func (l *unsupportedLink) AddVeth(name, peer string) error       { return errUnsupported }
+func (l *unsupportedLink) MoveToNetns(name, netns string) error  { return errUnsupported }
+func (l *unsupportedLink) AddDefaultRoute(name, gw string) error { return errUnsupported }
+func (l *unsupportedLink) Exists(name string) bool               { return false }
@@ -62,18 +62,46 @@ func (mr *MockCliInterfaceMockRecorder) AddRoute(cidr interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRoute", reflect.TypeOf((*MockCliInterface)(nil).AddRoute), cidr)
 }
 
-// RemoveDevice mocks base method.
-func (m *MockCliInterface) RemoveDevice() *exec.Cmd {
+// Device mocks base method.
+func (m *MockCliInterface) Device(withIPv6 bool) *Device {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RemoveDevice")
+	ret := m.ctrl.Call(m, "Device", withIPv6)
+	ret0, _ := ret[0].(*Device)
+	return ret0
+}
+
+// Device indicates an expected call of Device.
+func (mr *MockCliInterfaceMockRecorder) Device(withIPv6 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Device", reflect.TypeOf((*MockCliInterface)(nil).Device), withIPv6)
+}
+
+// Namespace mocks base method.
+func (m *MockCliInterface) Namespace(subnet string) *Namespace {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Namespace", subnet)
+	ret0, _ := ret[0].(*Namespace)
+	return ret0
+}
+
+// Namespace indicates an expected call of Namespace.
+func (mr *MockCliInterfaceMockRecorder) Namespace(subnet interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Namespace", reflect.TypeOf((*MockCliInterface)(nil).Namespace), subnet)
+}
+
+// RunInNetns mocks base method.
+func (m *MockCliInterface) RunInNetns(command []string) *exec.Cmd {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunInNetns", command)
 	ret0, _ := ret[0].(*exec.Cmd)
 	return ret0
 }
 
-// RemoveDevice indicates an expected call of RemoveDevice.
-func (mr *MockCliInterfaceMockRecorder) RemoveDevice() *gomock.Call {
+// RunInNetns indicates an expected call of RunInNetns.
+func (mr *MockCliInterfaceMockRecorder) RunInNetns(command interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDevice", reflect.TypeOf((*MockCliInterface)(nil).RemoveDevice))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunInNetns", reflect.TypeOf((*MockCliInterface)(nil).RunInNetns), command)
 }
 
 // SetDeviceIP mocks base method.
@@ -90,6 +118,20 @@ func (mr *MockCliInterfaceMockRecorder) SetDeviceIP() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeviceIP", reflect.TypeOf((*MockCliInterface)(nil).SetDeviceIP))
 }
 
+// SetDeviceIP6 mocks base method.
+func (m *MockCliInterface) SetDeviceIP6() *exec.Cmd {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDeviceIP6")
+	ret0, _ := ret[0].(*exec.Cmd)
+	return ret0
+}
+
+// SetDeviceIP6 indicates an expected call of SetDeviceIP6.
+func (mr *MockCliInterfaceMockRecorder) SetDeviceIP6() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeviceIP6", reflect.TypeOf((*MockCliInterface)(nil).SetDeviceIP6))
+}
+
 // SetDeviceUp mocks base method.
 func (m *MockCliInterface) SetDeviceUp() *exec.Cmd {
 	m.ctrl.T.Helper()
@@ -103,3 +145,18 @@ func (mr *MockCliInterfaceMockRecorder) SetDeviceUp() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeviceUp", reflect.TypeOf((*MockCliInterface)(nil).SetDeviceUp))
 }
+
+// Teardown mocks base method.
+func (m *MockCliInterface) Teardown() ([]RouteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Teardown")
+	ret0, _ := ret[0].([]RouteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Teardown indicates an expected call of Teardown.
+func (mr *MockCliInterfaceMockRecorder) Teardown() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Teardown", reflect.TypeOf((*MockCliInterface)(nil).Teardown))
+}
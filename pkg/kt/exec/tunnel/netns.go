@@ -0,0 +1,221 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NetnsDir folder of named network namespaces, same as 'ip netns'
+const NetnsDir = "/var/run/netns"
+
+// Rule iptables rule in specified table and chain
+type Rule struct {
+	Table string
+	Chain string
+	Spec  []string
+}
+
+// Host native operations on network namespaces, ip forwarding and iptables rules of host
+type Host interface {
+	AddNetns(name string) error
+	DeleteNetns(name string) error
+	// Netns names of existing network namespaces
+	Netns() ([]string, error)
+	// NetnsLink link operations inside network namespace
+	NetnsLink(name string) (Link, error)
+	IPForward() (bool, error)
+	SetIPForward(enabled bool) error
+	AddRule(rule Rule) error
+	// DeleteRule remove rule, it's not an error if rule not exists
+	DeleteRule(rule Rule) error
+}
+
+// Namespace network namespace of process scoped connection, cluster is reached via tun device moved into it,
+// and other networks via a veth pair to host with nat, every change is recorded so that a failed setup can be rolled back
+type Namespace struct {
+	Name string
+	// Subnet /30 network of veth pair, host side takes the first address and namespace side takes the second
+	Subnet string
+	host   Host
+	link   Link
+	inner  Link
+	tx     *Transaction
+}
+
+// NewNamespace create network namespace operated via host, link operates devices in host
+func NewNamespace(host Host, link Link, name, subnet string) *Namespace {
+	return &Namespace{Name: name, Subnet: subnet, host: host, link: link, tx: &Transaction{}}
+}
+
+// host side of veth pair, name of network namespace should be no longer than 13 characters
+func hostVeth(netns string) string {
+	return netns + "-h"
+}
+
+// namespace side of veth pair
+func peerVeth(netns string) string {
+	return netns + "-n"
+}
+
+// vethAddresses host and namespace side addresses of subnet, e.g. 169.254.231.0/30 -> 169.254.231.1/30, 169.254.231.2/30
+func vethAddresses(subnet string) (hostSide, peerSide string, err error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", "", err
+	}
+	ones, _ := ipNet.Mask.Size()
+	ip := ipNet.IP.To4()
+	if ip == nil || ones > 30 {
+		return "", "", fmt.Errorf("subnet %s of veth pair should be an ipv4 network with at least 4 ips", subnet)
+	}
+	hostIP := net.IPv4(ip[0], ip[1], ip[2], ip[3]+1)
+	peerIP := net.IPv4(ip[0], ip[1], ip[2], ip[3]+2)
+	return fmt.Sprintf("%s/%d", hostIP, ones), fmt.Sprintf("%s/%d", peerIP, ones), nil
+}
+
+// natRules masquerade traffic from namespace, and accept its forwarding in case policy of FORWARD chain is DROP
+func natRules(subnet, veth string) []Rule {
+	return []Rule{
+		{Table: "nat", Chain: "POSTROUTING", Spec: []string{"-s", subnet, "!", "-o", veth, "-j", "MASQUERADE"}},
+		{Table: "filter", Chain: "FORWARD", Spec: []string{"-i", veth, "-j", "ACCEPT"}},
+		{Table: "filter", Chain: "FORWARD", Spec: []string{"-o", veth, "-m", "conntrack",
+			"--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}},
+	}
+}
+
+// ForwardEnabled whether ip forwarding of host is already enabled
+func (n *Namespace) ForwardEnabled() bool {
+	enabled, err := n.host.IPForward()
+	return err == nil && enabled
+}
+
+// Create add network namespace with loopback up, and a veth pair to host as its default route,
+// traffic leaving host via other devices is masqueraded, so that internet, lan and host are reachable in namespace
+func (n *Namespace) Create() error {
+	err := n.tx.Do(fmt.Sprintf("add network namespace %s", n.Name),
+		func() error { return n.host.AddNetns(n.Name) },
+		func() error { return n.host.DeleteNetns(n.Name) })
+	if err != nil {
+		return err
+	}
+	if n.inner, err = n.host.NetnsLink(n.Name); err != nil {
+		return err
+	}
+	// changes inside namespace are reverted along with it
+	err = n.tx.Do(fmt.Sprintf("set loopback of %s up", n.Name),
+		func() error { return n.inner.SetUp("lo") }, nil)
+	if err != nil {
+		return err
+	}
+
+	hostAddress, peerAddress, err := vethAddresses(n.Subnet)
+	if err != nil {
+		return err
+	}
+	veth, peer := hostVeth(n.Name), peerVeth(n.Name)
+	err = n.tx.Do(fmt.Sprintf("add veth pair %s and %s", veth, peer),
+		func() error { return n.link.AddVeth(veth, peer) },
+		func() error { return n.link.DeleteLink(veth) })
+	if err != nil {
+		return err
+	}
+	err = n.tx.Do(fmt.Sprintf("move %s into %s", peer, n.Name),
+		func() error { return n.link.MoveToNetns(peer, n.Name) }, nil)
+	if err != nil {
+		return err
+	}
+	if err = (&Device{Name: veth, Addresses: []string{hostAddress}, link: n.link, tx: n.tx}).Configure(); err != nil {
+		return err
+	}
+	if err = (&Device{Name: peer, Addresses: []string{peerAddress}, link: n.inner, tx: n.tx}).Configure(); err != nil {
+		return err
+	}
+	gateway := strings.Split(hostAddress, "/")[0]
+	err = n.tx.Do(fmt.Sprintf("add default route via %s in %s", gateway, n.Name),
+		func() error { return n.inner.AddDefaultRoute(peer, gateway) }, nil)
+	if err != nil {
+		return err
+	}
+
+	if !n.ForwardEnabled() {
+		err = n.tx.Do("enable ip forwarding",
+			func() error { return n.host.SetIPForward(true) },
+			func() error { return RestoreIPForward(n.host, n.link, n.Name) })
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range natRules(n.Subnet, veth) {
+		rule := r
+		err = n.tx.Do(fmt.Sprintf("add %s rule '%s'", rule.Chain, strings.Join(rule.Spec, " ")),
+			func() error { return n.host.AddRule(rule) },
+			func() error { return n.host.DeleteRule(rule) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTun create tun device in host, which should be attached by ssh before moved into namespace,
+// it's configured after moved since addresses of device are lost when moving
+func (n *Namespace) AddTun(name string, mtu int) error {
+	return (&Device{Name: name, MTU: mtu, link: n.link, tx: n.tx}).add()
+}
+
+// MoveTun move tun device into namespace, where its addresses are set again and cidrs are routed to it
+func (n *Namespace) MoveTun(name string, addresses, cidrs []string) error {
+	err := n.tx.Do(fmt.Sprintf("move %s into %s", name, n.Name),
+		func() error { return n.link.MoveToNetns(name, n.Name) },
+		func() error { return n.inner.MoveToNetns(name, "") })
+	if err != nil {
+		return err
+	}
+	device := &Device{Name: name, Addresses: addresses, link: n.inner, tx: n.tx}
+	if err = device.Configure(); err != nil {
+		return err
+	}
+	return device.AddRoutes(cidrs)
+}
+
+// Rollback undo all changes of namespace in reverse order, which removes it completely
+func (n *Namespace) Rollback() []error {
+	return n.tx.Rollback()
+}
+
+// RemoveNamespace remove network namespace left by exited process, as well as its veth pair and nat rules,
+// devices inside namespace are removed along with it
+func RemoveNamespace(host Host, link Link, name, subnet string) (errs []error) {
+	if subnet != "" {
+		for _, rule := range natRules(subnet, hostVeth(name)) {
+			if err := host.DeleteRule(rule); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if link.Exists(hostVeth(name)) {
+		if err := link.DeleteLink(hostVeth(name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := host.DeleteNetns(name); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
+
+// RestoreIPForward disable ip forwarding which was enabled for network namespaces,
+// unless it's still required by namespace other than the excluded one
+func RestoreIPForward(host Host, link Link, exclude string) error {
+	names, err := host.Netns()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name != exclude && link.Exists(hostVeth(name)) {
+			return nil
+		}
+	}
+	return host.SetIPForward(false)
+}
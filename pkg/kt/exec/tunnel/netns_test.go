@@ -0,0 +1,145 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeHost record operations, and fail the operation specified
+type fakeHost struct {
+	ops     []string
+	failOn  string
+	netns   []string
+	forward bool
+	inner   *fakeLink
+}
+
+func (h *fakeHost) do(op string) error {
+	if op == h.failOn {
+		return errors.New("operation not permitted")
+	}
+	h.ops = append(h.ops, op)
+	return nil
+}
+
+func (h *fakeHost) AddNetns(name string) error          { return h.do("add netns " + name) }
+func (h *fakeHost) DeleteNetns(name string) error       { return h.do("del netns " + name) }
+func (h *fakeHost) Netns() ([]string, error)            { return h.netns, nil }
+func (h *fakeHost) NetnsLink(name string) (Link, error) { return h.inner, nil }
+func (h *fakeHost) IPForward() (bool, error)            { return h.forward, nil }
+func (h *fakeHost) SetIPForward(enabled bool) error {
+	return h.do(fmt.Sprintf("forward %t", enabled))
+}
+func (h *fakeHost) AddRule(rule Rule) error {
+	return h.do(fmt.Sprintf("rule add %s %s", rule.Chain, strings.Join(rule.Spec, " ")))
+}
+func (h *fakeHost) DeleteRule(rule Rule) error {
+	return h.do(fmt.Sprintf("rule del %s %s", rule.Chain, strings.Join(rule.Spec, " ")))
+}
+
+func TestNamespace_Create(t *testing.T) {
+	host := &fakeHost{inner: &fakeLink{}}
+	link := &fakeLink{}
+	ns := NewNamespace(host, link, "kt-abcde", "169.254.231.4/30")
+	if err := ns.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.AddTun("tun0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.MoveTun("tun0", []string{"10.1.1.1/30"}, []string{"10.96.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	wantHost := []string{"add netns kt-abcde", "forward true",
+		"rule add POSTROUTING -s 169.254.231.4/30 ! -o kt-abcde-h -j MASQUERADE",
+		"rule add FORWARD -i kt-abcde-h -j ACCEPT",
+		"rule add FORWARD -o kt-abcde-h -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT"}
+	if !reflect.DeepEqual(host.ops, wantHost) {
+		t.Errorf("host operations = %v, want %v", host.ops, wantHost)
+	}
+	wantLink := []string{"add veth kt-abcde-h kt-abcde-n", "move kt-abcde-n to 'kt-abcde'",
+		"addr add kt-abcde-h 169.254.231.5/30", "up kt-abcde-h", "add tun0", "move tun0 to 'kt-abcde'"}
+	if !reflect.DeepEqual(link.ops, wantLink) {
+		t.Errorf("link operations = %v, want %v", link.ops, wantLink)
+	}
+	wantInner := []string{"up lo", "addr add kt-abcde-n 169.254.231.6/30", "up kt-abcde-n",
+		"route add kt-abcde-n default via 169.254.231.5", "addr add tun0 10.1.1.1/30", "up tun0",
+		"route add tun0 10.96.0.0/16"}
+	if !reflect.DeepEqual(host.inner.ops, wantInner) {
+		t.Errorf("operations in namespace = %v, want %v", host.inner.ops, wantInner)
+	}
+}
+
+func TestNamespace_RollbackFailedCreate(t *testing.T) {
+	host := &fakeHost{inner: &fakeLink{}, forward: true,
+		failOn: "rule add FORWARD -i kt-abcde-h -j ACCEPT"}
+	link := &fakeLink{}
+	ns := NewNamespace(host, link, "kt-abcde", "169.254.231.0/30")
+	if err := ns.Create(); err == nil {
+		t.Fatal("expect error of adding rule")
+	}
+	host.ops, link.ops = nil, nil
+	if errs := ns.Rollback(); len(errs) != 0 {
+		t.Errorf("unexpected rollback errors %v", errs)
+	}
+	wantHost := []string{"rule del POSTROUTING -s 169.254.231.0/30 ! -o kt-abcde-h -j MASQUERADE", "del netns kt-abcde"}
+	if !reflect.DeepEqual(host.ops, wantHost) {
+		t.Errorf("host rollback operations = %v, want %v", host.ops, wantHost)
+	}
+	wantLink := []string{"down kt-abcde-h", "addr del kt-abcde-h 169.254.231.1/30", "del kt-abcde-h"}
+	if !reflect.DeepEqual(link.ops, wantLink) {
+		t.Errorf("link rollback operations = %v, want %v", link.ops, wantLink)
+	}
+}
+
+func TestNamespace_RollbackMovedTun(t *testing.T) {
+	host := &fakeHost{inner: &fakeLink{failOn: "route add tun0 10.96.0.0/16"}, forward: true}
+	link := &fakeLink{}
+	ns := NewNamespace(host, link, "kt-abcde", "169.254.231.0/30")
+	if err := ns.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.AddTun("tun0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.MoveTun("tun0", []string{"10.1.1.1/30"}, []string{"10.96.0.0/16"}); err == nil {
+		t.Fatal("expect error of adding route")
+	}
+	link.ops, host.inner.ops = nil, nil
+	ns.Rollback()
+	if !reflect.DeepEqual(host.inner.ops[:3], []string{"down tun0", "addr del tun0 10.1.1.1/30", "move tun0 to ''"}) {
+		t.Errorf("tun should be moved back to host on rollback, operations %v", host.inner.ops)
+	}
+	if link.ops[0] != "del tun0" {
+		t.Errorf("tun should be removed from host on rollback, operations %v", link.ops)
+	}
+}
+
+func TestRestoreIPForward(t *testing.T) {
+	host := &fakeHost{netns: []string{"kt-abcde", "kt-fghij"}}
+	link := &fakeLink{links: []string{"kt-fghij-h"}}
+	if err := RestoreIPForward(host, link, "kt-abcde"); err != nil || len(host.ops) != 0 {
+		t.Errorf("forwarding is still required by kt-fghij, operations %v", host.ops)
+	}
+	if err := RestoreIPForward(host, link, "kt-fghij"); err != nil ||
+		!reflect.DeepEqual(host.ops, []string{"forward false"}) {
+		t.Errorf("forwarding should be disabled, operations %v", host.ops)
+	}
+}
+
+func TestRemoveNamespace(t *testing.T) {
+	host := &fakeHost{}
+	link := &fakeLink{links: []string{"kt-abcde-h"}}
+	if errs := RemoveNamespace(host, link, "kt-abcde", "169.254.231.0/30"); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(host.ops) != 4 || host.ops[3] != "del netns kt-abcde" {
+		t.Errorf("rules and namespace should be removed, operations %v", host.ops)
+	}
+	if !reflect.DeepEqual(link.ops, []string{"del kt-abcde-h"}) {
+		t.Errorf("veth pair should be removed, operations %v", link.ops)
+	}
+}
@@ -0,0 +1,45 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+type undoStep struct {
+	name string
+	undo func() error
+}
+
+// Transaction record applied steps, so that a partial setup can be rolled back
+type Transaction struct {
+	steps []undoStep
+}
+
+// Do apply a step, its undo function is recorded only if applied successfully,
+// undo could be nil when the change is reverted along with a former step, e.g. address of device deleted
+func (t *Transaction) Do(name string, apply func() error, undo func() error) error {
+	if err := apply(); err != nil {
+		return fmt.Errorf("failed to %s: %s", name, err)
+	}
+	t.steps = append(t.steps, undoStep{name: name, undo: undo})
+	return nil
+}
+
+// Rollback undo applied steps in reverse order, failed steps are returned
+func (t *Transaction) Rollback() (errs []error) {
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		step := t.steps[i]
+		if step.undo == nil {
+			continue
+		}
+		if err := step.undo(); err != nil {
+			log.Warn().Msgf("Failed to undo '%s': %s", step.name, err)
+			errs = append(errs, fmt.Errorf("failed to undo '%s': %s", step.name, err))
+		} else {
+			log.Info().Msgf("Undo '%s' successful", step.name)
+		}
+	}
+	t.steps = nil
+	return
+}
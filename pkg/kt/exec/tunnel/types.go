@@ -6,9 +6,13 @@ import "os/exec"
 type CliInterface interface {
 	AddRoute(cidr string) *exec.Cmd
 	AddDevice() *exec.Cmd
-	RemoveDevice() *exec.Cmd
 	SetDeviceIP() *exec.Cmd
+	SetDeviceIP6() *exec.Cmd
 	SetDeviceUp() *exec.Cmd
+	Namespace(subnet string) *Namespace
+	RunInNetns(command []string) *exec.Cmd
+	Device(withIPv6 bool) *Device
+	Teardown() ([]RouteResult, error)
 }
 
 // Cli ...
@@ -17,4 +21,11 @@ type Cli struct {
 	SourceIP string
 	DestIP   string
 	MaskLen  string
+	// SourceIP6 and MaskLen6 are used when cluster has ipv6 network
+	SourceIP6 string
+	MaskLen6  string
+	// MTU mtu of tun device
+	MTU int
+	// Netns network namespace of process scoped connection
+	Netns string
 }
@@ -1,6 +1,8 @@
 package exec
 
 import (
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/agentchannel"
 	"github.com/alibaba/kt-connect/pkg/kt/exec/kubectl"
 	"github.com/alibaba/kt-connect/pkg/kt/exec/portforward"
 	"github.com/alibaba/kt-connect/pkg/kt/exec/ssh"
@@ -26,7 +28,16 @@ type Cli struct {
 	SourceIP    string
 	DestIP      string
 	// MaskLen the net mask length of tun cidr
-	MaskLen string
+	MaskLen   string
+	SourceIP6 string
+	// MaskLen6 the net mask length of ipv6 tun cidr
+	MaskLen6 string
+	// TunMTU mtu of tun device
+	TunMTU int
+	// Transport protocol of channel to shadow
+	Transport string
+	// Netns network namespace of process scoped connection
+	Netns string
 }
 
 // PortForward ...
@@ -34,8 +45,11 @@ func (c *Cli) PortForward() portforward.CliInterface {
 	return &portforward.Cli{}
 }
 
-// SshChannel ...
+// SshChannel channel to shadow, via sshd or agent according to transport
 func (c *Cli) SshChannel() sshchannel.Channel {
+	if c.Transport == common.TransportAgent {
+		return &agentchannel.AgentChannel{}
+	}
 	return &sshchannel.SSHChannel{}
 }
 
@@ -56,9 +70,13 @@ func (c *Cli) SSH() ssh.CliInterface {
 
 func (c *Cli) Tunnel() tunnel.CliInterface {
 	return &tunnel.Cli{
-		TunName:  c.TunName,
-		SourceIP: c.SourceIP,
-		DestIP:   c.DestIP,
-		MaskLen:  c.MaskLen,
+		TunName:   c.TunName,
+		SourceIP:  c.SourceIP,
+		DestIP:    c.DestIP,
+		MaskLen:   c.MaskLen,
+		SourceIP6: c.SourceIP6,
+		MaskLen6:  c.MaskLen6,
+		MTU:       c.TunMTU,
+		Netns:     c.Netns,
 	}
 }
@@ -2,7 +2,9 @@ package options
 
 import (
 	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/kt/exec/tunnel"
 	"github.com/alibaba/kt-connect/pkg/kt/registry"
+	coordinationV1 "k8s.io/api/coordination/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -28,12 +30,28 @@ type ConnectOptions struct {
 	ShareShadow          bool
 	TunName              string
 	TunCidr              string
+	TunCidr6             string
 	ClusterDomain        string
 	JvmrcDir             string
+	Contexts             cli.StringSlice
+	// DNSUpstreams upstream nameservers of shadow dns server, separate by comma
+	DNSUpstreams string
+	// DNSForwards upstream nameserver of specified domains, e.g. 'corp.example.com=10.0.0.2'
+	DNSForwards string
+	// DNSOverrides static answers of specified names, e.g. 'tomcat=127.0.0.1,*.example.com=10.0.0.2'
+	DNSOverrides string
+	// DNSResolver how shadow dns server resolves cluster names, 'upstream' or 'kubernetes'
+	DNSResolver string
+	// IngressController '<namespace>/<name>' of ingress controller service, auto detected if empty
+	IngressController string
+	// TunMTU mtu of tun device
+	TunMTU int
 
 	// Used for tun mode
-	SourceIP string
-	DestIP   string
+	SourceIP  string
+	DestIP    string
+	SourceIP6 string
+	DestIP6   string
 }
 
 // ExchangeOptions ...
@@ -51,6 +69,18 @@ type MeshOptions struct {
 type CleanOptions struct {
 	DryRun           bool
 	ThresholdInMinus int64
+	// AllNamespaces clean shadows of all namespaces instead of current namespace
+	AllNamespaces bool
+	// Selector only clean shadows match the label selector, e.g. 'kt-component=connect'
+	Selector string
+	// User only clean shadows created by specified local user
+	User string
+	// RemoteAddress only clean shadows created from specified local address
+	RemoteAddress string
+	// Output format of dry run result, 'table' or 'json'
+	Output string
+	// LocalOnly only revert local changes recorded in journal, cluster resources are not touched
+	LocalOnly bool
 }
 
 // RuntimeOptions ...
@@ -72,12 +102,36 @@ type RuntimeOptions struct {
 	Replicas int32
 	// Service exposed service name
 	Service string
+	// Subset version subset of istio destination rules used by mesh
+	Subset string
+	// Lease lease of current session, which owns all resources created in the session
+	Lease *coordinationV1.Lease
+	// LeaseForbidden current user is not allowed to create leases, resources are kept alive by heartbeat annotation
+	LeaseForbidden bool
 	// Dump2Host whether dump2host enabled
 	Dump2Host bool
+	// StopHostsRefresh stop refreshing dumped hosts when closed
+	StopHostsRefresh chan struct{}
+	// HostsRefreshDone closed once hosts refreshing stopped
+	HostsRefreshDone <-chan struct{}
 	// ProxyConfig windows global proxy config
 	ProxyConfig registry.ProxyConfig
 	// RestConfig kubectl config
 	RestConfig *rest.Config
+	// Context kubeconfig context of current cluster, only used when connecting to multiple clusters
+	Context string
+	// Clusters options of each cluster when connecting to multiple clusters
+	Clusters []*DaemonOptions
+	// IngressHosts hosts of ingresses and http routes, mapped to cluster ip of ingress controller
+	IngressHosts map[string]string
+	// ServiceForwards remote endpoint of each local loopback endpoint, only used by forward method
+	ServiceForwards map[string]string
+	// LoopbackBlock block of loopback ips owned by current session, only used by forward method
+	LoopbackBlock int
+	// Netns network namespace created by run command
+	Netns string
+	// Namespace changes made to create the network namespace, which are rolled back on exit
+	Namespace *tunnel.Namespace
 }
 
 type dashboardOptions struct {
@@ -104,6 +158,32 @@ type DaemonOptions struct {
 	WaitTime          int
 	ForceUpdateShadow bool
 	UseKubectl        bool
+	// PodPatch path of strategic-merge patch file applied to shadow pod template
+	PodPatch string
+	// NodeSelector node selector of shadow pod, e.g. 'k1=v1,k2=v2'
+	NodeSelector string
+	// PodAnnotations extra annotations of shadow pod, e.g. 'k1=v1,k2=v2'
+	PodAnnotations string
+	// Resources resource requests and limits of shadow container, e.g. 'requests.cpu=100m,limits.memory=128Mi'
+	Resources string
+	// ImagePullSecrets secrets used to pull shadow image, separate by comma
+	ImagePullSecrets string
+	// PriorityClass priority class name of shadow pod
+	PriorityClass string
+	// Restricted run shadow as non-root without privilege, compatible with 'restricted' pod security standard
+	Restricted bool
+	// Transport protocol between ktctl and shadow, 'ssh' or 'agent'
+	Transport string
+	// KeyType type of ssh key, 'rsa' or 'ed25519'
+	KeyType string
+	// CacheKey reuse ssh key cached in kt home across sessions
+	CacheKey bool
+	// KeyRotation days before cached ssh key get regenerated
+	KeyRotation int
+	// LogFormat format of log output, 'console' or 'json'
+	LogFormat string
+	// MetricsAddress address of prometheus metrics endpoint, disabled when empty
+	MetricsAddress string
 }
 
 // NewDaemonOptions return new cli default options
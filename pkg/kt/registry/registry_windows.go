@@ -1,7 +1,9 @@
 package registry
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/alibaba/kt-connect/pkg/kt/util"
 	"golang.org/x/sys/windows/registry"
 	"strings"
 	"syscall"
@@ -45,6 +47,8 @@ func SetGlobalProxy(port int, config *ProxyConfig) error {
 	if err != nil {
 		config.ProxyOverride = notExist
 	}
+	original, _ := json.Marshal(config)
+	util.RecordMutation(util.MutationGlobalProxy, "", string(original))
 
 	internetSettings.SetDWordValue(RegKeyProxyEnable, 1)
 	internetSettings.SetStringValue(RegKeyProxyServer, fmt.Sprintf("%s%d", IntSocksLocalhost, port))
@@ -81,6 +85,8 @@ func SetHttpProxyEnvironmentVariable(port int, config *ProxyConfig) error {
 	if err != nil {
 		config.HttpProxyVar = notExist
 	}
+	original, _ := json.Marshal(config)
+	util.RecordMutation(util.MutationProxyEnv, "", string(original))
 
 	internetSettings.SetStringValue(RegKeyHttpProxy, fmt.Sprintf("%s%d", EnvSocksLocalhost, port))
 	refreshEnvironmentVariable()
@@ -22,7 +22,7 @@ type Cli struct {
 
 // Kubernetes ...
 func (c *Cli) Kubernetes() (cluster.KubernetesInterface, error) {
-	return cluster.CreateFromClientSet(c.Options.RuntimeOptions.Clientset)
+	return cluster.CreateFromClientSetAndConfig(c.Options.RuntimeOptions.Clientset, c.Options.RuntimeOptions.RestConfig)
 }
 
 // Shadow ...
@@ -40,5 +40,10 @@ func (c *Cli) Exec() exec.CliInterface {
 		SourceIP:    c.Options.ConnectOptions.SourceIP,
 		DestIP:      c.Options.ConnectOptions.DestIP,
 		MaskLen:     util.ExtractNetMaskFromCidr(c.Options.ConnectOptions.TunCidr),
+		SourceIP6:   c.Options.ConnectOptions.SourceIP6,
+		MaskLen6:    util.ExtractNetMaskFromCidr(c.Options.ConnectOptions.TunCidr6),
+		TunMTU:      c.Options.ConnectOptions.TunMTU,
+		Transport:   c.Options.Transport,
+		Netns:       c.Options.RuntimeOptions.Netns,
 	}
 }
@@ -0,0 +1,24 @@
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// LockFile acquire exclusive advisory lock of a file, blocks until the lock is released by other ktctl process
+func LockFile(path string) (unlock func(), err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,43 @@
+// +build !windows
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "kt-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	unlock, err := LockFile(f.Name())
+	if err != nil {
+		t.Fatalf("failed to lock file: %s", err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlockAgain, err := LockFile(f.Name())
+		if err == nil {
+			unlockAgain()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("lock should not be acquired before released")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Errorf("lock should be acquired after released")
+	}
+}
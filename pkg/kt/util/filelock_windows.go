@@ -0,0 +1,26 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// LockFile acquire exclusive lock of a file, blocks until the lock is released by other ktctl process,
+// a separate lock file is used since windows lock is mandatory and would block writing to the file itself
+func LockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(filepath.Join(os.TempDir(), "kt-"+filepath.Base(path)+".lock"), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	handle := windows.Handle(f.Fd())
+	if err = windows.LockFileEx(handle, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = windows.UnlockFileEx(handle, 0, 1, 0, &windows.Overlapped{})
+		f.Close()
+	}, nil
+}
@@ -3,10 +3,11 @@ package util
 import (
 	"fmt"
 	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/metrics"
 	"github.com/rs/zerolog/log"
-	"k8s.io/apimachinery/pkg/types"
-	appV1 "k8s.io/client-go/kubernetes/typed/apps/v1"
-	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationV1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/util/retry"
 	"net"
 	"time"
 )
@@ -14,46 +15,40 @@ import (
 const ResourceHeartBeatIntervalMinus = 5
 const portForwardHeartBeatIntervalSec = 30
 
-// SetupDeploymentHeartBeat setup heartbeat watcher for deployment
-func SetupDeploymentHeartBeat(client appV1.DeploymentInterface, name string) {
+// SetupLeaseHeartBeat renew session lease periodically, failed renewal is retried with backoff
+func SetupLeaseHeartBeat(client coordinationV1.LeaseInterface, name string) {
 	ticker := time.NewTicker(time.Minute * ResourceHeartBeatIntervalMinus)
 	go func() {
 		for range ticker.C {
-			log.Debug().Msgf("Heartbeat deployment %s ticked at %s", name, formattedTime())
-			_, err := client.Patch(name, types.JSONPatchType, []byte(resourceHeartbeatPatch()))
+			log.Debug().Msgf("Heartbeat lease %s ticked at %s", name, formattedTime())
+			err := retry.OnError(retry.DefaultBackoff, func(error) bool { return true }, func() error {
+				lease, err := client.Get(name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				_, err = client.Update(lease)
+				return err
+			})
 			if err != nil {
-				log.Error().Msg(err.Error())
-				return
+				metrics.HeartbeatFailures.WithLabelValues("lease").Inc()
+				log.Error().Msgf("Failed to renew lease %s: %s", name, err)
 			}
 		}
 	}()
 }
 
-// SetupServiceHeartBeat setup heartbeat watcher for service
-func SetupServiceHeartBeat(client v1.ServiceInterface, name string) {
+// SetupResourceHeartBeat patch heartbeat annotation of resource periodically,
+// used instead of session lease when current user is not allowed to create leases
+func SetupResourceHeartBeat(kind, name string, patch func(data []byte) error) {
 	ticker := time.NewTicker(time.Minute * ResourceHeartBeatIntervalMinus)
 	go func() {
 		for range ticker.C {
-			log.Debug().Msgf("Heartbeat service %s ticked at %s", name, formattedTime())
-			_, err := client.Patch(name, types.JSONPatchType, []byte(resourceHeartbeatPatch()))
-			if err != nil {
-				log.Error().Msg(err.Error())
-				return
-			}
-		}
-	}()
-}
-
-// SetupConfigMapHeartBeat setup heartbeat watcher for config map
-func SetupConfigMapHeartBeat(client v1.ConfigMapInterface, name string) {
-	ticker := time.NewTicker(time.Minute * ResourceHeartBeatIntervalMinus)
-	go func() {
-		for range ticker.C {
-			log.Debug().Msgf("Heartbeat configmap %s ticked at %s", name, formattedTime())
-			_, err := client.Patch(name, types.JSONPatchType, []byte(resourceHeartbeatPatch()))
-			if err != nil {
-				log.Error().Msg(err.Error())
-				return
+			log.Debug().Msgf("Heartbeat %s %s ticked at %s", kind, name, formattedTime())
+			if err := patch([]byte(resourceHeartbeatPatch())); err != nil {
+				metrics.HeartbeatFailures.WithLabelValues(kind).Inc()
+				log.Error().Msgf("Failed to update heartbeat of %s %s: %s", kind, name, err)
 			}
 		}
 	}()
@@ -63,13 +58,22 @@ func SetupConfigMapHeartBeat(client v1.ConfigMapInterface, name string) {
 func SetupPortForwardHeartBeat(port int) {
 	ticker := time.NewTicker(time.Second * portForwardHeartBeatIntervalSec)
 	go func() {
+		broken := false
 		for range ticker.C {
 			conn, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
 			if err == nil {
 				log.Debug().Msgf("Heartbeat port forward %d ticked at %s", port, formattedTime())
 				_ = conn.Close()
+				if broken {
+					// count once when a broken port forward comes back, not on every failed tick
+					metrics.Reconnects.WithLabelValues("port-forward").Inc()
+					log.Info().Msgf("Port forward %d re-established", port)
+					broken = false
+				}
 			} else {
+				metrics.HeartbeatFailures.WithLabelValues("port-forward").Inc()
 				log.Debug().Msgf("Heartbeat port forward %d ticked failed %s", port, err)
+				broken = true
 			}
 		}
 	}()
@@ -6,53 +6,148 @@ import (
 	"github.com/rs/zerolog/log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const ktHostsEscapeBegin = "# Kt Hosts Begin"
 const ktHostsEscapeEnd = "# Kt Hosts End"
 
-// DropHosts ...
+// hostEntry a line in kt hosts block, shared by all ktctl sessions need it
+type hostEntry struct {
+	ip       string
+	host     string
+	sessions []int
+}
+
+var (
+	// dumpLock serialize dumping hosts of current session with stopping it
+	dumpLock sync.Mutex
+	// dumpStopped hosts are no longer dumped once session is cleaning up
+	dumpStopped bool
+)
+
+// StopDumpHosts prevent hosts from being dumped again, e.g. by a refresh still running when session exits,
+// it waits for the dumping in progress
+func StopDumpHosts() {
+	dumpLock.Lock()
+	defer dumpLock.Unlock()
+	dumpStopped = true
+}
+
+// DropHosts remove hosts of current session, a host is kept if still needed by other running session
 func DropHosts() {
-	lines, err := loadHostsFile()
-	if err != nil {
-		log.Error().Msgf("Failed to load hosts file: %s", err.Error())
-		return
-	}
-	linesAfterDrop, err := dropHosts(lines)
+	updated, err := updateHosts(func(entries []hostEntry) []hostEntry {
+		return mergeHostEntries(entries, nil, os.Getpid())
+	})
 	if err != nil {
-		log.Error().Msgf("Failed to parse hosts file: %s", err.Error())
+		log.Error().Msgf("Failed to drop hosts, you may require %s permission: %s", getAdminUserName(), err.Error())
 		return
 	}
-	if len(linesAfterDrop) < len(lines) {
-		err = updateHostsFile(linesAfterDrop)
-		if err != nil {
-			log.Error().Msgf("Failed to update hosts file, you may require %s permission: %s",
-				getAdminUserName(), err.Error())
-			return
-		}
+	if updated {
 		log.Info().Msgf("Drop hosts successful")
 	}
 }
 
-// DumpHosts DumpToHosts
+// DumpHosts DumpToHosts, hosts previously dumped by current session but not in hostsMap are removed
 func DumpHosts(hostsMap map[string]string) {
-	lines, err := loadHostsFile()
-	if err != nil {
-		log.Error().Msgf("Failed to load hosts file: %s", err.Error())
+	dumpLock.Lock()
+	defer dumpLock.Unlock()
+	if dumpStopped {
+		log.Debug().Msg("Dumping hosts already stopped, skipped")
 		return
 	}
-	linesBeforeDump, err := dropHosts(lines)
+	RecordMutation(MutationHosts, "", "")
+	_, err := updateHosts(func(entries []hostEntry) []hostEntry {
+		return mergeHostEntries(entries, hostsMap, os.Getpid())
+	})
 	if err != nil {
-		log.Error().Msgf("Failed to parse hosts file: %s", err.Error())
+		log.Error().Msgf("Failed to dump hosts, you may require %s permission: %s", getAdminUserName(), err.Error())
 		return
 	}
-	err = updateHostsFile(mergeLines(linesBeforeDump, dumpHosts(hostsMap)))
+	log.Info().Msg("Dump hosts successful")
+}
+
+// updateHosts update entries of kt hosts block with file locked, the block is removed if no entry left
+func updateHosts(update func([]hostEntry) []hostEntry) (bool, error) {
+	unlock, err := LockFile(getHostsPath())
 	if err != nil {
-		log.Error().Msgf("Failed to update hosts file, you may require %s permission: %s",
-			getAdminUserName(), err.Error())
-		return
+		return false, err
 	}
-	log.Info().Msg("Dump hosts successful")
+	defer unlock()
+
+	lines, err := loadHostsFile()
+	if err != nil {
+		return false, err
+	}
+	linesBeforeDump, err := dropHosts(lines)
+	if err != nil {
+		return false, err
+	}
+	entries := parseHosts(lines)
+	updatedEntries := update(entries)
+	if len(updatedEntries) == 0 {
+		if len(linesBeforeDump) == len(lines) {
+			return false, nil
+		}
+		return true, updateHostsFile(linesBeforeDump)
+	}
+	return true, updateHostsFile(mergeLines(linesBeforeDump, dumpHosts(updatedEntries)))
+}
+
+// mergeHostEntries replace hosts of the session with hostsMap, and remove hosts no running session needs
+func mergeHostEntries(entries []hostEntry, hostsMap map[string]string, session int) []hostEntry {
+	var merged []hostEntry
+	for _, e := range entries {
+		include := 0
+		if ip, exists := hostsMap[e.host]; exists && ip == e.ip {
+			include = session
+		}
+		e.sessions = updateSessions(e.sessions, include, session)
+		if len(e.sessions) > 0 {
+			merged = append(merged, e)
+		}
+	}
+	var hosts []string
+	for host := range hostsMap {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if !hasHostEntry(merged, hostsMap[host], host) {
+			merged = append(merged, hostEntry{ip: hostsMap[host], host: host, sessions: []int{session}})
+		}
+	}
+	return merged
+}
+
+func hasHostEntry(entries []hostEntry, ip, host string) bool {
+	for _, e := range entries {
+		if e.ip == ip && e.host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHosts read entries in kt hosts block, lines without session tag were added by old version and treated as expired
+func parseHosts(rawLines []string) []hostEntry {
+	var entries []hostEntry
+	inBlock := false
+	for _, l := range rawLines {
+		if l == ktHostsEscapeBegin {
+			inBlock = true
+		} else if l == ktHostsEscapeEnd {
+			inBlock = false
+		} else if inBlock {
+			fields := strings.Fields(trimSessionTag(strings.TrimSpace(l)))
+			if len(fields) >= 2 {
+				entries = append(entries, hostEntry{ip: fields[0], host: fields[1], sessions: parseSessions(l)})
+			}
+		}
+	}
+	return entries
 }
 
 func dropHosts(rawLines []string) ([]string, error) {
@@ -83,11 +178,11 @@ func dropHosts(rawLines []string) ([]string, error) {
 	}
 }
 
-func dumpHosts(hostsMap map[string]string) []string {
+func dumpHosts(entries []hostEntry) []string {
 	var lines []string
 	lines = append(lines, ktHostsEscapeBegin)
-	for host, ip := range hostsMap {
-		lines = append(lines, fmt.Sprintf("%s %s", ip, host))
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s %s # %s", e.ip, e.host, formatSessions(e.sessions)))
 	}
 	lines = append(lines, ktHostsEscapeEnd)
 	return lines
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
 )
 
@@ -139,7 +142,7 @@ func TestDropHosts(t *testing.T) {
 
 func TestDumpHosts(t *testing.T) {
 	type args struct {
-		hostsToDump    map[string]string
+		entriesToDump  []hostEntry
 		linesAfterDump []string
 	}
 	tests := []struct {
@@ -149,28 +152,27 @@ func TestDumpHosts(t *testing.T) {
 		{
 			name: "empty hosts",
 			args: args{
-				hostsToDump:    map[string]string{},
+				entriesToDump:  []hostEntry{},
 				linesAfterDump: []string{"# Kt Hosts Begin", "# Kt Hosts End"},
 			},
 		},
 		{
 			name: "many hosts",
 			args: args{
-				hostsToDump:    map[string]string{"tomcat": "192.12.3.4", "nginx": "192.12.5.6"},
-				linesAfterDump: []string{"# Kt Hosts Begin", "192.12.3.4 tomcat", "192.12.5.6 nginx", "# Kt Hosts End"},
+				entriesToDump: []hostEntry{
+					{ip: "192.12.3.4", host: "tomcat", sessions: []int{100}},
+					{ip: "192.12.5.6", host: "nginx", sessions: []int{100, 200}},
+				},
+				linesAfterDump: []string{"# Kt Hosts Begin", "192.12.3.4 tomcat # kt-session:100",
+					"192.12.5.6 nginx # kt-session:100,200", "# Kt Hosts End"},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			linesAfterDump := dumpHosts(tt.args.hostsToDump)
-			if len(tt.args.linesAfterDump) != len(linesAfterDump) {
-				t.Errorf("should has %d lines, but got %d", len(tt.args.linesAfterDump), len(linesAfterDump))
-			}
-			for _, line := range tt.args.linesAfterDump {
-				if Contains(linesAfterDump, line) {
-					t.Errorf("hosts %s missing", line)
-				}
+			linesAfterDump := dumpHosts(tt.args.entriesToDump)
+			if !reflect.DeepEqual(tt.args.linesAfterDump, linesAfterDump) {
+				t.Errorf("hosts mismatch, expect %v got %v", tt.args.linesAfterDump, linesAfterDump)
 			}
 		})
 	}
@@ -233,3 +235,65 @@ func TestMergeHost(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeHostEntries(t *testing.T) {
+	originAlive := isSessionAlive
+	defer func() { isSessionAlive = originAlive }()
+	isSessionAlive = func(pid int) bool { return pid != 300 }
+
+	lines := []string{
+		"127.0.0.1 localhost",
+		"# Kt Hosts Begin",
+		"192.12.3.4 tomcat # kt-session:100",
+		"192.12.5.6 nginx # kt-session:100,200",
+		"192.12.7.8 mysql # kt-session:300",
+		"192.12.9.9 legacy",
+		"# Kt Hosts End",
+	}
+	entries := parseHosts(lines)
+	if len(entries) != 4 {
+		t.Fatalf("should parse 4 entries, but got %d", len(entries))
+	}
+
+	dumped := mergeHostEntries(entries, map[string]string{"nginx": "192.12.5.6", "redis": "192.12.1.1"}, 200)
+	expected := []hostEntry{
+		{ip: "192.12.3.4", host: "tomcat", sessions: []int{100}},
+		{ip: "192.12.5.6", host: "nginx", sessions: []int{100, 200}},
+		{ip: "192.12.1.1", host: "redis", sessions: []int{200}},
+	}
+	if !reflect.DeepEqual(dumped, expected) {
+		t.Errorf("hosts of dead session should be removed, expect %v got %v", expected, dumped)
+	}
+
+	dropped := mergeHostEntries(dumped, nil, 100)
+	expected = []hostEntry{
+		{ip: "192.12.5.6", host: "nginx", sessions: []int{200}},
+		{ip: "192.12.1.1", host: "redis", sessions: []int{200}},
+	}
+	if !reflect.DeepEqual(dropped, expected) {
+		t.Errorf("hosts still needed by other session should be kept, expect %v got %v", expected, dropped)
+	}
+
+	if left := mergeHostEntries(dropped, nil, 200); len(left) != 0 {
+		t.Errorf("no host should be left after all sessions dropped, but got %v", left)
+	}
+}
+
+func TestStopDumpHosts(t *testing.T) {
+	hosts, err := ioutil.TempFile("", "hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(hosts.Name())
+	_ = hosts.Close()
+	origin := os.Getenv("HOSTS_PATH")
+	defer os.Setenv("HOSTS_PATH", origin)
+	os.Setenv("HOSTS_PATH", hosts.Name())
+	defer func() { dumpStopped = false }()
+
+	StopDumpHosts()
+	DumpHosts(map[string]string{"tomcat": "192.12.3.4"})
+	if content, _ := ioutil.ReadFile(hosts.Name()); len(content) != 0 {
+		t.Errorf("hosts should not be dumped after stopped, got %s", content)
+	}
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// kinds of local mutation recorded in journal
+const (
+	MutationHosts       = "hosts"
+	MutationNameserver  = "nameserver"
+	MutationTunDevice   = "tun"
+	MutationGlobalProxy = "proxy"
+	MutationProxyEnv    = "proxyEnv"
+	MutationLoopback    = "loopback"
+	MutationNetns       = "netns"
+	MutationIPForward   = "ipForward"
+	MutationPidFile     = "pid"
+)
+
+const journalSuffix = ".journal"
+
+// Mutation a change to local machine, which is recorded before applied so that it can be undone after crash
+type Mutation struct {
+	Kind string `json:"kind"`
+	// Target object changed, e.g. name of tun device or network namespace
+	Target string `json:"target,omitempty"`
+	// Data state required to undo the change, e.g. original proxy config
+	Data string `json:"data,omitempty"`
+}
+
+// Journal mutations recorded by one ktctl process
+type Journal struct {
+	Pid       int
+	Path      string
+	Mutations []Mutation
+}
+
+var journalLock sync.Mutex
+var journalRecorded = map[string]bool{}
+
+// JournalDir folder of journal files
+func JournalDir() string {
+	return filepath.Join(KtHome, "journal")
+}
+
+func journalPath(pid int) string {
+	return filepath.Join(JournalDir(), fmt.Sprintf("%d%s", pid, journalSuffix))
+}
+
+// RecordMutation append a mutation to journal of current process and flush it to disk,
+// same kind and target is only recorded once, failure is only logged since the change itself should not be blocked
+func RecordMutation(kind, target, data string) {
+	if err := writeJournal(kind, target, data); err != nil {
+		log.Warn().Msgf("Failed to record %s change to journal: %s", kind, err)
+	}
+}
+
+func writeJournal(kind, target, data string) error {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	key := kind + "/" + target
+	if journalRecorded[key] {
+		return nil
+	}
+	line, err := json.Marshal(Mutation{Kind: kind, Target: target, Data: data})
+	if err != nil {
+		return err
+	}
+	CreateDirIfNotExist(JournalDir())
+	f, err := os.OpenFile(journalPath(os.Getpid()), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	journalRecorded[key] = true
+	return nil
+}
+
+// CloseJournal remove journal of current process, should be called after local changes are reverted
+func CloseJournal() {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	if err := os.Remove(journalPath(os.Getpid())); err != nil && !os.IsNotExist(err) {
+		log.Warn().Msgf("Failed to remove journal: %s", err)
+	}
+	journalRecorded = map[string]bool{}
+}
+
+// StaleJournals journals left by ktctl processes no longer running
+func StaleJournals() []Journal {
+	var journals []Journal
+	files, _ := ioutil.ReadDir(JournalDir())
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), journalSuffix) {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSuffix(f.Name(), journalSuffix))
+		if err != nil || pid == os.Getpid() || IsProcessExist(pid) {
+			continue
+		}
+		path := filepath.Join(JournalDir(), f.Name())
+		mutations, err := loadJournal(path)
+		if err != nil {
+			log.Warn().Msgf("Failed to read journal %s: %s", path, err)
+			continue
+		}
+		journals = append(journals, Journal{Pid: pid, Path: path, Mutations: mutations})
+	}
+	return journals
+}
+
+// loadJournal read mutations from journal file, a partially written last line is ignored
+func loadJournal(path string) ([]Mutation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mutations []Mutation
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m Mutation
+		if err = json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			log.Debug().Msgf("Skip broken journal line '%s'", scanner.Text())
+			continue
+		}
+		mutations = append(mutations, m)
+	}
+	return mutations, scanner.Err()
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func useTempKtHome(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "kt-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originHome := KtHome
+	KtHome = dir
+	return func() {
+		KtHome = originHome
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRecordMutation(t *testing.T) {
+	defer useTempKtHome(t)()
+	defer CloseJournal()
+
+	RecordMutation(MutationHosts, "", "")
+	RecordMutation(MutationTunDevice, "kt0", "")
+	RecordMutation(MutationHosts, "", "")
+	mutations, err := loadJournal(journalPath(os.Getpid()))
+	if err != nil {
+		t.Fatalf("failed to load journal: %s", err)
+	}
+	expected := []Mutation{{Kind: MutationHosts}, {Kind: MutationTunDevice, Target: "kt0"}}
+	if !reflect.DeepEqual(mutations, expected) {
+		t.Errorf("journal mismatch, expect %v got %v", expected, mutations)
+	}
+
+	CloseJournal()
+	if _, err = os.Stat(journalPath(os.Getpid())); !os.IsNotExist(err) {
+		t.Errorf("journal should be removed after closed")
+	}
+}
+
+func TestStaleJournals(t *testing.T) {
+	defer useTempKtHome(t)()
+	defer CloseJournal()
+
+	RecordMutation(MutationPidFile, "/tmp/connect.pid", "")
+	CreateDirIfNotExist(JournalDir())
+	deadPid := 4194304
+	content := `{"kind":"netns","target":"kt-abcde"}` + "\n" + `{"kind":"tun","tar`
+	if err := ioutil.WriteFile(filepath.Join(JournalDir(), fmt.Sprintf("%d.journal", deadPid)), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	journals := StaleJournals()
+	if len(journals) != 1 {
+		t.Fatalf("should only find journal of dead process, but got %d", len(journals))
+	}
+	if journals[0].Pid != deadPid {
+		t.Errorf("pid mismatch, expect %d got %d", deadPid, journals[0].Pid)
+	}
+	expected := []Mutation{{Kind: MutationNetns, Target: "kt-abcde"}}
+	if !reflect.DeepEqual(journals[0].Mutations, expected) {
+		t.Errorf("partially written line should be skipped, expect %v got %v", expected, journals[0].Mutations)
+	}
+}
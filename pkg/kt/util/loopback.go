@@ -0,0 +1,121 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// first loopback ip allocated to services, 127.0.0.0/16 and 127.1.0.0/16 are left to local services
+	firstLoopbackIP = 127<<24 | 2<<16 | 1
+	// each session takes a /16 block of loopback ips, i.e. 127.2.0.0/16, 127.3.0.0/16 ... 127.254.0.0/16
+	maxLoopbackBlocks = 253
+	// usable ips of a block, x.x.0.0 and x.x.255.255 excluded
+	loopbackBlockSize = 1<<16 - 2
+)
+
+// blockOwnerRunning check whether owner process of loopback block still running
+var blockOwnerRunning = func(pid int) bool {
+	return pid == os.Getpid() || IsProcessExist(pid)
+}
+
+// LoopbackIP get the index-th loopback ip in block allocated to a session,
+// i.e. 127.2.0.1, 127.2.0.2 ... of block 0, and 127.3.0.1, 127.3.0.2 ... of block 1
+func LoopbackIP(block, index int) (string, error) {
+	if block < 0 || block >= maxLoopbackBlocks {
+		return "", fmt.Errorf("loopback block %d out of range", block)
+	}
+	if index < 0 || index >= loopbackBlockSize {
+		return "", fmt.Errorf("loopback ip of index %d out of range", index)
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, uint32(firstLoopbackIP+block<<16+index))
+	return ip.String(), nil
+}
+
+// AllocateLoopbackBlock take a block of loopback ips not owned by other running session,
+// the block is owned by current process until released or process exited
+func AllocateLoopbackBlock() (int, error) {
+	lockPath := filepath.Join(KtHome, "loopback.lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	_ = f.Close()
+	unlock, err := LockFile(lockPath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	for block := 0; block < maxLoopbackBlocks; block++ {
+		if pid := loopbackBlockOwner(block); pid == 0 || !blockOwnerRunning(pid) {
+			return block, ioutil.WriteFile(loopbackBlockFile(block), []byte(strconv.Itoa(os.Getpid())), 0644)
+		}
+	}
+	return 0, fmt.Errorf("all %d loopback blocks are owned by running sessions", maxLoopbackBlocks)
+}
+
+// ReleaseLoopbackBlock give up block of loopback ips owned by current process
+func ReleaseLoopbackBlock(block int) error {
+	if loopbackBlockOwner(block) != os.Getpid() {
+		return nil
+	}
+	return os.Remove(loopbackBlockFile(block))
+}
+
+// loopbackBlockFile file records pid of process owns the block
+func loopbackBlockFile(block int) string {
+	return filepath.Join(KtHome, fmt.Sprintf("loopback-%d.pid", block))
+}
+
+// loopbackBlockOwner pid of process owns the block, 0 if not owned
+func loopbackBlockOwner(block int) int {
+	content, err := ioutil.ReadFile(loopbackBlockFile(block))
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+	return pid
+}
+
+// ownedByOtherSession whether block of loopback ip is owned by other running session
+func ownedByOtherSession(ip string) bool {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return false
+	}
+	pid := loopbackBlockOwner(int(parsed[1]) - 2)
+	return pid != 0 && pid != os.Getpid() && blockOwnerRunning(pid)
+}
+
+// AddLoopbackAlias make loopback ip listenable, only 127.0.0.1 is assigned to loopback interface on mac
+func AddLoopbackAlias(ip string) error {
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+	RecordMutation(MutationLoopback, ip, "")
+	if out, err := exec.Command("ifconfig", "lo0", "alias", ip, "up").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add loopback alias %s: %s, %s", ip, err, out)
+	}
+	return nil
+}
+
+// RemoveLoopbackAlias remove loopback ip added by AddLoopbackAlias,
+// alias left by exited session is kept if its block has been taken by other running session
+func RemoveLoopbackAlias(ip string) error {
+	if runtime.GOOS != "darwin" || ownedByOtherSession(ip) {
+		return nil
+	}
+	if out, err := exec.Command("ifconfig", "lo0", "-alias", ip).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove loopback alias %s: %s, %s", ip, err, out)
+	}
+	return nil
+}
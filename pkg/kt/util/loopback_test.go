@@ -0,0 +1,67 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestLoopbackIP(t *testing.T) {
+	tests := []struct {
+		block   int
+		index   int
+		want    string
+		wantErr bool
+	}{
+		{index: 0, want: "127.2.0.1"},
+		{index: 254, want: "127.2.0.255"},
+		{index: 255, want: "127.2.1.0"},
+		{index: 0xfffd, want: "127.2.255.254"},
+		{index: 0xfffe, wantErr: true},
+		{index: -1, wantErr: true},
+		{block: 1, index: 0, want: "127.3.0.1"},
+		{block: 252, index: 0xfffd, want: "127.254.255.254"},
+		{block: 253, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := LoopbackIP(tt.block, tt.index)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LoopbackIP(%d, %d) error = %v, wantErr %v", tt.block, tt.index, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("LoopbackIP(%d, %d) = %v, want %v", tt.block, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestAllocateLoopbackBlock(t *testing.T) {
+	defer useTempKtHome(t)()
+	origin := blockOwnerRunning
+	defer func() { blockOwnerRunning = origin }()
+	blockOwnerRunning = func(pid int) bool { return pid == os.Getpid() || pid == os.Getppid() }
+	// block 0 owned by running process, block 1 left by exited process
+	if err := ioutil.WriteFile(loopbackBlockFile(0), []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(loopbackBlockFile(1), []byte("99999999"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	block, err := AllocateLoopbackBlock()
+	if err != nil || block != 1 {
+		t.Fatalf("AllocateLoopbackBlock() = %d, %v, want 1", block, err)
+	}
+	if next, err := AllocateLoopbackBlock(); err != nil || next != 2 {
+		t.Errorf("block owned by current process should not be allocated again, got %d, %v", next, err)
+	}
+	if !ownedByOtherSession("127.2.0.1") || ownedByOtherSession("127.3.0.1") {
+		t.Errorf("only block 0 is owned by other session")
+	}
+	if err = ReleaseLoopbackBlock(0); err != nil || loopbackBlockOwner(0) != os.Getppid() {
+		t.Errorf("block of other session should not be released")
+	}
+	if err = ReleaseLoopbackBlock(1); err != nil || loopbackBlockOwner(1) != 0 {
+		t.Errorf("block of current process should be released, error %v", err)
+	}
+}
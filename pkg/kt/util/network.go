@@ -2,7 +2,9 @@ package util
 
 import (
 	"fmt"
+	"math/big"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +13,13 @@ import (
 
 // GetRandomSSHPort get pod random ssh port
 func GetRandomSSHPort(podIP string) string {
+	if IsIPv6(podIP) {
+		// use last hex group of ipv6 address, e.g. fd00::1:2c -> 2c -> 44
+		parts := strings.Split(podIP, ":")
+		num, _ := strconv.ParseUint(parts[len(parts)-1], 16, 16)
+		return fmt.Sprintf("22%02d", num%100)
+	}
+
 	parts := strings.Split(podIP, ".")
 	rdm := parts[len(parts)-1]
 
@@ -30,8 +39,12 @@ func GetOutboundIP() (address string) {
 	address = "127.0.0.1"
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
-		log.Error().Err(err).Send()
-		return
+		// try ipv6 route for ipv6-only machine
+		conn, err = net.Dial("udp", "[2001:4860:4860::8888]:80")
+		if err != nil {
+			log.Error().Err(err).Send()
+			return
+		}
 	}
 	defer conn.Close()
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
@@ -39,6 +52,67 @@ func GetOutboundIP() (address string) {
 	return
 }
 
+// IsIPv6 check whether the ip is an ipv6 address
+func IsIPv6(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() == nil
+}
+
+// IsIPv6Cidr check whether the cidr is an ipv6 cidr
+func IsIPv6Cidr(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
+
+// AnyAddress get the unspecified address of same ip family as specified ip
+func AnyAddress(ip string) string {
+	if IsIPv6(ip) {
+		return "::"
+	}
+	return "0.0.0.0"
+}
+
+// IPToLabelValue convert ip address to a valid kubernetes label value,
+// ipv6 address is fully expanded with ':' replaced by '-'
+func IPToLabelValue(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	groups := make([]string, 8)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("%02x%02x", parsed[i*2], parsed[i*2+1])
+	}
+	return strings.Join(groups, "-")
+}
+
+// ShiftCidr get the n-th cidr with same mask length after specified cidr, e.g. (10.1.1.0/30, 1) -> 10.1.1.4/30
+func ShiftCidr(cidr string, n int) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := ipNet.Mask.Size()
+	base := new(big.Int).SetBytes(ipNet.IP)
+	base.Add(base, new(big.Int).Lsh(big.NewInt(int64(n)), uint(bits-ones)))
+	ip := make(net.IP, len(ipNet.IP))
+	raw := base.Bytes()
+	if len(raw) > len(ip) {
+		return "", fmt.Errorf("cidr %s overflows after shifting %d times", cidr, n)
+	}
+	copy(ip[len(ip)-len(raw):], raw)
+	return (&net.IPNet{IP: ip, Mask: ipNet.Mask}).String(), nil
+}
+
+// TunIndex get number of tun device, e.g. tun1 -> 1
+func TunIndex(tunName string) int {
+	index, err := strconv.Atoi(strings.TrimPrefix(tunName, "tun"))
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
 // ExtractNetMaskFromCidr extract net mask length (e.g. 16) from cidr (e.g. 1.2.3.4/16)
 func ExtractNetMaskFromCidr(cidr string) string {
 	return cidr[strings.Index(cidr, "/")+1:]
@@ -34,6 +34,13 @@ func TestGetRandomSSHPort(t *testing.T) {
 			},
 			want: "2291",
 		},
+		{
+			name: "GetRandomSSHPortPodIPv6",
+			args: args{
+				podIP: "fd00:10:244::2c",
+			},
+			want: "2244",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -62,3 +69,49 @@ func TestGetOutboundIP(t *testing.T) {
 		})
 	}
 }
+
+func TestIPToLabelValue(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{
+			name: "shouldKeepIPv4Address",
+			ip:   "192.168.1.2",
+			want: "192.168.1.2",
+		},
+		{
+			name: "shouldExpandIPv6Address",
+			ip:   "fd00::1",
+			want: "fd00-0000-0000-0000-0000-0000-0000-0001",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IPToLabelValue(tt.ip); got != tt.want {
+				t.Errorf("IPToLabelValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftCidr(t *testing.T) {
+	tests := []struct {
+		cidr string
+		n    int
+		want string
+	}{
+		{cidr: "10.1.1.0/30", n: 0, want: "10.1.1.0/30"},
+		{cidr: "10.1.1.0/30", n: 1, want: "10.1.1.4/30"},
+		{cidr: "10.1.1.252/30", n: 1, want: "10.1.2.0/30"},
+		{cidr: "fd00:6b74::/126", n: 2, want: "fd00:6b74::8/126"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			if got, err := ShiftCidr(tt.cidr, tt.n); err != nil || got != tt.want {
+				t.Errorf("ShiftCidr() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
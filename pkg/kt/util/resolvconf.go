@@ -9,6 +9,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -21,70 +22,127 @@ const (
 	fieldSearch      = "search"
 )
 
+// AddNameserver add nameserver for current session and comment out the others,
+// lines changed are tagged with sessions, so that they are only restored after all sessions ended
 func AddNameserver(nameserver string) error {
-	f, err := os.Open(resolvConf)
+	RecordMutation(MutationNameserver, nameserver, "")
+	return updateResolvConf(func(content []byte) []byte {
+		return updateNameservers(content, nameserver, os.Getpid())
+	})
+}
+
+// RestoreConfig remove the nameserver which is added by ktctl, unless still needed by other running session.
+func RestoreConfig() error {
+	return updateResolvConf(func(content []byte) []byte {
+		return updateNameservers(content, "", os.Getpid())
+	})
+}
+
+func updateResolvConf(update func([]byte) []byte) error {
+	unlock, err := LockFile(resolvConf)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer unlock()
 
-	var buf bytes.Buffer
+	stat, err := os.Stat(resolvConf)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(resolvConf)
+	if err != nil {
+		return err
+	}
+	updated := update(content)
+	if bytes.Equal(content, updated) {
+		return nil
+	}
+	return ioutil.WriteFile(resolvConf, updated, stat.Mode())
+}
 
-	prefix := fmt.Sprintf("%s %s", fieldNameserver, nameserver)
-	scanner := bufio.NewScanner(f)
+// updateNameservers add nameserver for the session, or release nameservers of the session if nameserver is empty,
+// lines of sessions no longer running are released as well
+func updateNameservers(content []byte, nameserver string, session int) []byte {
+	adding := nameserver != ""
+	include := 0
+	if adding {
+		include = session
+	}
+	found := false
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, fieldNameserver) {
-			buf.WriteString("#")
-			buf.WriteString(line)
-			buf.WriteString(commentKtRemoved)
-			buf.WriteString("\n")
-		} else if strings.HasPrefix(line, prefix) {
-			return nil
+		base := trimSessionTag(line)
+		if strings.HasSuffix(base, commentKtAdded) {
+			fields := strings.Fields(base)
+			included := 0
+			if adding && len(fields) > 1 && fields[1] == nameserver {
+				included = session
+				found = true
+			}
+			if sessions := updateSessions(parseSessions(line), included, session); len(sessions) > 0 {
+				buf.WriteString(fmt.Sprintf("%s %s\n", base, formatSessions(sessions)))
+			} else {
+				log.Info().Msgf("remove line: %s ", line)
+			}
+		} else if strings.HasSuffix(base, commentKtRemoved) {
+			if sessions := updateSessions(parseSessions(line), include, session); len(sessions) > 0 {
+				buf.WriteString(fmt.Sprintf("%s %s\n", base, formatSessions(sessions)))
+			} else {
+				buf.WriteString(strings.TrimPrefix(strings.TrimSuffix(base, commentKtRemoved), "#"))
+				buf.WriteString("\n")
+			}
+		} else if adding && strings.HasPrefix(line, fieldNameserver) {
+			buf.WriteString(fmt.Sprintf("#%s%s %s\n", line, commentKtRemoved, formatSessions([]int{session})))
 		} else {
 			buf.WriteString(line)
 			buf.WriteString("\n")
 		}
 	}
-
-	// Add nameserver and comment to resolv.conf
-	buf.WriteString(fmt.Sprintf("%s%s", prefix, commentKtAdded))
-	buf.WriteString("\n")
-
-	stat, _ := f.Stat()
-	err = ioutil.WriteFile(resolvConf, buf.Bytes(), stat.Mode())
-	return err
+	if adding && !found {
+		buf.WriteString(fmt.Sprintf("%s %s%s %s\n", fieldNameserver, nameserver, commentKtAdded,
+			formatSessions([]int{session})))
+	}
+	return buf.Bytes()
 }
 
-// RestoreConfig remove the nameserver which is added by ktctl.
-func RestoreConfig() error {
-	f, err := os.Open(resolvConf)
+// SetupNetnsResolvConf write resolv.conf of network namespace, which is bind-mounted to /etc/resolv.conf by 'ip netns exec',
+// nameservers of host are replaced with the specified one, while search domains and options are kept
+func SetupNetnsResolvConf(netns, nameserver string) error {
+	content, err := ioutil.ReadFile(resolvConf)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	dir := netnsConfigDir(netns)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), replaceNameservers(content, nameserver), 0644)
+}
 
-	var buf bytes.Buffer
+// RemoveNetnsConfig remove config files of network namespace
+func RemoveNetnsConfig(netns string) error {
+	return os.RemoveAll(netnsConfigDir(netns))
+}
 
-	scanner := bufio.NewScanner(f)
+func netnsConfigDir(netns string) string {
+	return filepath.Join("/etc/netns", netns)
+}
+
+// replaceNameservers drop all nameservers in resolv.conf content and append the specified one
+func replaceNameservers(content []byte, nameserver string) []byte {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasSuffix(line, commentKtRemoved) {
-			line = strings.TrimSuffix(line, commentKtRemoved)
-			line = strings.TrimPrefix(line, "#")
-			buf.WriteString(line)
-			buf.WriteString("\n")
-		} else if strings.HasSuffix(line, commentKtAdded) {
-			log.Info().Msgf("remove line: %s ", line)
-		} else {
+		if !strings.HasPrefix(line, fieldNameserver) {
 			buf.WriteString(line)
 			buf.WriteString("\n")
 		}
 	}
-
-	stat, _ := f.Stat()
-	err = ioutil.WriteFile(resolvConf, buf.Bytes(), stat.Mode())
-	return err
+	buf.WriteString(fmt.Sprintf("%s %s%s\n", fieldNameserver, nameserver, commentKtAdded))
+	return buf.Bytes()
 }
 
 func GetLocalDomains() string {
@@ -0,0 +1,46 @@
+// +build !windows
+
+package util
+
+import "testing"
+
+func Test_replaceNameservers(t *testing.T) {
+	content := "# generated\nnameserver 127.0.0.53\nsearch corp.example.com\nnameserver 8.8.8.8\noptions edns0\n"
+	want := "# generated\nsearch corp.example.com\noptions edns0\nnameserver 172.16.0.9 # added by ktctl\n"
+	if got := string(replaceNameservers([]byte(content), "172.16.0.9")); got != want {
+		t.Errorf("replaceNameservers() = %q, want %q", got, want)
+	}
+}
+
+func Test_updateNameservers(t *testing.T) {
+	originAlive := isSessionAlive
+	defer func() { isSessionAlive = originAlive }()
+	isSessionAlive = func(pid int) bool { return true }
+
+	origin := "search corp.example.com\nnameserver 8.8.8.8\n"
+	first := string(updateNameservers([]byte(origin), "172.16.0.9", 100))
+	want := "search corp.example.com\n#nameserver 8.8.8.8 # removed by ktctl kt-session:100\n" +
+		"nameserver 172.16.0.9 # added by ktctl kt-session:100\n"
+	if first != want {
+		t.Errorf("first session: got %q, want %q", first, want)
+	}
+
+	second := string(updateNameservers([]byte(first), "172.16.0.9", 200))
+	want = "search corp.example.com\n#nameserver 8.8.8.8 # removed by ktctl kt-session:100,200\n" +
+		"nameserver 172.16.0.9 # added by ktctl kt-session:100,200\n"
+	if second != want {
+		t.Errorf("second session: got %q, want %q", second, want)
+	}
+
+	released := string(updateNameservers([]byte(second), "", 100))
+	want = "search corp.example.com\n#nameserver 8.8.8.8 # removed by ktctl kt-session:200\n" +
+		"nameserver 172.16.0.9 # added by ktctl kt-session:200\n"
+	if released != want {
+		t.Errorf("release first session: got %q, want %q", released, want)
+	}
+
+	isSessionAlive = func(pid int) bool { return pid != 200 }
+	if restored := string(updateNameservers([]byte(released), "", 100)); restored != origin {
+		t.Errorf("lines of dead session should be restored: got %q, want %q", restored, origin)
+	}
+}
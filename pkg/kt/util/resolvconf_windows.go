@@ -8,6 +8,14 @@ func RestoreConfig() error {
 	return nil
 }
 
+func SetupNetnsResolvConf(netns, nameserver string) error {
+	return nil
+}
+
+func RemoveNetnsConfig(netns string) error {
+	return nil
+}
+
 func GetLocalDomains() string {
 	return ""
 }
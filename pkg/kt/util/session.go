@@ -0,0 +1,66 @@
+package util
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sessionTag mark of ktctl sessions (pid) which need a line added to shared system file, e.g. 'kt-session:123,456'
+const sessionTag = "kt-session:"
+
+// isSessionAlive check whether ktctl session is still running, replaceable in test
+var isSessionAlive = IsProcessExist
+
+// parseSessions read sessions from the tag at end of line, empty if tag not found
+func parseSessions(line string) []int {
+	pos := strings.LastIndex(line, sessionTag)
+	if pos < 0 {
+		return nil
+	}
+	var sessions []int
+	for _, s := range strings.Split(line[pos+len(sessionTag):], ",") {
+		if pid, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			sessions = append(sessions, pid)
+		}
+	}
+	return sessions
+}
+
+// trimSessionTag line without the sessions tag
+func trimSessionTag(line string) string {
+	if pos := strings.LastIndex(line, sessionTag); pos >= 0 {
+		return strings.TrimRight(line[:pos], " ")
+	}
+	return line
+}
+
+// formatSessions tag of sessions, e.g. 'kt-session:123,456'
+func formatSessions(sessions []int) string {
+	values := make([]string, len(sessions))
+	for i, pid := range sessions {
+		values[i] = strconv.Itoa(pid)
+	}
+	return sessionTag + strings.Join(values, ",")
+}
+
+// updateSessions remove sessions no longer running and the excluded one, then add the included one if positive,
+// the result is sorted without duplication
+func updateSessions(sessions []int, include, exclude int) []int {
+	var updated []int
+	for _, pid := range sessions {
+		if pid != exclude && pid != include && isSessionAlive(pid) {
+			updated = append(updated, pid)
+		}
+	}
+	if include > 0 {
+		updated = append(updated, include)
+	}
+	sort.Ints(updated)
+	for i := len(updated) - 1; i > 0; i-- {
+		if updated[i] == updated[i-1] {
+			updated = append(updated[:i], updated[i+1:]...)
+		}
+	}
+	return updated
+}
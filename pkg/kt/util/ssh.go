@@ -1,15 +1,19 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/alibaba/kt-connect/pkg/common"
 	"github.com/rs/zerolog/log"
@@ -18,6 +22,7 @@ import (
 
 // SSHCredential ssh info
 type SSHCredential struct {
+	RemoteUser     string
 	RemoteHost     string
 	Port           string
 	PrivateKeyPath string
@@ -42,23 +47,52 @@ func NewSSHGenerator(privateKey string, publicKey string, privateKeyPath string)
 func NewDefaultSSHCredential() *SSHCredential {
 	return &SSHCredential{
 		Port:       "2222",
+		RemoteUser: common.ShadowUser,
 		RemoteHost: "127.0.0.1",
 	}
 }
 
-// Generate generate SSHGenerator
+// Generate generate SSHGenerator with rsa key pair
 func Generate(privateKeyPath string) (*SSHGenerator, error) {
-	privateKey, err := generatePrivateKey(common.SSHBitSize)
+	return GenerateKey(privateKeyPath, common.KeyTypeRsa)
+}
+
+// GenerateKey generate SSHGenerator with key pair of specified type
+func GenerateKey(privateKeyPath, keyType string) (*SSHGenerator, error) {
+	privateKeyBytes, publicKeyBytes, err := generateKeyPair(keyType)
 	if err != nil {
 		return nil, err
 	}
+	ssh := &SSHGenerator{
+		PrivateKey:     privateKeyBytes,
+		PrivateKeyPath: privateKeyPath,
+		PublicKey:      publicKeyBytes,
+	}
+	err = WritePrivateKey(ssh.PrivateKeyPath, ssh.PrivateKey)
+	return ssh, err
+}
 
-	publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
+// CachedKey reuse key pair cached in kt home across sessions, a new key pair is generated
+// when there is no cached key or cached key is older than rotation period
+func CachedKey(privateKeyPath, keyType string, rotation time.Duration) (*SSHGenerator, error) {
+	cachedKeyPath := CachedKeyPath(keyType)
+	privateKeyBytes, publicKeyBytes, err := loadCachedKey(cachedKeyPath, rotation)
 	if err != nil {
-		return nil, err
+		log.Debug().Msgf("Cached key unavailable: %s", err)
+		if privateKeyBytes, publicKeyBytes, err = generateKeyPair(keyType); err != nil {
+			return nil, err
+		}
+		_ = os.Remove(cachedKeyPath)
+		if err = WritePrivateKey(cachedKeyPath, privateKeyBytes); err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(cachedKeyPath+".pub", publicKeyBytes, 0644); err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("Generated new cached %s key", keyType)
+	} else {
+		log.Debug().Msgf("Reuse cached key %s", cachedKeyPath)
 	}
-	privateKeyBytes := encodePrivateKeyToPEM(privateKey)
-
 	ssh := &SSHGenerator{
 		PrivateKey:     privateKeyBytes,
 		PrivateKeyPath: privateKeyPath,
@@ -68,18 +102,23 @@ func Generate(privateKeyPath string) (*SSHGenerator, error) {
 	return ssh, err
 }
 
+// CachedKeyPath path of cached private key, public key is saved with '.pub' suffix
+func CachedKeyPath(keyType string) string {
+	return fmt.Sprintf("%s/%s/%s", KtHome, common.CachedKeyDir, keyFileName("cached", keyType))
+}
+
 // PrivateKeyPath ...
-func PrivateKeyPath(component, identifier string) string {
-	return fmt.Sprintf("%s/%s/"+common.SSHPrivateKeyName, KtHome, component, identifier)
+func PrivateKeyPath(component, identifier, keyType string) string {
+	return fmt.Sprintf("%s/%s/%s", KtHome, component, keyFileName(identifier, keyType))
 }
 
-// CleanRsaKeys ...
+// CleanRsaKeys remove private keys of all sessions as well as cached keys
 func CleanRsaKeys() {
 	for _, c := range common.AllKtComponents {
 		dir := fmt.Sprintf("%s/%s/", KtHome, c)
 		files, _ := ioutil.ReadDir(dir)
 		for _, f := range files {
-			if strings.HasSuffix(f.Name(), common.PostfixRsaKey) {
+			if isPrivateKeyFile(f.Name()) {
 				rsaKey := fmt.Sprintf("%s/%s", dir, f.Name())
 				err := os.Remove(rsaKey)
 				if err != nil {
@@ -88,6 +127,84 @@ func CleanRsaKeys() {
 			}
 		}
 	}
+	CleanCachedKeys(0)
+}
+
+// CleanCachedKeys remove cached keys older than rotation period, all cached keys are removed if rotation is 0
+func CleanCachedKeys(rotation time.Duration) {
+	for _, keyType := range []string{common.KeyTypeRsa, common.KeyTypeEd25519} {
+		cachedKeyPath := CachedKeyPath(keyType)
+		info, err := os.Stat(cachedKeyPath)
+		if err != nil || (rotation > 0 && time.Since(info.ModTime()) < rotation) {
+			continue
+		}
+		if err = os.Remove(cachedKeyPath); err != nil {
+			log.Debug().Msgf("Failed to remove cached key file: %s", cachedKeyPath)
+		}
+		_ = os.Remove(cachedKeyPath + ".pub")
+	}
+}
+
+func isPrivateKeyFile(name string) bool {
+	return strings.HasSuffix(name, common.PostfixRsaKey) || strings.HasSuffix(name, common.PostfixEd25519Key)
+}
+
+// keyFileName e.g. 'kt_abcd_id_rsa' or 'kt_abcd_id_ed25519'
+func keyFileName(identifier, keyType string) string {
+	if keyType == common.KeyTypeEd25519 {
+		return fmt.Sprintf(common.SSHEd25519PrivateKeyName, identifier)
+	}
+	return fmt.Sprintf(common.SSHPrivateKeyName, identifier)
+}
+
+func loadCachedKey(cachedKeyPath string, rotation time.Duration) ([]byte, []byte, error) {
+	info, err := os.Stat(cachedKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rotation > 0 && time.Since(info.ModTime()) > rotation {
+		return nil, nil, fmt.Errorf("cached key created at %s expired", info.ModTime().Format(common.YyyyMmDdHhMmSs))
+	}
+	privateKeyBytes, err := ioutil.ReadFile(cachedKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKeyBytes, err := ioutil.ReadFile(cachedKeyPath + ".pub")
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = ssh.ParsePrivateKey(privateKeyBytes); err != nil {
+		return nil, nil, err
+	}
+	return privateKeyBytes, publicKeyBytes, nil
+}
+
+// generateKeyPair generate private key in PEM format and public key in authorized keys format
+func generateKeyPair(keyType string) ([]byte, []byte, error) {
+	switch keyType {
+	case common.KeyTypeEd25519:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKeyBytes, err := generatePublicKey(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return encodeEd25519PrivateKeyToPEM(privateKey), publicKeyBytes, nil
+	case common.KeyTypeRsa, "":
+		privateKey, err := generatePrivateKey(common.SSHBitSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return encodePrivateKeyToPEM(privateKey), publicKeyBytes, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type '%s'", keyType)
+	}
 }
 
 // generatePrivateKey creates a RSA Private Key of specified byte size
@@ -126,9 +243,57 @@ func encodePrivateKeyToPEM(privateKey *rsa.PrivateKey) []byte {
 	return privatePEM
 }
 
-// generatePublicKey take a rsa.PublicKey and return bytes suitable for writing to .pub file
-// returns in the format "ssh-rsa ..."
-func generatePublicKey(privatekey *rsa.PublicKey) ([]byte, error) {
+// encodeEd25519PrivateKeyToPEM encodes ed25519 private key to openssh format, which is not supported by x509
+func encodeEd25519PrivateKeyToPEM(privateKey ed25519.PrivateKey) []byte {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	sshPublicKey, _ := ssh.NewPublicKey(publicKey)
+
+	check := make([]byte, 4)
+	_, _ = rand.Read(check)
+	keyBlock := struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+		Pad     []byte `ssh:"rest"`
+	}{
+		Check1:  binary.BigEndian.Uint32(check),
+		Check2:  binary.BigEndian.Uint32(check),
+		Keytype: ssh.KeyAlgoED25519,
+		Pub:     publicKey,
+		Priv:    privateKey,
+	}
+	// private key block is padded to multiple of cipher block size, which is 8 for 'none' cipher
+	for i := 1; len(ssh.Marshal(keyBlock))%8 != 0; i++ {
+		keyBlock.Pad = append(keyBlock.Pad, byte(i))
+	}
+
+	key := struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       sshPublicKey.Marshal(),
+		PrivKeyBlock: ssh.Marshal(keyBlock),
+	}
+	privBlock := pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte("openssh-key-v1\x00"), ssh.Marshal(key)...),
+	}
+	return pem.EncodeToMemory(&privBlock)
+}
+
+// generatePublicKey take a rsa or ed25519 public key and return bytes suitable for writing to .pub file
+// returns in the format "ssh-rsa ..." or "ssh-ed25519 ..."
+func generatePublicKey(privatekey crypto.PublicKey) ([]byte, error) {
 	publicRsaKey, err := ssh.NewPublicKey(privatekey)
 	if err != nil {
 		return nil, err
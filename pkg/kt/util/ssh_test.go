@@ -1,10 +1,17 @@
 package util
 
 import (
+	"bytes"
 	"crypto/rsa"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestGenerate(t *testing.T) {
@@ -49,6 +56,72 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
+func TestGenerateEd25519Key(t *testing.T) {
+	privateKeyPath := "/tmp/sshkeypair_ed25519"
+	os.Remove(privateKeyPath)
+	got, err := GenerateKey(privateKeyPath, common.KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(got.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to parse ed25519 private key: %v", err)
+	}
+	if signer.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("key type = %s, want %s", signer.PublicKey().Type(), ssh.KeyAlgoED25519)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(got.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	if !bytes.Equal(publicKey.Marshal(), signer.PublicKey().Marshal()) {
+		t.Errorf("public key not match private key")
+	}
+}
+
+func TestCachedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kt-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	originHome := KtHome
+	KtHome = dir
+	defer func() { KtHome = originHome }()
+
+	first, err := CachedKey(PrivateKeyPath("connect", "aaaa", common.KeyTypeEd25519), common.KeyTypeEd25519, time.Hour)
+	if err != nil {
+		t.Fatalf("CachedKey() error = %v", err)
+	}
+	second, err := CachedKey(PrivateKeyPath("connect", "bbbb", common.KeyTypeEd25519), common.KeyTypeEd25519, time.Hour)
+	if err != nil {
+		t.Fatalf("CachedKey() error = %v", err)
+	}
+	if !bytes.Equal(first.PrivateKey, second.PrivateKey) {
+		t.Errorf("cached key should be reused")
+	}
+	if filepath.Base(second.PrivateKeyPath) != "kt_bbbb_id_ed25519" {
+		t.Errorf("unexpected private key path %s", second.PrivateKeyPath)
+	}
+
+	expired := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(CachedKeyPath(common.KeyTypeEd25519), expired, expired)
+	third, err := CachedKey(PrivateKeyPath("connect", "cccc", common.KeyTypeEd25519), common.KeyTypeEd25519, time.Hour)
+	if err != nil {
+		t.Fatalf("CachedKey() error = %v", err)
+	}
+	if bytes.Equal(first.PrivateKey, third.PrivateKey) {
+		t.Errorf("expired cached key should be rotated")
+	}
+
+	CleanRsaKeys()
+	for _, f := range []string{first.PrivateKeyPath, third.PrivateKeyPath, CachedKeyPath(common.KeyTypeEd25519)} {
+		if _, err = os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("key file %s should be cleaned", f)
+		}
+	}
+}
+
 func Test_generatePrivateKey(t *testing.T) {
 	type args struct {
 		bitSize int
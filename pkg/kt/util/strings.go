@@ -33,3 +33,17 @@ func String2Map(str string) map[string]string {
 	}
 	return res
 }
+
+// ToLabelValue Convert any string to a valid label value, e.g. "DOMAIN\user" -> "DOMAIN-user"
+func ToLabelValue(str string) string {
+	value := []rune(str)
+	for i, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			value[i] = '-'
+		}
+	}
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(string(value), "-_.")
+}
@@ -33,3 +33,23 @@ func TestString2Map(t *testing.T) {
 		})
 	}
 }
+
+func TestToLabelValue(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{name: "should keep valid value", str: "alice.bob_01", want: "alice.bob_01"},
+		{name: "should replace invalid characters", str: "CORP\\alice", want: "CORP-alice"},
+		{name: "should trim non-alphanumeric ends", str: "@alice@", want: "alice"},
+		{name: "should return empty for empty string", str: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToLabelValue(tt.str); got != tt.want {
+				t.Errorf("ToLabelValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
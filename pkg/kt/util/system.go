@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -49,6 +50,17 @@ func IsProcessExist(pid int) bool {
 	return strings.Contains(proc.Executable(), "ktctl")
 }
 
+// GetLocalUserName name of current user, the original user is preferred when running via sudo
+func GetLocalUserName() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
 // KubeConfig location of kube-config file
 func KubeConfig() string {
 	kubeconfig := os.Getenv("KUBECONFIG")
@@ -71,6 +83,7 @@ func CreateDirIfNotExist(dir string) {
 // WritePidFile write pid to file
 func WritePidFile(componentName string) error {
 	pidFile := fmt.Sprintf("%s/%s-%d.pid", KtHome, componentName, os.Getpid())
+	RecordMutation(MutationPidFile, pidFile, "")
 	return ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
 }
 
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DirectionIn data received from the other side of forwarded port
+	DirectionIn = "in"
+	// DirectionOut data sent to the other side of forwarded port
+	DirectionOut = "out"
+	// path of metrics endpoint
+	metricsPath = "/metrics"
+)
+
+var (
+	// ForwardedBytes bytes transferred via each forwarded port
+	ForwardedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kt_forwarded_bytes_total",
+		Help: "Bytes transferred via forwarded port",
+	}, []string{"port", "direction"})
+	// ForwardedConnections connections accepted by each forwarded port
+	ForwardedConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kt_forwarded_connections_total",
+		Help: "Connections accepted by forwarded port",
+	}, []string{"port"})
+	// DNSQueries dns queries served, result is 'success' or 'empty'
+	DNSQueries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kt_dns_queries_total",
+		Help: "DNS queries served",
+	}, []string{"type", "result"})
+	// SocksConnections connections accepted by socks proxy
+	SocksConnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kt_socks_connections_total",
+		Help: "Connections accepted by socks proxy",
+	})
+	// Reconnects times connection to shadow re-established after broken
+	Reconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kt_reconnects_total",
+		Help: "Times connection to shadow re-established after broken",
+	}, []string{"component"})
+	// HeartbeatFailures failed heartbeats of session lease, resource annotation and port forward
+	HeartbeatFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kt_heartbeat_failures_total",
+		Help: "Failed heartbeats of session lease, resource annotation and port forward",
+	}, []string{"kind"})
+)
+
+// mux serves metrics endpoint and other handlers registered
+var mux = http.NewServeMux()
+
+func init() {
+	prometheus.MustRegister(ForwardedBytes, ForwardedConnections, DNSQueries, SocksConnections, Reconnects, HeartbeatFailures)
+	mux.Handle(metricsPath, promhttp.Handler())
+}
+
+// Handler http handler of metrics endpoint
+func Handler() http.Handler {
+	return mux
+}
+
+// Handle register extra handler served along with metrics endpoint, e.g. readiness probe of shadow
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// Serve expose metrics endpoint on address in background, e.g. ':9180'
+func Serve(address string) {
+	go func() {
+		log.Info().Msgf("Serving metrics at %s%s", address, metricsPath)
+		if err := http.ListenAndServe(address, Handler()); err != nil {
+			log.Error().Msgf("Failed to serve metrics: %s", err)
+		}
+	}()
+}
+
+// countingConn connection which records transferred bytes of a forwarded port
+type countingConn struct {
+	net.Conn
+	in  prometheus.Counter
+	out prometheus.Counter
+}
+
+// CountConn count bytes read from and written to conn as traffic of port
+func CountConn(conn net.Conn, port string) net.Conn {
+	ForwardedConnections.WithLabelValues(port).Inc()
+	return &countingConn{
+		Conn: conn,
+		in:   ForwardedBytes.WithLabelValues(port, DirectionIn),
+		out:  ForwardedBytes.WithLabelValues(port, DirectionOut),
+	}
+}
+
+// Read read from conn and count received bytes
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.in.Add(float64(n))
+	return n, err
+}
+
+// Write write to conn and count sent bytes
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out.Add(float64(n))
+	return n, err
+}
+
+// PortOf get port part of address, or the address itself if it has no port
+func PortOf(address string) string {
+	if _, port, err := net.SplitHostPort(address); err == nil {
+		return port
+	}
+	return address
+}
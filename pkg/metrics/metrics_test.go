@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountConn(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := CountConn(local, "8080")
+	defer conn.Close()
+
+	go func() {
+		_, _ = remote.Write([]byte("hello"))
+		_, _ = ioutil.ReadAll(remote)
+	}()
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	if _, err := conn.Write([]byte("hi")); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+
+	if got := testutil.ToFloat64(ForwardedConnections.WithLabelValues("8080")); got != 1 {
+		t.Errorf("connections = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(ForwardedBytes.WithLabelValues("8080", DirectionIn)); got != 5 {
+		t.Errorf("bytes in = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(ForwardedBytes.WithLabelValues("8080", DirectionOut)); got != 2 {
+		t.Errorf("bytes out = %v, want 2", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	DNSQueries.WithLabelValues("A", "success").Inc()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", metricsPath, nil))
+	if !strings.Contains(rec.Body.String(), `kt_dns_queries_total{result="success",type="A"}`) {
+		t.Errorf("dns query metric not exposed: %s", rec.Body.String())
+	}
+}
+
+func TestPortOf(t *testing.T) {
+	cases := map[string]string{
+		"127.0.0.1:8080": "8080",
+		":1080":          "1080",
+		"[::1]:22":       "22",
+		"8080":           "8080",
+	}
+	for address, want := range cases {
+		if got := PortOf(address); got != want {
+			t.Errorf("PortOf(%s) = %s, want %s", address, got, want)
+		}
+	}
+}
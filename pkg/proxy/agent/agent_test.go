@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alibaba/kt-connect/pkg/kt/util"
+)
+
+func startAgent(t *testing.T, dir string) (string, []byte) {
+	generator, err := util.Generate(filepath.Join(dir, "kt_id_rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizedKeys := filepath.Join(dir, "authorized_keys")
+	if err = ioutil.WriteFile(authorizedKeys, generator.PublicKey, 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{AuthorizedKeysFile: authorizedKeys}
+	go srv.Serve(listener)
+	return listener.Addr().String(), generator.PrivateKey
+}
+
+func startTCPEcho(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				buf := make([]byte, 1024)
+				n, _ := conn.Read(buf)
+				_, _ = conn.Write(buf[:n])
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return listener
+}
+
+func echo(t *testing.T, conn net.Conn, msg string) {
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf[:n]) != msg {
+		t.Errorf("got %s, want %s", string(buf[:n]), msg)
+	}
+}
+
+func TestAgent_Dial(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kt-agent")
+	defer os.RemoveAll(dir)
+	address, privateKey := startAgent(t, dir)
+	client, err := Connect(address, privateKey)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	tcpEcho := startTCPEcho(t)
+	defer tcpEcho.Close()
+	conn, err := client.Dial("tcp", tcpEcho.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() tcp error = %v", err)
+	}
+	echo(t, conn, "hello tcp")
+	_ = conn.Close()
+
+	udpEcho, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpEcho.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := udpEcho.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udpEcho.WriteTo(buf[:n], addr)
+		}
+	}()
+	conn, err = client.Dial("udp", udpEcho.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() udp error = %v", err)
+	}
+	echo(t, conn, "hello udp")
+	echo(t, conn, "hello again")
+	_ = conn.Close()
+}
+
+func TestAgent_Forward(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kt-agent")
+	defer os.RemoveAll(dir)
+	address, privateKey := startAgent(t, dir)
+	client, err := Connect(address, privateKey)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	local := startTCPEcho(t)
+	defer local.Close()
+	remote, _ := net.Listen("tcp", "127.0.0.1:0")
+	remoteEndpoint := remote.Addr().String()
+	_ = remote.Close()
+
+	go client.Forward(remoteEndpoint, local.Addr().String())
+	var conn net.Conn
+	for i := 0; i < 30; i++ {
+		if conn, err = net.Dial("tcp", remoteEndpoint); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("remote endpoint not ready: %v", err)
+	}
+	echo(t, conn, "hello forward")
+	_ = conn.Close()
+}
+
+func TestAgent_RejectUnknownKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kt-agent")
+	defer os.RemoveAll(dir)
+	address, _ := startAgent(t, dir)
+	other, err := util.Generate(filepath.Join(dir, "other_id_rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Connect(address, other.PrivateKey); err == nil {
+		t.Errorf("Connect() should fail with unauthorized key")
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serverHandshake challenge client to sign a random nonce with private key of session,
+// signature is verified with public keys in authorized keys file
+func serverHandshake(conn net.Conn, authorizedKeysFile string) error {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, nonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if _, err := conn.Write(nonce); err != nil {
+		return err
+	}
+	data, err := readFrame(conn)
+	if err != nil {
+		return err
+	}
+	signature := &ssh.Signature{}
+	if err = ssh.Unmarshal(data, signature); err != nil {
+		_ = writeResponse(conn, errors.New("invalid signature"))
+		return err
+	}
+	if err = verify(authorizedKeysFile, nonce, signature); err != nil {
+		_ = writeResponse(conn, errors.New("authentication failed"))
+		return err
+	}
+	return writeResponse(conn, nil)
+}
+
+// clientHandshake sign nonce sent by server with private key
+func clientHandshake(conn net.Conn, signer ssh.Signer) error {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, nonceLength)
+	if _, err := io.ReadFull(conn, nonce); err != nil {
+		return err
+	}
+	signature, err := signer.Sign(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+	if err = writeFrame(conn, ssh.Marshal(signature)); err != nil {
+		return err
+	}
+	return readResponse(conn)
+}
+
+func verify(authorizedKeysFile string, nonce []byte, signature *ssh.Signature) error {
+	content, err := ioutil.ReadFile(authorizedKeysFile)
+	if err != nil {
+		return err
+	}
+	for len(bytes.TrimSpace(content)) > 0 {
+		var publicKey ssh.PublicKey
+		publicKey, _, _, content, err = ssh.ParseAuthorizedKey(content)
+		if err != nil {
+			return err
+		}
+		if publicKey.Verify(nonce, signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("no authorized key matches the signature")
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/alibaba/kt-connect/pkg/metrics"
+	"github.com/hashicorp/yamux"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// Client agent client, all streams are multiplexed over one connection
+type Client struct {
+	session *yamux.Session
+	lock    sync.RWMutex
+	// remote listen address -> local endpoint
+	forwards map[string]string
+}
+
+// Connect connect to agent and authenticate with private key of session
+func Connect(address string, privateKey []byte) (*Client, error) {
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", address, handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err = clientHandshake(conn, signer); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	session, err := yamux.Client(conn, yamux.DefaultConfig())
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c := &Client{session: session, forwards: map[string]string{}}
+	go c.serve()
+	return c, nil
+}
+
+// Dial open connection from shadow to address, connection of udp network keeps datagram boundaries
+func (c *Client) Dial(network, address string) (net.Conn, error) {
+	stream, err := c.session.Open()
+	if err != nil {
+		return nil, err
+	}
+	if err = writeJSON(stream, Request{Type: TypeDial, Network: network, Address: address}); err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+	if err = readResponse(stream); err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &datagramConn{stream}, nil
+	}
+	return stream, nil
+}
+
+// Forward listen on remote endpoint of shadow and forward connections to local endpoint,
+// block until the listener closed
+func (c *Client) Forward(remoteEndpoint, localEndpoint string) error {
+	stream, err := c.session.Open()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	c.lock.Lock()
+	c.forwards[remoteEndpoint] = localEndpoint
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.forwards, remoteEndpoint)
+		c.lock.Unlock()
+	}()
+
+	if err = writeJSON(stream, Request{Type: TypeListen, Address: remoteEndpoint}); err != nil {
+		return err
+	}
+	if err = readResponse(stream); err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, stream)
+	return err
+}
+
+// Close close connection and all streams
+func (c *Client) Close() error {
+	return c.session.Close()
+}
+
+func (c *Client) serve() {
+	for {
+		stream, err := c.session.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleAccept(stream)
+	}
+}
+
+func (c *Client) handleAccept(stream net.Conn) {
+	req := Request{}
+	if err := readJSON(stream, &req); err != nil || req.Type != TypeAccept {
+		_ = stream.Close()
+		return
+	}
+	c.lock.RLock()
+	localEndpoint, exists := c.forwards[req.Address]
+	c.lock.RUnlock()
+	if !exists {
+		_ = stream.Close()
+		return
+	}
+	local, err := net.Dial("tcp", localEndpoint)
+	if err != nil {
+		log.Error().Msgf("Dial into local service error: %s", err)
+		_ = stream.Close()
+		return
+	}
+	pipe(metrics.CountConn(stream, metrics.PortOf(localEndpoint)), local)
+}
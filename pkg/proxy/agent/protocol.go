@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// TypeDial open a tcp or udp connection from shadow
+	TypeDial = "dial"
+	// TypeListen listen on a port of shadow, accepted connections are sent back to client
+	TypeListen = "listen"
+	// TypeAccept connection accepted by a listener of shadow
+	TypeAccept = "accept"
+
+	// length of random challenge sent to client
+	nonceLength = 32
+	// max size of a frame, large enough for any udp datagram
+	maxFrameSize = 65535 + 1024
+	// timeout of authentication before multiplexing
+	handshakeTimeout = 10 * time.Second
+)
+
+// Request first frame of every stream
+type Request struct {
+	Type    string `json:"type"`
+	Network string `json:"network,omitempty"`
+	Address string `json:"address"`
+}
+
+// Response reply of dial and listen request
+type Response struct {
+	Error string `json:"error,omitempty"`
+}
+
+// writeFrame write length prefixed data
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame size %d exceeds limit", len(data))
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame read length prefixed data
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame size %d exceeds limit", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, data)
+}
+
+func readJSON(r io.Reader, v interface{}) error {
+	data, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeResponse(w io.Writer, err error) error {
+	res := Response{}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return writeJSON(w, res)
+}
+
+func readResponse(r io.Reader) error {
+	res := Response{}
+	if err := readJSON(r, &res); err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	return nil
+}
+
+// datagramConn carry udp datagrams over a stream, every frame is a datagram
+type datagramConn struct {
+	net.Conn
+}
+
+// Read read one datagram, b must be large enough to hold it
+func (c *datagramConn) Read(b []byte) (int, error) {
+	data, err := readFrame(c.Conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > len(b) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(b, data), nil
+}
+
+// Write write one datagram
+func (c *datagramConn) Write(b []byte) (int, error) {
+	if err := writeFrame(c.Conn, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// pipe copy data in both direction until either side closed
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+	<-done
+}
+
+// pipeDatagram relay datagrams between stream and udp connection
+func pipeDatagram(stream, conn net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		for {
+			data, err := readFrame(stream)
+			if err != nil {
+				break
+			}
+			if _, err = conn.Write(data); err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if err = writeFrame(stream, buf[:n]); err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	_ = stream.Close()
+	_ = conn.Close()
+	<-done
+}
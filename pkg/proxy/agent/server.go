@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/metrics"
+	"github.com/hashicorp/yamux"
+	"github.com/rs/zerolog/log"
+)
+
+// Server agent which serves multiplexed streams from ktctl
+type Server struct {
+	// AuthorizedKeysFile public keys allowed to connect
+	AuthorizedKeysFile string
+}
+
+// Start setup agent server on shadow
+func Start() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Error().Msgf("Failed to get home dir: %s", err)
+		return
+	}
+	srv := &Server{AuthorizedKeysFile: filepath.Join(home, common.SSHAuthKey, "authorized_keys")}
+	if err = srv.ListenAndServe(fmt.Sprintf(":%d", common.AgentPort)); err != nil {
+		log.Error().Msgf("Failed to start agent: %s", err)
+	}
+}
+
+// ListenAndServe listen on tcp address and serve agent connections
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Agent listening on %s", address)
+	return s.Serve(listener)
+}
+
+// Serve accept connections on listener, each connection carries multiplexed streams
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	if err := serverHandshake(conn, s.AuthorizedKeysFile); err != nil {
+		log.Warn().Msgf("Reject connection from %s: %s", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	session, err := yamux.Server(conn, yamux.DefaultConfig())
+	if err != nil {
+		log.Error().Msgf("Failed to create session: %s", err)
+		_ = conn.Close()
+		return
+	}
+	defer session.Close()
+	log.Info().Msgf("Accept connection from %s", conn.RemoteAddr())
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			log.Info().Msgf("Connection from %s closed", conn.RemoteAddr())
+			return
+		}
+		go s.handleStream(session, stream)
+	}
+}
+
+func (s *Server) handleStream(session *yamux.Session, stream net.Conn) {
+	req := Request{}
+	if err := readJSON(stream, &req); err != nil {
+		log.Warn().Msgf("Invalid request: %s", err)
+		_ = stream.Close()
+		return
+	}
+	switch req.Type {
+	case TypeDial:
+		dial(stream, req)
+	case TypeListen:
+		listen(session, stream, req)
+	default:
+		_ = writeResponse(stream, fmt.Errorf("unknown request type '%s'", req.Type))
+		_ = stream.Close()
+	}
+}
+
+// dial connect to target address and relay data of stream
+func dial(stream net.Conn, req Request) {
+	log.Debug().Msgf("Dial %s %s", req.Network, req.Address)
+	conn, err := net.DialTimeout(req.Network, req.Address, handshakeTimeout)
+	if err2 := writeResponse(stream, err); err != nil || err2 != nil {
+		_ = stream.Close()
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return
+	}
+	if strings.HasPrefix(req.Network, "udp") {
+		pipeDatagram(stream, conn)
+	} else {
+		pipe(stream, conn)
+	}
+}
+
+// listen on address until control stream closed, send every accepted connection back as a new stream
+func listen(session *yamux.Session, control net.Conn, req Request) {
+	listener, err := net.Listen("tcp", req.Address)
+	if err2 := writeResponse(control, err); err != nil || err2 != nil {
+		_ = control.Close()
+		if listener != nil {
+			_ = listener.Close()
+		}
+		return
+	}
+	log.Info().Msgf("Forward connections of %s to client", req.Address)
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, control)
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		go func(conn net.Conn) {
+			stream, err := session.Open()
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+			if err = writeJSON(stream, Request{Type: TypeAccept, Address: req.Address}); err != nil {
+				_ = conn.Close()
+				_ = stream.Close()
+				return
+			}
+			pipe(stream, metrics.CountConn(conn, metrics.PortOf(req.Address)))
+		}(conn)
+	}
+	log.Info().Msgf("Stop listening on %s", req.Address)
+	_ = control.Close()
+}
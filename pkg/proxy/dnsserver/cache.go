@@ -0,0 +1,100 @@
+package dnsserver
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// max number of cached records, all expired records are evicted when reached
+	maxCacheSize = 4096
+	// how long a non-exist domain is remembered
+	negativeCacheTTL = 5 * time.Second
+)
+
+// cached answer of a query
+type cacheItem struct {
+	answers  []dns.RR
+	notExist bool
+	expireAt time.Time
+}
+
+// dnsCache in-memory cache of upstream answers, expired by min ttl of answers
+type dnsCache struct {
+	lock  sync.Mutex
+	items map[string]cacheItem
+	now   func() time.Time
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{items: map[string]cacheItem{}, now: time.Now}
+}
+
+func cacheKey(domain string, qtype uint16) string {
+	return domain + "/" + strconv.Itoa(int(qtype))
+}
+
+// get return copy of cached answers with remaining ttl
+func (c *dnsCache) get(domain string, qtype uint16) (answers []dns.RR, notExist bool, found bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := cacheKey(domain, qtype)
+	item, exists := c.items[key]
+	if !exists {
+		return nil, false, false
+	}
+	now := c.now()
+	if !now.Before(item.expireAt) {
+		delete(c.items, key)
+		return nil, false, false
+	}
+	ttl := uint32(item.expireAt.Sub(now) / time.Second)
+	for _, rr := range item.answers {
+		copied := dns.Copy(rr)
+		copied.Header().Ttl = ttl
+		answers = append(answers, copied)
+	}
+	return answers, item.notExist, true
+}
+
+// put cache answers until the smallest ttl elapsed, answers without ttl are not cached
+func (c *dnsCache) put(domain string, qtype uint16, answers []dns.RR) {
+	if len(answers) == 0 {
+		return
+	}
+	ttl := answers[0].Header().Ttl
+	for _, rr := range answers[1:] {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	if ttl == 0 {
+		return
+	}
+	c.store(domain, qtype, cacheItem{answers: answers, expireAt: c.now().Add(time.Duration(ttl) * time.Second)})
+}
+
+// putNotExist remember domain not exist for a short while
+func (c *dnsCache) putNotExist(domain string, qtype uint16) {
+	c.store(domain, qtype, cacheItem{notExist: true, expireAt: c.now().Add(negativeCacheTTL)})
+}
+
+func (c *dnsCache) store(domain string, qtype uint16, item cacheItem) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.items) >= maxCacheSize {
+		now := c.now()
+		for key, cached := range c.items {
+			if !now.Before(cached.expireAt) {
+				delete(c.items, key)
+			}
+		}
+		if len(c.items) >= maxCacheSize {
+			c.items = map[string]cacheItem{}
+		}
+	}
+	c.items[cacheKey(domain, qtype)] = item
+}
@@ -0,0 +1,48 @@
+package dnsserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSCache(t *testing.T) {
+	now := time.Now()
+	c := newDNSCache()
+	c.now = func() time.Time { return now }
+
+	a, _ := dns.NewRR("tomcat.default.svc.cluster.local. 30 IN A 10.0.0.1")
+	b, _ := dns.NewRR("tomcat.default.svc.cluster.local. 10 IN A 10.0.0.2")
+	c.put("tomcat.default.svc.cluster.local.", dns.TypeA, []dns.RR{a, b})
+	c.putNotExist("none.default.svc.cluster.local.", dns.TypeA)
+
+	now = now.Add(4 * time.Second)
+	answers, notExist, found := c.get("tomcat.default.svc.cluster.local.", dns.TypeA)
+	if !found || notExist || len(answers) != 2 || answers[0].Header().Ttl != 6 {
+		t.Errorf("unexpected cached answers: %v", answers)
+	}
+	if a.Header().Ttl != 30 {
+		t.Errorf("cached record should not be modified")
+	}
+	if _, _, found = c.get("tomcat.default.svc.cluster.local.", dns.TypeAAAA); found {
+		t.Errorf("query type should be part of cache key")
+	}
+	if _, notExist, found = c.get("none.default.svc.cluster.local.", dns.TypeA); !found || !notExist {
+		t.Errorf("non-exist domain should be cached")
+	}
+
+	now = now.Add(6 * time.Second)
+	if _, _, found = c.get("tomcat.default.svc.cluster.local.", dns.TypeA); found {
+		t.Errorf("answers should expire with min ttl")
+	}
+	if _, _, found = c.get("none.default.svc.cluster.local.", dns.TypeA); found {
+		t.Errorf("non-exist domain should expire")
+	}
+
+	zero, _ := dns.NewRR("zero.example.com. 0 IN A 10.0.0.3")
+	c.put("zero.example.com.", dns.TypeA, []dns.RR{zero})
+	if _, _, found = c.get("zero.example.com.", dns.TypeA); found {
+		t.Errorf("answers with zero ttl should not be cached")
+	}
+}
@@ -2,12 +2,15 @@ package dnsserver
 
 import (
 	"errors"
-	"github.com/alibaba/kt-connect/pkg/common"
+	"fmt"
 	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/metrics"
 	"github.com/miekg/dns"
 	"github.com/rs/zerolog/log"
 )
@@ -15,38 +18,135 @@ import (
 // dns server
 type server struct {
 	config *dns.ClientConfig
+	// upstreams address of upstream dns servers, tried in order until one of them replied
+	upstreams []string
+	// forwards upstream address of specified domain suffix
+	forwards map[string]string
+	// overrides static answers of specified names
+	overrides Overrides
+	// resolver answer cluster names from informer caches, nil unless kubernetes resolver enabled
+	resolver *clusterResolver
+	cache    *dnsCache
 }
 
 // constants
-const resolvFile = "/etc/resolv.conf"
+const (
+	resolvFile = "/etc/resolv.conf"
+	// default port of upstream dns server
+	defaultUpstreamPort = "53"
+	// edns0 buffer size advertised to clients and upstreams
+	ednsBufferSize = 4096
+	// max time to wait for an upstream before trying the next one
+	upstreamTimeout = 2 * time.Second
+	// max cname targets followed for one query, to avoid loop of ExternalName services
+	maxCNAMEChain = 8
+)
 
-// Start setup dns server
+// Start setup dns server on both udp and tcp
 func Start() {
-	srv := NewDNSServerDefault()
-	err := srv.ListenAndServe()
-	if err != nil {
-		log.Error().Msg(err.Error())
-		panic(err.Error())
+	errCh := make(chan error, 2)
+	for _, srv := range NewDNSServerDefault() {
+		go func(srv *dns.Server) {
+			errCh <- srv.ListenAndServe()
+		}(srv)
 	}
+	err := <-errCh
+	log.Error().Msg(err.Error())
+	panic(err.Error())
 }
 
-// NewDNSServerDefault create default dns server
-func NewDNSServerDefault() (srv *dns.Server) {
-	srv = &dns.Server{Addr: ":" + strconv.Itoa(53), Net: "udp"}
-	config, _ := dns.ClientConfigFromFile(resolvFile)
-
-	srv.Handler = &server{config}
+// NewDNSServerDefault create default udp and tcp dns servers sharing the same cache
+func NewDNSServerDefault() []*dns.Server {
+	port := os.Getenv(common.EnvVarDnsPort)
+	if port == "" {
+		port = strconv.Itoa(common.DnsPort)
+	}
+	config, err := dns.ClientConfigFromFile(resolvFile)
+	if err != nil {
+		log.Warn().Msgf("Failed to load %s: %s", resolvFile, err)
+		config = &dns.ClientConfig{Port: defaultUpstreamPort}
+	}
+	handler := newServer(config, os.Getenv(common.EnvVarDnsUpstreams), os.Getenv(common.EnvVarDnsForwards),
+		os.Getenv(common.EnvVarDnsOverrides))
 
 	log.Info().Msgf("Successful load local " + resolvFile)
-	for _, server := range config.Servers {
-		log.Info().Msgf("Success load nameserver %s", server)
+	for _, upstream := range handler.upstreams {
+		log.Info().Msgf("Success load nameserver %s", upstream)
+	}
+	for domain, upstream := range handler.forwards {
+		log.Info().Msgf("Forward %s to nameserver %s", domain, upstream)
+	}
+	for name, ip := range handler.overrides {
+		log.Info().Msgf("Override %s with %s", name, ip)
 	}
 	for _, domain := range config.Search {
 		log.Info().Msgf("Success load search %s", domain)
 	}
+	if os.Getenv(common.EnvVarDnsResolver) == common.DnsResolverKubernetes {
+		domain := os.Getenv(common.EnvVarClusterDomain)
+		if domain == "" {
+			domain = common.DefaultClusterDomain
+		}
+		resolver, err := newInClusterResolver(strings.Trim(domain, "."), handler.getSuffixes())
+		if err != nil {
+			log.Warn().Msgf("Failed to start kubernetes resolver, fall back to upstream: %s", err)
+		} else {
+			handler.resolver = resolver
+		}
+	}
+	return []*dns.Server{
+		{Addr: ":" + port, Net: "udp", Handler: handler},
+		{Addr: ":" + port, Net: "tcp", Handler: handler},
+	}
+}
+
+// newServer create dns handler, upstreams default to nameservers in resolv.conf
+func newServer(config *dns.ClientConfig, upstreams, forwards, overrides string) *server {
+	s := &server{config: config, upstreams: parseUpstreams(upstreams), forwards: parseForwards(forwards),
+		overrides: ParseOverrides(overrides), cache: newDNSCache()}
+	if len(s.upstreams) == 0 {
+		for _, ns := range config.Servers {
+			s.upstreams = append(s.upstreams, net.JoinHostPort(ns, config.Port))
+		}
+	}
+	return s
+}
+
+// parseUpstreams parse '10.96.0.10,10.96.0.11:5353' to upstream addresses
+func parseUpstreams(str string) (upstreams []string) {
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			upstreams = append(upstreams, upstreamAddress(item))
+		}
+	}
 	return
 }
 
+// parseForwards parse 'corp.example.com=10.0.0.2,local=10.0.0.3:5353' to domain suffix and upstream address
+func parseForwards(str string) map[string]string {
+	forwards := map[string]string{}
+	for _, item := range strings.Split(str, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		domain := strings.Trim(strings.TrimSpace(parts[0]), ".")
+		upstream := strings.TrimSpace(parts[1])
+		if domain != "" && upstream != "" {
+			forwards[domain+"."] = upstreamAddress(upstream)
+		}
+	}
+	return forwards
+}
+
+// upstreamAddress append default port to upstream without port
+func upstreamAddress(upstream string) string {
+	if _, _, err := net.SplitHostPort(upstream); err == nil {
+		return upstream
+	}
+	return net.JoinHostPort(strings.Trim(upstream, "[]"), defaultUpstreamPort)
+}
+
 // ServeDNS query DNS record
 func (s *server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 	msg := dns.Msg{}
@@ -57,10 +157,40 @@ func (s *server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
 		log.Info().Msgf("Answer: %v", a)
 		msg.Answer = append(msg.Answer, a)
 	}
+	recordQuery(req, msg.Answer)
+	fitMessageSize(w, req, &msg)
 
 	_ = w.WriteMsg(&msg)
 }
 
+// fitMessageSize reply edns0 to client supports it, and truncate udp message exceeds buffer size of client,
+// so that client would retry via tcp
+func fitMessageSize(w dns.ResponseWriter, req *dns.Msg, msg *dns.Msg) {
+	size := dns.MinMsgSize
+	if opt := req.IsEdns0(); opt != nil {
+		if int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		msg.SetEdns0(ednsBufferSize, opt.Do())
+	}
+	if _, isTCP := w.RemoteAddr().(*net.TCPAddr); isTCP {
+		size = dns.MaxMsgSize
+	}
+	msg.Truncate(size)
+}
+
+// recordQuery count served query by type and whether any record is answered
+func recordQuery(req *dns.Msg, answers []dns.RR) {
+	if len(req.Question) == 0 {
+		return
+	}
+	result := "success"
+	if len(answers) == 0 {
+		result = "empty"
+	}
+	metrics.DNSQueries.WithLabelValues(dns.TypeToString[req.Question[0].Qtype], result).Inc()
+}
+
 // Simulate kubernetes-like dns look up logic
 func (s *server) query(req *dns.Msg) (rr []dns.RR) {
 	if len(req.Question) <= 0 {
@@ -85,8 +215,19 @@ func (s *server) query(req *dns.Msg) (rr []dns.RR) {
 	}
 	log.Info().Msgf("Looking up %s", name)
 
-	rr = make([]dns.RR, 0)
 	domainsToLookup := s.fetchAllPossibleDomains(name)
+	if ip, matched := s.overrides.Match(append([]string{name}, domainsToLookup...)...); matched {
+		log.Info().Msgf("Domain %s is overridden with %s", name, ip)
+		return addressAnswer(req.Question[0].Name, qtype, ip, overrideTTL)
+	}
+	if s.resolver != nil {
+		if answers, inCluster := s.resolver.resolve(req.Question[0].Name, name, qtype); inCluster {
+			return s.followCNAME(answers, qtype)
+		}
+		// only non-cluster name is forwarded to upstream
+		domainsToLookup = []string{name}
+	}
+	rr = make([]dns.RR, 0)
 	for _, domain := range domainsToLookup {
 		r, err := s.exchange(domain, qtype, name)
 		if err == nil {
@@ -97,6 +238,30 @@ func (s *server) query(req *dns.Msg) (rr []dns.RR) {
 	return
 }
 
+// followCNAME append address records of cname target to answers of address query, e.g. for ExternalName services,
+// target is resolved from informer caches if it's a cluster name, otherwise from upstreams
+func (s *server) followCNAME(answers []dns.RR, qtype uint16) []dns.RR {
+	if qtype != dns.TypeA && qtype != dns.TypeAAAA {
+		return answers
+	}
+	for i := 0; i < maxCNAMEChain && len(answers) > 0; i++ {
+		cname, ok := answers[len(answers)-1].(*dns.CNAME)
+		if !ok {
+			break
+		}
+		rr, inCluster := s.resolver.resolve(cname.Target, cname.Target, qtype)
+		if !inCluster {
+			var err error
+			if rr, err = s.lookup(cname.Target, qtype); err != nil {
+				log.Warn().Msgf("Failed to resolve cname target %s: %s", cname.Target, err)
+				break
+			}
+		}
+		answers = append(answers, rr...)
+	}
+	return answers
+}
+
 // get all domains need to lookup
 func (s *server) fetchAllPossibleDomains(name string) []string {
 	count := strings.Count(name, ".")
@@ -160,53 +325,27 @@ func (s *server) getSuffixes() (suffixes []string) {
 	return
 }
 
-// Get upstream dns server address
-func (s *server) getResolveServer() (address string, err error) {
-	if len(s.config.Servers) <= 0 {
-		err = errors.New("error: no dns server available")
-		return
+// Get upstream dns server addresses of domain, forwarded domain uses its specified upstream only
+func (s *server) getResolveServers(domain string) []string {
+	matched := ""
+	for suffix := range s.forwards {
+		if (domain == suffix || strings.HasSuffix(domain, "."+suffix)) && len(suffix) > len(matched) {
+			matched = suffix
+		}
 	}
-
-	server := s.config.Servers[0]
-	port := s.config.Port
-
-	address = net.JoinHostPort(server, port)
-	return
+	if matched != "" {
+		return []string{s.forwards[matched]}
+	}
+	return s.upstreams
 }
 
 // Look for domain record from upstream dns server
 func (s *server) exchange(domain string, qtype uint16, name string) (rr []dns.RR, err error) {
-	address, err := s.getResolveServer()
+	answers, err := s.lookup(domain, qtype)
 	if err != nil {
-		log.Error().Msgf("Error: fail to fetch upstream dns: %s", err.Error())
 		return
 	}
-	log.Info().Msgf("Resolving domain %s via upstream %s", domain, address)
-
-	c := new(dns.Client)
-	msg := new(dns.Msg)
-	msg.RecursionDesired = true
-	msg.SetQuestion(domain, qtype)
-	res, _, err := c.Exchange(msg, address)
-
-	if res == nil {
-		if err != nil {
-			log.Error().Msgf("Error: fail to resolve: %s", err.Error())
-		} else {
-			log.Error().Msgf("Error: fail to resolve")
-		}
-		return
-	}
-
-	if res.Rcode == dns.RcodeNameError {
-		err = DomainNotExistError{domain}
-		return
-	} else if res.Rcode != dns.RcodeSuccess {
-		log.Error().Msgf("Error: failed to answer name %s after %d query for %s", name, qtype, domain)
-		return
-	}
-
-	for _, item := range res.Answer {
+	for _, item := range answers {
 		log.Info().Msgf("Response: %s", item.String())
 		r, errInLoop := s.convertAnswer(name, domain, item)
 		if errInLoop != nil {
@@ -215,10 +354,62 @@ func (s *server) exchange(domain string, qtype uint16, name string) (rr []dns.RR
 		}
 		rr = append(rr, r)
 	}
-
 	return
 }
 
+// lookup answers from cache, or from upstreams in order until one of them replied
+func (s *server) lookup(domain string, qtype uint16) ([]dns.RR, error) {
+	if answers, notExist, found := s.cache.get(domain, qtype); found {
+		log.Debug().Msgf("Resolving domain %s from cache", domain)
+		if notExist {
+			return nil, DomainNotExistError{domain}
+		}
+		return answers, nil
+	}
+	upstreams := s.getResolveServers(domain)
+	if len(upstreams) == 0 {
+		log.Error().Msgf("Error: fail to fetch upstream dns: no dns server available")
+		return nil, errors.New("error: no dns server available")
+	}
+	var lastErr error
+	for _, address := range upstreams {
+		log.Info().Msgf("Resolving domain %s via upstream %s", domain, address)
+		res, err := exchangeUpstream(address, domain, qtype)
+		if err != nil {
+			log.Warn().Msgf("Failed to resolve %s via upstream %s: %s", domain, address, err)
+			lastErr = err
+			continue
+		}
+		if res.Rcode == dns.RcodeNameError {
+			s.cache.putNotExist(domain, qtype)
+			return nil, DomainNotExistError{domain}
+		} else if res.Rcode != dns.RcodeSuccess {
+			log.Warn().Msgf("Failed to resolve %s via upstream %s: %s", domain, address, dns.RcodeToString[res.Rcode])
+			lastErr = fmt.Errorf("upstream %s answered %s", address, dns.RcodeToString[res.Rcode])
+			continue
+		}
+		s.cache.put(domain, qtype, res.Answer)
+		return res.Answer, nil
+	}
+	log.Error().Msgf("Error: fail to resolve %s: %s", domain, lastErr)
+	return nil, lastErr
+}
+
+// exchangeUpstream query upstream with edns0, retry via tcp when the answer is truncated
+func exchangeUpstream(address, domain string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.RecursionDesired = true
+	msg.SetQuestion(domain, qtype)
+	msg.SetEdns0(ednsBufferSize, false)
+	c := &dns.Client{Net: "udp", UDPSize: ednsBufferSize, Timeout: upstreamTimeout}
+	res, _, err := c.Exchange(msg, address)
+	if err == nil && res.Truncated {
+		c = &dns.Client{Net: "tcp", Timeout: upstreamTimeout}
+		res, _, err = c.Exchange(msg, address)
+	}
+	return res, err
+}
+
 // Replace fully qualified domain name with short domain name in dns answer
 func (s *server) convertAnswer(name, inClusterName string, actual dns.RR) (rr dns.RR, err error) {
 	if name != inClusterName {
@@ -1,6 +1,10 @@
 package dnsserver
 
 import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -18,3 +22,137 @@ func TestAnswerRewrite(t *testing.T) {
 		t.Errorf("error, get result: " + r.String())
 	}
 }
+
+func TestAAAAAnswerRewrite(t *testing.T) {
+	s := &server{}
+	actual, _ := dns.NewRR("tomcat.default.svc.cluster.local. 5 IN AAAA fd00:10:96::a")
+	r, err := s.convertAnswer("tomcat.", "tomcat.default.svc.cluster.local.", actual)
+	if err != nil {
+		t.Errorf("error")
+		return
+	}
+	if r.String() != "tomcat.	5	IN	AAAA	fd00:10:96::a" {
+		t.Errorf("error, get result: " + r.String())
+	}
+}
+
+func TestParseUpstreamsAndForwards(t *testing.T) {
+	upstreams := parseUpstreams("10.96.0.10, 10.96.0.11:5353,fd00::10,")
+	want := []string{"10.96.0.10:53", "10.96.0.11:5353", "[fd00::10]:53"}
+	if !reflect.DeepEqual(upstreams, want) {
+		t.Errorf("parseUpstreams() = %v, want %v", upstreams, want)
+	}
+	forwards := parseForwards("corp.example.com=10.0.0.2,.internal.=10.0.0.3:5353,invalid")
+	wantForwards := map[string]string{"corp.example.com.": "10.0.0.2:53", "internal.": "10.0.0.3:5353"}
+	if !reflect.DeepEqual(forwards, wantForwards) {
+		t.Errorf("parseForwards() = %v, want %v", forwards, wantForwards)
+	}
+}
+
+func TestGetResolveServers(t *testing.T) {
+	s := newServer(&dns.ClientConfig{Servers: []string{"10.96.0.10"}, Port: "53"}, "",
+		"example.com=10.0.0.2,api.example.com=10.0.0.3", "")
+	tests := map[string][]string{
+		"tomcat.default.svc.cluster.local.": {"10.96.0.10:53"},
+		"example.com.":                      {"10.0.0.2:53"},
+		"www.example.com.":                  {"10.0.0.2:53"},
+		"v1.api.example.com.":               {"10.0.0.3:53"},
+		"notexample.com.":                   {"10.96.0.10:53"},
+	}
+	for domain, want := range tests {
+		if got := s.getResolveServers(domain); !reflect.DeepEqual(got, want) {
+			t.Errorf("getResolveServers(%s) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+// startUpstream start an udp dns server answering every A query, return its address and counter of queries
+func startUpstream(t *testing.T) (string, *int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	var count int32
+	srv := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&count, 1)
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 30 IN A 10.0.0.1")
+		msg.Answer = append(msg.Answer, rr)
+		_ = w.WriteMsg(msg)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return conn.LocalAddr().String(), &count
+}
+
+func TestLookupFallbackAndCache(t *testing.T) {
+	// nothing listens on the first upstream
+	unused, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	deadUpstream := unused.LocalAddr().String()
+	_ = unused.Close()
+	upstream, count := startUpstream(t)
+
+	s := newServer(&dns.ClientConfig{}, deadUpstream+","+upstream, "", "")
+	for i := 0; i < 2; i++ {
+		rr, err := s.lookup("tomcat.default.svc.cluster.local.", dns.TypeA)
+		if err != nil {
+			t.Fatalf("lookup failed: %s", err)
+		}
+		if len(rr) != 1 || rr[0].(*dns.A).A.String() != "10.0.0.1" {
+			t.Errorf("unexpected answer: %v", rr)
+		}
+	}
+	if atomic.LoadInt32(count) != 1 {
+		t.Errorf("upstream queried %d times, want 1", atomic.LoadInt32(count))
+	}
+}
+
+type fakeResponseWriter struct {
+	dns.ResponseWriter
+	remote net.Addr
+}
+
+func (w *fakeResponseWriter) RemoteAddr() net.Addr {
+	return w.remote
+}
+
+func TestFitMessageSize(t *testing.T) {
+	reply := func(req *dns.Msg) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		for i := 0; i < 60; i++ {
+			rr, _ := dns.NewRR(fmt.Sprintf("big.example.com. 30 IN A 10.0.0.%d", i))
+			msg.Answer = append(msg.Answer, rr)
+		}
+		return msg
+	}
+	udp := &fakeResponseWriter{remote: &net.UDPAddr{}}
+	tcp := &fakeResponseWriter{remote: &net.TCPAddr{}}
+
+	req := new(dns.Msg)
+	req.SetQuestion("big.example.com.", dns.TypeA)
+	msg := reply(req)
+	fitMessageSize(udp, req, msg)
+	if !msg.Truncated || msg.Len() > dns.MinMsgSize {
+		t.Errorf("udp reply without edns0 should be truncated, length %d", msg.Len())
+	}
+
+	req.SetEdns0(4096, false)
+	msg = reply(req)
+	fitMessageSize(udp, req, msg)
+	if msg.Truncated || len(msg.Answer) != 60 || msg.IsEdns0() == nil {
+		t.Errorf("udp reply with edns0 should not be truncated")
+	}
+
+	req = new(dns.Msg)
+	req.SetQuestion("big.example.com.", dns.TypeA)
+	msg = reply(req)
+	fitMessageSize(tcp, req, msg)
+	if msg.Truncated || len(msg.Answer) != 60 {
+		t.Errorf("tcp reply should not be truncated")
+	}
+}
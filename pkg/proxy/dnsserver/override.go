@@ -0,0 +1,83 @@
+package dnsserver
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ttl of overridden answers, kept short so that changed rules take effect soon
+	overrideTTL = 5
+	// prefix of wildcard override rule
+	wildcardPrefix = "*."
+)
+
+// Overrides static answers of names, e.g. 'tomcat.' -> '127.0.0.1', '*.example.com.' -> '10.0.0.2'
+type Overrides map[string]string
+
+// ParseOverrides parse 'tomcat=127.0.0.1,*.example.com=10.0.0.2' to override rules, invalid rules are ignored
+func ParseOverrides(str string) Overrides {
+	overrides := Overrides{}
+	for _, item := range strings.Split(str, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(parts[0]), ".")
+		ip := strings.TrimSpace(parts[1])
+		if name == "" || net.ParseIP(ip) == nil {
+			continue
+		}
+		overrides[name+"."] = ip
+	}
+	return overrides
+}
+
+// Match get overridden ip of the first name matches any rule, exact rule takes precedence over wildcard rule
+func (o Overrides) Match(names ...string) (string, bool) {
+	for _, name := range names {
+		if ip, exists := o[name]; exists {
+			return ip, true
+		}
+	}
+	for _, name := range names {
+		for rule, ip := range o {
+			if strings.HasPrefix(rule, wildcardPrefix) && strings.HasSuffix(name, rule[1:]) {
+				return ip, true
+			}
+		}
+	}
+	return "", false
+}
+
+// addressAnswer build A or AAAA answer of ip for queried name,
+// it's empty when query type mismatches the ip family, so that query won't fall through to upstream
+func addressAnswer(name string, qtype uint16, ip string, ttl uint32) []dns.RR {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return []dns.RR{}
+	}
+	header := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: ttl}
+	if addr.To4() != nil && qtype == dns.TypeA {
+		header.Rrtype = dns.TypeA
+		return []dns.RR{&dns.A{Hdr: header, A: addr.To4()}}
+	}
+	if addr.To4() == nil && qtype == dns.TypeAAAA {
+		header.Rrtype = dns.TypeAAAA
+		return []dns.RR{&dns.AAAA{Hdr: header, AAAA: addr}}
+	}
+	return []dns.RR{}
+}
+
+// Hosts get names and ips of exact rules, in hosts file format
+func (o Overrides) Hosts() map[string]string {
+	hosts := map[string]string{}
+	for name, ip := range o {
+		if !strings.HasPrefix(name, wildcardPrefix) {
+			hosts[strings.TrimSuffix(name, ".")] = ip
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,55 @@
+package dnsserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseOverrides(t *testing.T) {
+	overrides := ParseOverrides("tomcat=127.0.0.1, *.example.com.=10.0.0.2,ipv6=fd00::1,invalid=abc,noip")
+	want := Overrides{"tomcat.": "127.0.0.1", "*.example.com.": "10.0.0.2", "ipv6.": "fd00::1"}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("ParseOverrides() = %v, want %v", overrides, want)
+	}
+	if hosts := overrides.Hosts(); !reflect.DeepEqual(hosts, map[string]string{"tomcat": "127.0.0.1", "ipv6": "fd00::1"}) {
+		t.Errorf("Hosts() = %v", hosts)
+	}
+}
+
+func TestOverridesMatch(t *testing.T) {
+	overrides := ParseOverrides("tomcat.default.svc.cluster.local=127.0.0.1,*.example.com=10.0.0.2,api.example.com=10.0.0.3")
+	tests := []struct {
+		names   []string
+		ip      string
+		matched bool
+	}{
+		{[]string{"tomcat.", "tomcat.default.svc.cluster.local."}, "127.0.0.1", true},
+		{[]string{"www.example.com."}, "10.0.0.2", true},
+		{[]string{"api.example.com."}, "10.0.0.3", true},
+		{[]string{"example.com."}, "", false},
+		{[]string{"nginx.", "nginx.default.svc.cluster.local."}, "", false},
+	}
+	for _, tt := range tests {
+		ip, matched := overrides.Match(tt.names...)
+		if ip != tt.ip || matched != tt.matched {
+			t.Errorf("Match(%v) = %s %v, want %s %v", tt.names, ip, matched, tt.ip, tt.matched)
+		}
+	}
+}
+
+func TestOverrideQuery(t *testing.T) {
+	s := newServer(&dns.ClientConfig{Search: []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"}},
+		"", "", "tomcat.default.svc.cluster.local=127.0.0.1")
+	req := new(dns.Msg)
+	req.SetQuestion("tomcat.", dns.TypeA)
+	rr := s.query(req)
+	if len(rr) != 1 || rr[0].String() != "tomcat.\t5\tIN\tA\t127.0.0.1" {
+		t.Errorf("unexpected answer: %v", rr)
+	}
+	req.SetQuestion("tomcat.", dns.TypeAAAA)
+	if rr = s.query(req); len(rr) != 0 {
+		t.Errorf("ipv6 query of ipv4 override should be empty: %v", rr)
+	}
+}
@@ -0,0 +1,282 @@
+package dnsserver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	coreV1Listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	k8sCache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ttl of answers from informer caches
+	clusterRecordTTL = 5
+	// time to wait for informer caches to be synced before warning, queries are forwarded to upstream meanwhile
+	resolverSyncTimeout = 30 * time.Second
+	// timeout of api requests not served by informer caches, e.g. pod lookup
+	resolverRequestTimeout = 3 * time.Second
+)
+
+// clusterResolver answer cluster names from informer caches of services and endpoints,
+// pods are looked up in their namespace on demand instead of caching all pods of cluster
+type clusterResolver struct {
+	// domain cluster domain, e.g. 'cluster.local'
+	domain string
+	// search suffixes of short names, ends with '.'
+	search    []string
+	clientset kubernetes.Interface
+	services  coreV1Listers.ServiceLister
+	endpoints coreV1Listers.EndpointsLister
+	// synced whether informer caches are synced, names are not resolved until then
+	synced []k8sCache.InformerSynced
+}
+
+// newInClusterResolver create resolver with service account of shadow pod
+func newInClusterResolver(domain string, search []string) (*clusterResolver, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = resolverRequestTimeout
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	resolver := newClusterResolver(clientset, domain, search, make(chan struct{}))
+	go resolver.waitForSynced()
+	return resolver, nil
+}
+
+// newClusterResolver start informers without waiting for their caches synced, informers keep running until stop closed
+func newClusterResolver(clientset kubernetes.Interface, domain string, search []string, stop <-chan struct{}) *clusterResolver {
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	serviceInformer := factory.Core().V1().Services()
+	endpointsInformer := factory.Core().V1().Endpoints()
+	// informers must be requested before factory started
+	synced := []k8sCache.InformerSynced{serviceInformer.Informer().HasSynced, endpointsInformer.Informer().HasSynced}
+	factory.Start(stop)
+	return &clusterResolver{
+		domain:    domain,
+		search:    search,
+		clientset: clientset,
+		services:  serviceInformer.Lister(),
+		endpoints: endpointsInformer.Lister(),
+		synced:    synced,
+	}
+}
+
+// waitForSynced log once informer caches synced, informers keep retrying if it takes longer than expected
+func (r *clusterResolver) waitForSynced() {
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(resolverSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	if !k8sCache.WaitForCacheSync(timeout, r.synced...) {
+		log.Warn().Msgf("Service and endpoints caches not synced in %s, keep forwarding *.%s to upstream until synced",
+			resolverSyncTimeout, r.domain)
+		k8sCache.WaitForCacheSync(make(chan struct{}), r.synced...)
+	}
+	log.Info().Msgf("Resolving *.%s from informer caches", r.domain)
+}
+
+// hasSynced whether all informer caches are synced
+func (r *clusterResolver) hasSynced() bool {
+	for _, synced := range r.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve answer name if it's a cluster name, qname is the queried name used in answers,
+// inCluster is false when name should be forwarded to upstream, e.g. informer caches not synced yet
+func (r *clusterResolver) resolve(qname, name string, qtype uint16) (rr []dns.RR, inCluster bool) {
+	if !r.hasSynced() {
+		return nil, false
+	}
+	for _, candidate := range r.candidates(name) {
+		if rr, found := r.lookup(qname, candidate, qtype); found {
+			return rr, true
+		}
+	}
+	// absolute cluster name never goes upstream
+	return []dns.RR{}, strings.HasSuffix(name, "."+r.domain+".")
+}
+
+// get full cluster names of queried name with search suffixes
+func (r *clusterResolver) candidates(name string) []string {
+	if strings.HasSuffix(name, "."+r.domain+".") {
+		return []string{name}
+	}
+	var names []string
+	for _, suffix := range r.search {
+		if suffix == r.domain+"." || strings.HasSuffix(suffix, "."+r.domain+".") {
+			names = append(names, name+suffix)
+		}
+	}
+	return names
+}
+
+// lookup records of full cluster name, found is false when no such object in cluster
+func (r *clusterResolver) lookup(qname, fqdn string, qtype uint16) (rr []dns.RR, found bool) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."+r.domain+"."), ".")
+	count := len(labels)
+	switch labels[count-1] {
+	case "svc":
+		switch {
+		case count == 3:
+			// <service>.<namespace>.svc
+			return r.serviceRecords(qname, labels[0], labels[1], qtype)
+		case count == 4:
+			// <hostname>.<service>.<namespace>.svc
+			return r.hostRecords(qname, labels[0], labels[1], labels[2], qtype)
+		case count == 5 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_"):
+			// _<port>._<protocol>.<service>.<namespace>.svc
+			return r.srvRecords(qname, labels[0][1:], labels[1][1:], labels[2], labels[3], qtype)
+		}
+	case "pod":
+		if count == 3 {
+			// <pod-ip>.<namespace>.pod
+			return r.podRecords(qname, labels[0], labels[1], qtype)
+		}
+	}
+	return nil, false
+}
+
+func (r *clusterResolver) serviceRecords(qname, name, namespace string, qtype uint16) ([]dns.RR, bool) {
+	svc, err := r.services.Services(namespace).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	switch {
+	case svc.Spec.Type == v1.ServiceTypeExternalName:
+		header := dns.RR_Header{Name: qname, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: clusterRecordTTL}
+		return []dns.RR{&dns.CNAME{Hdr: header, Target: dns.Fqdn(svc.Spec.ExternalName)}}, true
+	case svc.Spec.ClusterIP == v1.ClusterIPNone:
+		rr := []dns.RR{}
+		for _, address := range r.addresses(svc) {
+			rr = append(rr, addressAnswer(qname, qtype, address.IP, clusterRecordTTL)...)
+		}
+		return rr, true
+	default:
+		return addressAnswer(qname, qtype, svc.Spec.ClusterIP, clusterRecordTTL), true
+	}
+}
+
+func (r *clusterResolver) hostRecords(qname, host, name, namespace string, qtype uint16) ([]dns.RR, bool) {
+	svc, err := r.services.Services(namespace).Get(name)
+	if err != nil || svc.Spec.ClusterIP != v1.ClusterIPNone {
+		return nil, false
+	}
+	for _, address := range r.addresses(svc) {
+		if addressHostname(address) == host {
+			return addressAnswer(qname, qtype, address.IP, clusterRecordTTL), true
+		}
+	}
+	return nil, false
+}
+
+func (r *clusterResolver) srvRecords(qname, port, protocol, name, namespace string, qtype uint16) ([]dns.RR, bool) {
+	svc, err := r.services.Services(namespace).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	var servicePort *v1.ServicePort
+	for i, p := range svc.Spec.Ports {
+		if p.Name == port && strings.EqualFold(string(p.Protocol), protocol) {
+			servicePort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if servicePort == nil {
+		return nil, false
+	}
+	rr := []dns.RR{}
+	if qtype != dns.TypeSRV {
+		return rr, true
+	}
+	serviceName := name + "." + namespace + ".svc." + r.domain + "."
+	if svc.Spec.ClusterIP != v1.ClusterIPNone {
+		return append(rr, srvAnswer(qname, uint16(servicePort.Port), serviceName)), true
+	}
+	endpoints, err := r.endpoints.Endpoints(namespace).Get(name)
+	if err != nil {
+		return rr, true
+	}
+	for _, subset := range endpoints.Subsets {
+		for _, p := range subset.Ports {
+			if p.Name != port || p.Protocol != servicePort.Protocol {
+				continue
+			}
+			for _, address := range readyAddresses(subset, svc) {
+				rr = append(rr, srvAnswer(qname, uint16(p.Port), addressHostname(address)+"."+serviceName))
+			}
+		}
+	}
+	return rr, true
+}
+
+func (r *clusterResolver) podRecords(qname, dashedIP, namespace string, qtype uint16) ([]dns.RR, bool) {
+	ip := net.ParseIP(strings.ReplaceAll(dashedIP, "-", "."))
+	if ip == nil {
+		ip = net.ParseIP(strings.ReplaceAll(dashedIP, "-", ":"))
+	}
+	if ip == nil {
+		return nil, false
+	}
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.podIP", ip.String()).String(),
+	})
+	if err != nil {
+		log.Debug().Msgf("Failed to lookup pod %s in namespace %s: %s", ip, namespace, err)
+		return nil, false
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP == ip.String() {
+			return addressAnswer(qname, qtype, ip.String(), clusterRecordTTL), true
+		}
+	}
+	return nil, false
+}
+
+// get addresses of service endpoints
+func (r *clusterResolver) addresses(svc *v1.Service) (addresses []v1.EndpointAddress) {
+	endpoints, err := r.endpoints.Endpoints(svc.Namespace).Get(svc.Name)
+	if err != nil {
+		return
+	}
+	for _, subset := range endpoints.Subsets {
+		addresses = append(addresses, readyAddresses(subset, svc)...)
+	}
+	return
+}
+
+// readyAddresses get ready addresses of subset, as well as not ready ones if service publishes them
+func readyAddresses(subset v1.EndpointSubset, svc *v1.Service) []v1.EndpointAddress {
+	if svc.Spec.PublishNotReadyAddresses {
+		return append(append([]v1.EndpointAddress{}, subset.Addresses...), subset.NotReadyAddresses...)
+	}
+	return subset.Addresses
+}
+
+// addressHostname hostname of endpoint address, or its dashed ip if hostname not specified
+func addressHostname(address v1.EndpointAddress) string {
+	if address.Hostname != "" {
+		return address.Hostname
+	}
+	return strings.NewReplacer(".", "-", ":", "-").Replace(address.IP)
+}
+
+func srvAnswer(qname string, port uint16, target string) dns.RR {
+	header := dns.RR_Header{Name: qname, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: clusterRecordTTL}
+	return &dns.SRV{Hdr: header, Priority: 0, Weight: 100, Port: port, Target: target}
+}
@@ -0,0 +1,151 @@
+package dnsserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sCache "k8s.io/client-go/tools/cache"
+)
+
+func TestClusterResolver(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	clientset := fake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: meta("tomcat"), Spec: v1.ServiceSpec{ClusterIP: "10.96.0.10",
+			Ports: []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 8080}}}},
+		&v1.Service{ObjectMeta: meta("db"), Spec: v1.ServiceSpec{ClusterIP: v1.ClusterIPNone,
+			Ports: []v1.ServicePort{{Name: "mysql", Protocol: v1.ProtocolTCP, Port: 3306}}}},
+		&v1.Endpoints{ObjectMeta: meta("db"), Subsets: []v1.EndpointSubset{{
+			Addresses:         []v1.EndpointAddress{{IP: "10.1.0.5", Hostname: "db-0"}, {IP: "10.1.0.6"}},
+			NotReadyAddresses: []v1.EndpointAddress{{IP: "10.1.0.9"}},
+			Ports:             []v1.EndpointPort{{Name: "mysql", Protocol: v1.ProtocolTCP, Port: 3306}},
+		}}},
+		&v1.Service{ObjectMeta: meta("ext"), Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName, ExternalName: "www.example.com"}},
+		&v1.Pod{ObjectMeta: meta("web"), Status: v1.PodStatus{PodIP: "10.1.0.7"}},
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	r := newClusterResolver(clientset, "cluster.local",
+		[]string{"default.svc.cluster.local.", "svc.cluster.local.", "cluster.local.", "corp.example.com."}, stop)
+	waitForSynced(t, r)
+
+	tests := []struct {
+		name      string
+		qtype     uint16
+		want      []string
+		inCluster bool
+	}{
+		{"tomcat.", dns.TypeA, []string{"tomcat.\t5\tIN\tA\t10.96.0.10"}, true},
+		{"tomcat.default.", dns.TypeA, []string{"tomcat.default.\t5\tIN\tA\t10.96.0.10"}, true},
+		{"tomcat.default.svc.cluster.local.", dns.TypeAAAA, []string{}, true},
+		{"db.default.svc.cluster.local.", dns.TypeA, []string{
+			"db.default.svc.cluster.local.\t5\tIN\tA\t10.1.0.5", "db.default.svc.cluster.local.\t5\tIN\tA\t10.1.0.6"}, true},
+		{"db-0.db.", dns.TypeA, []string{"db-0.db.\t5\tIN\tA\t10.1.0.5"}, true},
+		{"10-1-0-6.db.default.svc.cluster.local.", dns.TypeA, []string{"10-1-0-6.db.default.svc.cluster.local.\t5\tIN\tA\t10.1.0.6"}, true},
+		{"_http._tcp.tomcat.default.svc.cluster.local.", dns.TypeSRV, []string{
+			"_http._tcp.tomcat.default.svc.cluster.local.\t5\tIN\tSRV\t0 100 8080 tomcat.default.svc.cluster.local."}, true},
+		{"_mysql._tcp.db.", dns.TypeSRV, []string{
+			"_mysql._tcp.db.\t5\tIN\tSRV\t0 100 3306 db-0.db.default.svc.cluster.local.",
+			"_mysql._tcp.db.\t5\tIN\tSRV\t0 100 3306 10-1-0-6.db.default.svc.cluster.local."}, true},
+		{"10-1-0-7.default.pod.cluster.local.", dns.TypeA, []string{"10-1-0-7.default.pod.cluster.local.\t5\tIN\tA\t10.1.0.7"}, true},
+		{"ext.", dns.TypeA, []string{"ext.\t5\tIN\tCNAME\twww.example.com."}, true},
+		{"nginx.default.svc.cluster.local.", dns.TypeA, []string{}, true},
+		{"10-1-0-8.default.pod.cluster.local.", dns.TypeA, []string{}, true},
+		{"www.example.com.", dns.TypeA, []string{}, false},
+		{"nginx.", dns.TypeA, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, inCluster := r.resolve(tt.name, tt.name, tt.qtype)
+			got := []string{}
+			for _, a := range rr {
+				got = append(got, a.String())
+			}
+			if inCluster != tt.inCluster || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() = %v %v, want %v %v", got, inCluster, tt.want, tt.inCluster)
+			}
+		})
+	}
+}
+
+func TestClusterResolverNotSynced(t *testing.T) {
+	r := &clusterResolver{domain: "cluster.local", search: []string{"default.svc.cluster.local."},
+		synced: []k8sCache.InformerSynced{func() bool { return false }}}
+	if rr, inCluster := r.resolve("tomcat.default.svc.cluster.local.", "tomcat.default.svc.cluster.local.", dns.TypeA); inCluster {
+		t.Errorf("resolve() = %v %v before caches synced, want forwarded to upstream", rr, inCluster)
+	}
+}
+
+func waitForSynced(t *testing.T, r *clusterResolver) {
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(5*time.Second, func() { close(timeout) })
+	defer timer.Stop()
+	if !k8sCache.WaitForCacheSync(timeout, r.synced...) {
+		t.Fatalf("informer caches not synced")
+	}
+}
+
+func TestKubernetesResolverQuery(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "tomcat", Namespace: "default"},
+		Spec: v1.ServiceSpec{ClusterIP: "10.96.0.10"}})
+	stop := make(chan struct{})
+	defer close(stop)
+	s := newServer(&dns.ClientConfig{Search: []string{"default.svc.cluster.local", "svc.cluster.local"}}, "", "", "")
+	resolver := newClusterResolver(clientset, "cluster.local", s.getSuffixes(), stop)
+	waitForSynced(t, resolver)
+	s.resolver = resolver
+
+	req := new(dns.Msg)
+	req.SetQuestion("tomcat.", dns.TypeA)
+	if rr := s.query(req); len(rr) != 1 || rr[0].(*dns.A).A.String() != "10.96.0.10" {
+		t.Errorf("unexpected answer: %v", rr)
+	}
+}
+
+func TestExternalNameQuery(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	clientset := fake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: meta("tomcat"), Spec: v1.ServiceSpec{ClusterIP: "10.96.0.10"}},
+		&v1.Service{ObjectMeta: meta("alias"), Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName,
+			ExternalName: "tomcat.default.svc.cluster.local"}},
+		&v1.Service{ObjectMeta: meta("ext"), Spec: v1.ServiceSpec{Type: v1.ServiceTypeExternalName,
+			ExternalName: "www.example.com"}},
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	upstream, _ := startUpstream(t)
+	s := newServer(&dns.ClientConfig{Search: []string{"default.svc.cluster.local", "svc.cluster.local"}}, upstream, "", "")
+	resolver := newClusterResolver(clientset, "cluster.local", s.getSuffixes(), stop)
+	waitForSynced(t, resolver)
+	s.resolver = resolver
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"alias.", []string{"alias.\t5\tIN\tCNAME\ttomcat.default.svc.cluster.local.",
+			"tomcat.default.svc.cluster.local.\t5\tIN\tA\t10.96.0.10"}},
+		{"ext.", []string{"ext.\t5\tIN\tCNAME\twww.example.com.", "www.example.com.\t30\tIN\tA\t10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(tt.name, dns.TypeA)
+			got := []string{}
+			for _, a := range s.query(req) {
+				got = append(got, a.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
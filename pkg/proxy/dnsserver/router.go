@@ -0,0 +1,163 @@
+package dnsserver
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+// Route forward dns queries of one cluster to its cluster dns server
+type Route struct {
+	// Alias short suffix of cluster, e.g. 'staging' for 'svc.ns.staging'
+	Alias string
+	// Domain cluster domain, e.g. 'cluster.local'
+	Domain string
+	// Namespace default namespace used for short service names
+	Namespace string
+	// Upstream address of cluster dns server, e.g. '10.96.0.10:53'
+	Upstream string
+}
+
+// dns router
+type router struct {
+	routes    []Route
+	config    *dns.ClientConfig
+	overrides Overrides
+}
+
+// StartDNSRouter bind udp and tcp port of address and serve dns queries dispatched to different clusters,
+// the first route is used as default cluster for short service names,
+// queries not belong to any cluster are forwarded to nameservers in config, unless overridden
+func StartDNSRouter(address string, routes []Route, config *dns.ClientConfig, overrides Overrides) ([]*dns.Server, error) {
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+	handler := &router{routes, config, overrides}
+	servers := []*dns.Server{
+		{PacketConn: pc, Net: "udp", Handler: handler},
+		{Listener: l, Net: "tcp", Handler: handler},
+	}
+	for _, srv := range servers {
+		go func(srv *dns.Server) {
+			if err := srv.ActivateAndServe(); err != nil {
+				log.Error().Msgf("Dns router on %s stopped: %s", srv.Net, err)
+			}
+		}(srv)
+	}
+	for _, r := range routes {
+		log.Info().Msgf("Route *.%s and *.%s to %s", r.Alias, r.Domain, r.Upstream)
+	}
+	return servers, nil
+}
+
+// ServeDNS query DNS record
+func (r *router) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	msg := dns.Msg{}
+	msg.SetReply(req)
+	msg.RecursionAvailable = true
+	if len(req.Question) > 0 {
+		msg.Answer = r.query(req.Question[0].Name, req.Question[0].Qtype)
+	}
+	recordQuery(req, msg.Answer)
+	fitMessageSize(w, req, &msg)
+	_ = w.WriteMsg(&msg)
+}
+
+func (r *router) query(name string, qtype uint16) []dns.RR {
+	if !strings.HasSuffix(name, ".") {
+		name = name + "."
+	}
+	candidates := r.candidates(name)
+	names := []string{name}
+	for _, c := range candidates {
+		names = append(names, c.domain)
+	}
+	if ip, matched := r.overrides.Match(names...); matched {
+		return addressAnswer(name, qtype, ip, overrideTTL)
+	}
+	for _, candidate := range candidates {
+		rr, err := exchangeWith(candidate.upstream, "tcp", candidate.domain, qtype)
+		if err == nil && len(rr) > 0 {
+			return rewriteAnswer(name, candidate.domain, rr)
+		}
+	}
+	for _, server := range r.config.Servers {
+		rr, err := exchangeWith(net.JoinHostPort(server, r.config.Port), "udp", name, qtype)
+		if err == nil {
+			return rr
+		}
+	}
+	return nil
+}
+
+type candidate struct {
+	upstream string
+	domain   string
+}
+
+// get in-cluster names to lookup for specified name
+func (r *router) candidates(name string) (candidates []candidate) {
+	for _, route := range r.routes {
+		if strings.HasSuffix(name, "."+route.Domain+".") {
+			return []candidate{{route.Upstream, name}}
+		}
+		if route.Alias != "" && strings.HasSuffix(name, "."+route.Alias+".") {
+			// svc.ns.alias. -> svc.ns.svc.cluster.local.
+			prefix := strings.TrimSuffix(name, route.Alias+".")
+			return []candidate{{route.Upstream, prefix + "svc." + route.Domain + "."}}
+		}
+	}
+	if len(r.routes) == 0 {
+		return
+	}
+	def := r.routes[0]
+	switch strings.Count(name, ".") {
+	case 1:
+		// svc.
+		candidates = append(candidates, candidate{def.Upstream, name + def.Namespace + ".svc." + def.Domain + "."})
+	case 2:
+		// svc.ns.
+		candidates = append(candidates, candidate{def.Upstream, name + "svc." + def.Domain + "."})
+	}
+	return
+}
+
+// Look for domain record from upstream dns server
+func exchangeWith(address, network, domain string, qtype uint16) (rr []dns.RR, err error) {
+	log.Debug().Msgf("Resolving domain %s via upstream %s", domain, address)
+	c := &dns.Client{Net: network}
+	msg := new(dns.Msg)
+	msg.RecursionDesired = true
+	msg.SetQuestion(domain, qtype)
+	res, _, err := c.Exchange(msg, address)
+	if err != nil {
+		return
+	}
+	if res.Rcode == dns.RcodeNameError {
+		err = DomainNotExistError{domain}
+		return
+	}
+	return res.Answer, nil
+}
+
+// Replace in-cluster domain name with queried name in dns answer
+func rewriteAnswer(name, inClusterName string, answers []dns.RR) (rr []dns.RR) {
+	s := &server{}
+	for _, a := range answers {
+		r, err := s.convertAnswer(name, inClusterName, a)
+		if err != nil {
+			log.Warn().Msgf("Failed to convert answer %s: %s", a.String(), err)
+			continue
+		}
+		rr = append(rr, r)
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package dnsserver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRouterCandidates(t *testing.T) {
+	r := &router{routes: []Route{
+		{Alias: "staging", Domain: "cluster.local", Namespace: "default", Upstream: "10.96.0.10:53"},
+		{Alias: "dev", Domain: "dev.local", Namespace: "team", Upstream: "10.100.0.10:53"},
+	}}
+	tests := []struct {
+		name string
+		want []candidate
+	}{
+		{name: "tomcat.", want: []candidate{{"10.96.0.10:53", "tomcat.default.svc.cluster.local."}}},
+		{name: "tomcat.ns.", want: []candidate{{"10.96.0.10:53", "tomcat.ns.svc.cluster.local."}}},
+		{name: "tomcat.ns.dev.", want: []candidate{{"10.100.0.10:53", "tomcat.ns.svc.dev.local."}}},
+		{name: "tomcat.ns.svc.dev.local.", want: []candidate{{"10.100.0.10:53", "tomcat.ns.svc.dev.local."}}},
+		{name: "www.example.com.", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.candidates(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterOverride(t *testing.T) {
+	r := &router{
+		routes:    []Route{{Alias: "staging", Domain: "cluster.local", Namespace: "default", Upstream: "10.96.0.10:53"}},
+		overrides: ParseOverrides("tomcat.ns.svc.cluster.local=127.0.0.1"),
+	}
+	rr := r.query("tomcat.ns.staging.", dns.TypeA)
+	if len(rr) != 1 || rr[0].String() != "tomcat.ns.staging.\t5\tIN\tA\t127.0.0.1" {
+		t.Errorf("unexpected answer: %v", rr)
+	}
+}
+
+func TestStartDNSRouter(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to pick a free port: %s", err)
+	}
+	address := pc.LocalAddr().String()
+	_ = pc.Close()
+
+	servers, err := StartDNSRouter(address, nil, &dns.ClientConfig{},
+		ParseOverrides("tomcat.ns.svc.cluster.local=127.0.0.1"))
+	if err != nil {
+		t.Fatalf("failed to start dns router: %s", err)
+	}
+	defer func() {
+		for _, srv := range servers {
+			_ = srv.Shutdown()
+		}
+	}()
+
+	for _, network := range []string{"udp", "tcp"} {
+		msg := new(dns.Msg)
+		msg.SetQuestion("tomcat.ns.svc.cluster.local.", dns.TypeA)
+		res, _, err := (&dns.Client{Net: network}).Exchange(msg, address)
+		if err != nil || len(res.Answer) != 1 {
+			t.Errorf("unexpected %s answer: %v, %v", network, res, err)
+		}
+	}
+
+	if _, err = StartDNSRouter(address, nil, &dns.ClientConfig{}, nil); err == nil {
+		t.Errorf("should fail when address is already in use")
+	}
+}
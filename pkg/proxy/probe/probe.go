@@ -0,0 +1,69 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// settleTime how long a connection to forwarded port should stay open, ssh tunnel closes the connection
+// immediately if local listener can't be reached
+var settleTime = time.Second
+
+// Ports parse comma separated ports to probe, e.g. '8080,9090'
+func Ports(value string) []string {
+	var ports []string
+	for _, port := range strings.Split(value, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// Check whether address accepts connection and keeps it open, data received also means it's alive
+func Check(address string) error {
+	conn, err := net.DialTimeout("tcp", address, settleTime)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(settleTime))
+	if _, err = conn.Read(make([]byte, 1)); err == nil {
+		return nil
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return nil
+	}
+	return fmt.Errorf("connection closed immediately (%s), local listener may be gone", err)
+}
+
+// Handler readiness endpoint of shadow, respond 503 unless all forwarded ports reach live local listener
+func Handler(ports []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs := make([]error, len(ports))
+		var wg sync.WaitGroup
+		for i, port := range ports {
+			wg.Add(1)
+			go func(i int, port string) {
+				defer wg.Done()
+				errs[i] = Check(net.JoinHostPort("127.0.0.1", port))
+			}(i, port)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				log.Debug().Msgf("Port %s not ready: %s", ports[i], err)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = fmt.Fprintf(w, "port %s not ready: %s\n", ports[i], err)
+				return
+			}
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,81 @@
+package probe
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// listen start a listener on random port, accepted connections are passed to handle
+func listen(t *testing.T, handle func(conn net.Conn)) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, func() { listener.Close() }
+}
+
+func TestCheck(t *testing.T) {
+	originSettleTime := settleTime
+	settleTime = 100 * time.Millisecond
+	defer func() { settleTime = originSettleTime }()
+
+	alivePort, stopAlive := listen(t, func(conn net.Conn) {
+		time.Sleep(time.Second)
+		conn.Close()
+	})
+	defer stopAlive()
+	bannerPort, stopBanner := listen(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("220 ready\r\n"))
+		conn.Close()
+	})
+	defer stopBanner()
+	deadPort, stopDead := listen(t, func(conn net.Conn) {
+		conn.Close()
+	})
+	defer stopDead()
+	closedPort, stopClosed := listen(t, func(conn net.Conn) {})
+	stopClosed()
+
+	tests := []struct {
+		name  string
+		port  string
+		alive bool
+	}{
+		{"connection kept open", alivePort, true},
+		{"data received", bannerPort, true},
+		{"connection closed immediately", deadPort, false},
+		{"nothing listening", closedPort, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(net.JoinHostPort("127.0.0.1", tt.port))
+			if (err == nil) != tt.alive {
+				t.Errorf("Check() error = %v, expect alive %v", err, tt.alive)
+			}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler(Ports(alivePort+", "+deadPort)).ServeHTTP(recorder, httptest.NewRequest("GET", "/ready", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("should not be ready if any port is dead, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	Handler(Ports(alivePort+","+bannerPort)).ServeHTTP(recorder, httptest.NewRequest("GET", "/ready", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("should be ready if all ports are alive, got %d", recorder.Code)
+	}
+}
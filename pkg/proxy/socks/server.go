@@ -1,16 +1,30 @@
 package socks
 
 import (
+	"context"
 	"fmt"
+	"net"
+
 	"github.com/alibaba/kt-connect/pkg/common"
+	"github.com/alibaba/kt-connect/pkg/metrics"
 	"github.com/linfan/socks4"
 	"github.com/rs/zerolog/log"
 )
 
 func Start() {
-	svc := &socks4.Server{}
+	svc := &socks4.Server{ProxyDial: dial}
 	err := svc.ListenAndServe("tcp", fmt.Sprintf(":%d", common.Socks4Port))
 	if err != nil {
 		log.Error().Err(err)
 	}
 }
+
+// dial connect to target address and record the connection
+func dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err == nil {
+		metrics.SocksConnections.Inc()
+	}
+	return conn, err
+}